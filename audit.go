@@ -16,15 +16,26 @@ func init() {
 	const usage = `
 Examples:
 
-  List registered runners:
+  List recent privileged actions (secret changes, Discord commands, rebuilds, etc.):
 
-    $ wrench runner list
+    $ wrench audit
+
+  List secrets deleted by anyone:
+
+    $ wrench audit -action=secret-delete
+
+  List everything done by a specific Discord user:
+
+    $ wrench audit -actor=emidoots
 
 `
 
 	// Parse flags for our subcommand.
-	flagSet := flag.NewFlagSet("runners", flag.ExitOnError)
+	flagSet := flag.NewFlagSet("audit", flag.ExitOnError)
 	configFile := flagSet.String("config", "config.toml", "Path to TOML configuration file (see config.go)")
+	actor := flagSet.String("actor", "", "only list events by this actor")
+	action := flagSet.String("action", "", "only list events with this action")
+	limit := flagSet.Int("limit", 100, "maximum number of events to list")
 
 	// Handles calls to our subcommand.
 	handler := func(args []string) error {
@@ -34,17 +45,23 @@ Examples:
 		if err != nil {
 			return errors.Wrap(err, "Client")
 		}
-		resp, err := client.RunnerList(ctx, &api.RunnerListRequest{})
+		resp, err := client.AuditList(ctx, &api.AuditListRequest{
+			Actor:  *actor,
+			Action: *action,
+			Limit:  *limit,
+		})
 		if err != nil {
-			return errors.Wrap(err, "RunnerList")
+			return errors.Wrap(err, "AuditList")
 		}
-		if len(resp.Runners) == 0 {
-			fmt.Println("no runners found")
+		if len(resp.Events) == 0 {
+			fmt.Println("no audit events found")
 		}
-		for _, runner := range resp.Runners {
-			fmt.Printf("'%v' (%v)\n", runner.ID, runner.Arch)
-			fmt.Printf("    registered: %v ago\n", time.Since(runner.RegisteredAt).Round(time.Hour*24))
-			fmt.Printf("    last seen: %v ago\n\n", time.Since(runner.LastSeenAt).Round(time.Second))
+		for _, e := range resp.Events {
+			fmt.Printf("%s  %s (%s)  %s", e.Time.UTC().Format(time.RFC3339), e.Actor, e.Source, e.Action)
+			if e.Target != "" {
+				fmt.Printf("  %s", e.Target)
+			}
+			fmt.Println()
 		}
 		return nil
 	}
@@ -18,7 +18,7 @@ func Wrapf(err error, format string, args ...any) error {
 	if err == nil {
 		return nil
 	}
-	return fmt.Errorf(format+": %v", append(args, err))
+	return fmt.Errorf(format+": %v", append(args, err)...)
 }
 
 var (
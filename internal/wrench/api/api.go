@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 type RunnerPollRequest struct {
 	// ID is the unique identifier for this runner. It must not conflict with other runners.
 	ID string
@@ -62,3 +64,117 @@ type SecretsUpsertRequest struct {
 }
 
 type SecretsUpsertResponse struct{}
+
+// StatsResponse is served by GET /api/stats/<id>.
+type StatsResponse struct {
+	ID    string
+	Stats []Stat
+}
+
+type LogsSearchRequest struct {
+	// Phrase to search log messages for, e.g. "error: unable to find".
+	Phrase string
+
+	// (optional) Only search logs whose ID starts with this prefix, e.g. "job-".
+	IDPrefix string
+
+	// (optional) Maximum number of results, defaults to 100.
+	Limit int
+}
+
+type LogsSearchResponse struct {
+	Results []LogSearchResult
+}
+
+type AuditListRequest struct {
+	// (optional) Only list events by this actor.
+	Actor string
+
+	// (optional) Only list events with this action.
+	Action string
+
+	// (optional) Maximum number of events, defaults to 100.
+	Limit int
+}
+
+type AuditListResponse struct {
+	// Events, most recent first.
+	Events []AuditEvent
+}
+
+type JobsListRequest struct {
+	// (optional) Filters, which must all match.
+	State, NotState             JobState
+	Title, NotTitle             string
+	TargetRunnerID              string
+	ScheduledStartLessOrEqualTo time.Time
+
+	// (optional) Maximum number of jobs per page, defaults to 50 (at most 500.)
+	Limit int
+
+	// (optional) NextCursor from the previous page of results.
+	Cursor string
+}
+
+type JobsListResponse struct {
+	// Jobs, newest first.
+	Jobs []Job
+
+	// NextCursor, if non-empty, can be specified as JobsListRequest.Cursor to fetch the next page.
+	NextCursor string
+}
+
+type JobsGetRequest struct {
+	ID JobID
+}
+
+type JobsGetResponse struct {
+	Job Job
+
+	NotFound bool
+}
+
+type JobsCreateRequest struct {
+	Title string
+
+	// (optional) Runner to perform the job, see RunnerListRequest. If empty, any runner matching
+	// TargetRunnerArch (or any runner at all) may perform it.
+	TargetRunnerID, TargetRunnerArch string
+
+	Payload JobPayload
+
+	// (optional) Do not start the job before this time.
+	ScheduledStart time.Time
+}
+
+type JobsCreateResponse struct {
+	ID JobID
+}
+
+type JobsCancelRequest struct {
+	ID JobID
+}
+
+type JobsCancelResponse struct {
+	NotFound bool
+}
+
+type JobsLogsRequest struct {
+	ID JobID
+
+	// (optional) Number of log entries to skip, i.e. JobsLogsResponse.Offset from a previous
+	// request, to only receive new logs.
+	Offset int
+}
+
+type JobsLogsResponse struct {
+	Logs []Log
+
+	// Offset to specify in the next request to only receive new logs.
+	Offset int
+
+	// State of the job, so callers following logs know when it has finished.
+	State JobState
+
+	NotFound bool
+}
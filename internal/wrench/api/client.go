@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -14,12 +15,17 @@ type Client struct {
 	URL    string
 	Secret string
 
+	// TLSConfig, if non-nil, is used for connections to the server, e.g. to present a runner
+	// client certificate.
+	TLSConfig *tls.Config
+
 	client *http.Client
 }
 
 func clientDo[Request any, Response any](c *Client, ctx context.Context, r *Request, endpoint string) (*Response, error) {
 	if c.client == nil {
 		c.client = &http.Client{
+			Transport: transport(c.TLSConfig),
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				req.Header.Add("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(":"+c.Secret)))
 				return nil
@@ -53,6 +59,15 @@ func clientDo[Request any, Response any](c *Client, ctx context.Context, r *Requ
 	return &rsp, nil
 }
 
+func transport(tlsConfig *tls.Config) http.RoundTripper {
+	if tlsConfig == nil {
+		return http.DefaultTransport
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	return t
+}
+
 func (c *Client) RunnerPoll(ctx context.Context, r *RunnerPollRequest) (*RunnerPollResponse, error) {
 	return clientDo[RunnerPollRequest, RunnerPollResponse](c, ctx, r, "/api/runner/poll")
 }
@@ -76,3 +91,31 @@ func (c *Client) SecretsDelete(ctx context.Context, r *SecretsDeleteRequest) (*S
 func (c *Client) SecretsUpsert(ctx context.Context, r *SecretsUpsertRequest) (*SecretsUpsertResponse, error) {
 	return clientDo[SecretsUpsertRequest, SecretsUpsertResponse](c, ctx, r, "/api/secrets/upsert")
 }
+
+func (c *Client) LogsSearch(ctx context.Context, r *LogsSearchRequest) (*LogsSearchResponse, error) {
+	return clientDo[LogsSearchRequest, LogsSearchResponse](c, ctx, r, "/api/logs/search")
+}
+
+func (c *Client) AuditList(ctx context.Context, r *AuditListRequest) (*AuditListResponse, error) {
+	return clientDo[AuditListRequest, AuditListResponse](c, ctx, r, "/api/audit/list")
+}
+
+func (c *Client) JobsList(ctx context.Context, r *JobsListRequest) (*JobsListResponse, error) {
+	return clientDo[JobsListRequest, JobsListResponse](c, ctx, r, "/api/jobs/list")
+}
+
+func (c *Client) JobsGet(ctx context.Context, r *JobsGetRequest) (*JobsGetResponse, error) {
+	return clientDo[JobsGetRequest, JobsGetResponse](c, ctx, r, "/api/jobs/get")
+}
+
+func (c *Client) JobsCreate(ctx context.Context, r *JobsCreateRequest) (*JobsCreateResponse, error) {
+	return clientDo[JobsCreateRequest, JobsCreateResponse](c, ctx, r, "/api/jobs/create")
+}
+
+func (c *Client) JobsCancel(ctx context.Context, r *JobsCancelRequest) (*JobsCancelResponse, error) {
+	return clientDo[JobsCancelRequest, JobsCancelResponse](c, ctx, r, "/api/jobs/cancel")
+}
+
+func (c *Client) JobsLogs(ctx context.Context, r *JobsLogsRequest) (*JobsLogsResponse, error) {
+	return clientDo[JobsLogsRequest, JobsLogsResponse](c, ctx, r, "/api/jobs/logs")
+}
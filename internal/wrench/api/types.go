@@ -125,3 +125,46 @@ type Job struct {
 	Payload                          JobPayload
 	ScheduledStart, Updated, Created time.Time
 }
+
+// JobEvent records a job entering a state.
+type JobEvent struct {
+	Time  time.Time
+	State JobState
+
+	// RunnerID is the runner the job was assigned to at the time, if any.
+	RunnerID string
+}
+
+type LogSearchResult struct {
+	// ID of the log, e.g. "job-<id>" for job logs.
+	ID   string
+	Time time.Time
+
+	// Snippet is the part of the log message around the matches.
+	Snippet string
+
+	// Matches are the [start, end) byte offsets of each match in Snippet.
+	Matches [][2]int
+}
+
+// AuditEvent records a privileged action, e.g. a secret being changed or a job being cancelled.
+type AuditEvent struct {
+	Time time.Time
+
+	// Actor who performed the action, e.g. a Discord or GitHub username.
+	Actor string
+
+	// Source the action came from, e.g. "discord", "api", "http" or "github".
+	Source string
+
+	// Action performed, e.g. "secret-upsert" or "cancel-job".
+	Action string
+
+	// (optional) Target of the action, e.g. a secret or job ID.
+	Target string
+}
+
+type Log struct {
+	Time    time.Time
+	Message string
+}
@@ -0,0 +1,66 @@
+package wrench
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+// Sources of audit events, see api.AuditEvent.
+const (
+	AuditSourceDiscord = "discord"
+	AuditSourceAPI     = "api"
+	AuditSourceHTTP    = "http"
+	AuditSourceGitHub  = "github"
+)
+
+type auditActorKey struct{}
+
+type auditActor struct {
+	actor, source string
+}
+
+// withAuditActor returns a context which attributes audit events to the given actor and source.
+func withAuditActor(ctx context.Context, actor, source string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, auditActor{actor: actor, source: source})
+}
+
+// auditActorFromRequest describes who made an authenticated HTTP request, as login@host.
+func auditActorFromRequest(r *http.Request) string {
+	if id := identityFromContext(r.Context()); id != nil {
+		return id.Login + "@" + remoteHost(r)
+	}
+	// Only Config.Secret is accepted via basic auth without an identity, and the username sent
+	// with it is up to the client.
+	return "secret@" + remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// audit records a privileged action in the audit log, attributed to the actor in ctx. Failing to
+// record is logged, but does not fail the action itself.
+func (b *Bot) audit(ctx context.Context, action, target string) {
+	a, ok := ctx.Value(auditActorKey{}).(auditActor)
+	if !ok {
+		a = auditActor{actor: "unknown", source: "unknown"}
+	}
+	event := api.AuditEvent{
+		Time:   time.Now(),
+		Actor:  a.actor,
+		Source: a.source,
+		Action: action,
+		Target: target,
+	}
+	if err := b.store.RecordAudit(ctx, event); err != nil {
+		b.logf("audit: failed to record %+v: %v", event, err)
+	}
+}
@@ -0,0 +1,533 @@
+package wrench
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v48/github"
+	"github.com/hexops/wrench/internal/errors"
+	"golang.org/x/oauth2"
+	githuboauth "golang.org/x/oauth2/github"
+)
+
+// Role is what a user is allowed to do, see AuthConfig.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+var roles = []Role{RoleViewer, RoleOperator, RoleAdmin}
+
+func (r Role) rank() int {
+	for i, role := range roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// atLeast reports whether r has all the permissions of min.
+func (r Role) atLeast(min Role) bool {
+	return r.rank() > 0 && r.rank() >= min.rank()
+}
+
+// Identity is who made an HTTP request.
+type Identity struct {
+	Login string
+	Role  Role
+
+	// Via is how the request was authenticated: "secret" (Config.Secret via basic auth), "token"
+	// (an API token) or "session" (signed in with GitHub.)
+	Via string
+}
+
+const (
+	sessionCookieName = "wrench_session"
+	oauthStateCookie  = "wrench_oauth_state"
+	apiTokenPrefix    = "wrench_"
+)
+
+type identityKey struct{}
+
+func withIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func identityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// hashToken returns the hash of a session or API token, which is what the store keeps.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// httpIdentity returns who made the request, or nil if it is not authenticated. Requests may be
+// authenticated with:
+//
+//   - Basic auth with Config.Secret as the password (admin role, for backwards compatibility.)
+//   - Basic auth with an API token as the password, or an "Authorization: Bearer <token>" header.
+//     Tokens only work while their owner is allowed to sign in, see apiTokenRole.
+//   - A session cookie, after signing in with GitHub.
+func (b *Bot) httpIdentity(r *http.Request) *Identity {
+	if id := identityFromContext(r.Context()); id != nil {
+		return id
+	}
+	ctx := r.Context()
+	apiToken := func(token string) *Identity {
+		if b.store == nil {
+			// The pkg and zig modes have no store, and so only accept Config.Secret.
+			return nil
+		}
+		t, err := b.store.APITokenByHash(ctx, hashToken(token))
+		if err != nil {
+			return nil
+		}
+		role := b.apiTokenRole(ctx, t)
+		if role == "" {
+			return nil
+		}
+		return &Identity{Login: t.Login, Role: role, Via: "token"}
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return apiToken(token)
+	}
+	if _, pass, ok := r.BasicAuth(); ok {
+		if b.Config.Secret != "" && subtle.ConstantTimeCompare([]byte(pass), []byte(b.Config.Secret)) == 1 {
+			// The username is whatever the client sent, so it must not be trusted as who they are.
+			return &Identity{Login: "secret", Role: RoleAdmin, Via: "secret"}
+		}
+		if strings.HasPrefix(pass, apiTokenPrefix) {
+			return apiToken(pass)
+		}
+		return nil
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && b.store != nil {
+		session, err := b.store.Session(ctx, hashToken(cookie.Value))
+		if err != nil {
+			return nil
+		}
+		// Memberships may have been lost since signing in.
+		role := b.userRole(ctx, session.Login, session.Role)
+		if role == "" {
+			return nil
+		}
+		return &Identity{Login: session.Login, Role: role, Via: "session"}
+	}
+	return nil
+}
+
+func (b *Bot) oauthEnabled() bool {
+	return b.Config.GitHubOAuthClientID != "" && b.Config.GitHubOAuthClientSecret != ""
+}
+
+func (b *Bot) oauthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     b.Config.GitHubOAuthClientID,
+		ClientSecret: b.Config.GitHubOAuthClientSecret,
+		Endpoint:     githuboauth.Endpoint,
+		RedirectURL:  b.Config.ExternalURL + "/login/callback",
+		Scopes:       []string{"read:org"},
+	}
+}
+
+// httpRequireRole only calls handler if the request is authenticated with at least the given role.
+// Unauthenticated web UI requests are sent to sign in with GitHub, if enabled, and otherwise are
+// asked for basic auth credentials.
+func (b *Bot) httpRequireRole(role Role, handler handlerFunc) handlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if b.Config.Secret == "" && !b.oauthEnabled() {
+			return errors.New("API not enabled; Config.Secret not configured.")
+		}
+
+		id := b.httpIdentity(r)
+		if id == nil {
+			if b.oauthEnabled() && r.Method == "GET" && !strings.HasPrefix(r.URL.Path, "/api/") {
+				http.Redirect(w, r, b.Config.ExternalURL+"/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return nil
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="wrench"`)
+			w.WriteHeader(401)
+			_, err := w.Write([]byte("Unauthorised.\n"))
+			return err
+		}
+		if !id.Role.atLeast(role) {
+			w.WriteHeader(403)
+			_, err := fmt.Fprintf(w, "Forbidden: requires the %s role, but %s has the %s role.\n", role, id.Login, id.Role)
+			return err
+		}
+		return handler(w, r.WithContext(withIdentity(r.Context(), id)))
+	}
+}
+
+// authRole returns the role of a GitHub user per Config.Auth, or an empty role if they may not
+// sign in. client must be authenticated as the user.
+func (b *Bot) authRole(ctx context.Context, client *github.Client, login string) Role {
+	role, _ := b.authMembershipRole(ctx, client, "", login)
+	return role
+}
+
+// authMembershipRole returns the role of a GitHub user per Config.Auth. client must be
+// authenticated as the user (with user empty), or as an organization member who may see the
+// user's memberships (with user set to login.)
+//
+// Memberships which could not be checked, e.g. due to a GitHub API error, are not granted and
+// make ok false, so that callers can tell a lost membership from a failed check.
+func (b *Bot) authMembershipRole(ctx context.Context, client *github.Client, user, login string) (role Role, ok bool) {
+	role, ok = b.authUserRole(login), true
+	grant := func(r Role, state string, err error) {
+		var errResp *github.ErrorResponse
+		switch {
+		case err == nil && state == "active" && r.rank() > role.rank():
+			role = r
+		case err != nil && !(errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound):
+			ok = false
+		}
+	}
+	for _, rule := range b.Config.Auth.Orgs {
+		if rule.Role.rank() <= role.rank() {
+			continue
+		}
+		membership, _, err := client.Organizations.GetOrgMembership(ctx, user, rule.Org)
+		grant(rule.Role, membership.GetState(), err)
+	}
+	for _, rule := range b.Config.Auth.Teams {
+		if rule.Role.rank() <= role.rank() {
+			continue
+		}
+		membership, _, err := client.Teams.GetTeamMembershipBySlug(ctx, rule.Org, rule.Team, login)
+		grant(rule.Role, membership.GetState(), err)
+	}
+	return role, ok
+}
+
+// authRecheckStart periodically checks the memberships of signed in users again with the bot's
+// own GitHub account, which must be a member of the organizations in Config.Auth, and signs out
+// users who lost them. Without it, sessions keep their role until they expire.
+func (b *Bot) authRecheckStart() {
+	if b.github == nil || !b.oauthEnabled() {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		for {
+			time.Sleep(time.Hour)
+			if err := b.authRecheck(ctx); err != nil {
+				b.logf("auth: recheck failed: %v", err)
+			}
+		}
+	}()
+}
+
+func (b *Bot) authRecheck(ctx context.Context) error {
+	logins, err := b.store.SessionLogins(ctx)
+	if err != nil {
+		return errors.Wrap(err, "SessionLogins")
+	}
+	for _, login := range logins {
+		role, ok := b.authMembershipRole(ctx, b.github, login, login)
+		if !ok {
+			continue
+		}
+		if err := b.store.RecordAuthCheck(ctx, AuthCheck{Login: login, Role: role, Checked: time.Now()}); err != nil {
+			return errors.Wrap(err, "RecordAuthCheck")
+		}
+		if role == "" {
+			if err := b.store.DeleteSessions(ctx, login); err != nil {
+				return errors.Wrap(err, "DeleteSessions")
+			}
+			b.logf("auth: %s may no longer sign in, signed out", login)
+		}
+	}
+	return nil
+}
+
+// authUserRole returns the role given to a GitHub user by name in Config.Auth.Users, if any.
+func (b *Bot) authUserRole(login string) Role {
+	var role Role
+	for user, r := range b.Config.Auth.Users {
+		if strings.EqualFold(user, login) && r.rank() > role.rank() {
+			role = r
+		}
+	}
+	return role
+}
+
+// apiTokenRole returns the role an API token may use, or an empty role if it may not be used.
+func (b *Bot) apiTokenRole(ctx context.Context, t APIToken) Role {
+	return b.userRole(ctx, t.Login, t.Role)
+}
+
+// userRole returns the role a signed in user or their API token may use, up to limit (the role
+// the session or token was created with), or an empty role if they may not sign in anymore.
+//
+// Organization and team memberships can only be reliably checked with the user's own GitHub
+// credentials, which are not kept, so they are checked each time the user signs in (and while
+// they are signed in, see authRecheckStart.) The roles found by a check in the last
+// Config.Auth.SessionDays may be used, as may the roles given by name in Config.Auth.Users. So
+// once a user leaves an organization, their tokens stop working when they next sign in, or after
+// SessionDays at the latest.
+func (b *Bot) userRole(ctx context.Context, login string, limit Role) Role {
+	role := b.authUserRole(login)
+	check, err := b.store.AuthCheck(ctx, login)
+	maxAge := time.Duration(b.Config.Auth.SessionDays) * 24 * time.Hour
+	if err == nil && time.Since(check.Checked) < maxAge && check.Role.rank() > role.rank() {
+		role = check.Role
+	}
+	if role.rank() == 0 {
+		return ""
+	}
+	if limit.rank() < role.rank() {
+		return limit
+	}
+	return role
+}
+
+// sameOrigin reports whether the request was made by a page of ours, per its Origin header (or
+// Referer, for older browsers), to protect state-changing requests against cross-site forgery.
+func (b *Bot) sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	u, err := url.Parse(origin)
+	if origin == "" || err != nil {
+		return false
+	}
+	external, err := url.Parse(b.Config.ExternalURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == external.Scheme && u.Host == external.Host
+}
+
+// rejectCrossOrigin responds with 403 Forbidden and returns true if the state-changing request
+// was not made by a page of ours, see sameOrigin.
+func (b *Bot) rejectCrossOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if b.sameOrigin(r) {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = fmt.Fprintf(w, "Cross-origin requests are not allowed.\n")
+	return true
+}
+
+// safeRedirect returns next if it is a local path, and "/" otherwise.
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (b *Bot) httpServeLogin(w http.ResponseWriter, r *http.Request) error {
+	if !b.oauthEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprintf(w, "Signing in with GitHub is not enabled (Config.GitHubOAuthClientID not configured.)\n")
+		return nil
+	}
+	state, err := newToken("")
+	if err != nil {
+		return errors.Wrap(err, "newToken")
+	}
+	// The state cookie carries where to go after signing in, too.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state + "|" + safeRedirect(r.URL.Query().Get("next")),
+		Path:     "/login",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(b.Config.ExternalURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, b.oauthConfig().AuthCodeURL(state), http.StatusFound)
+	return nil
+}
+
+func (b *Bot) httpServeLoginCallback(w http.ResponseWriter, r *http.Request) error {
+	if !b.oauthEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Sign in expired, please try again.\n")
+		return nil
+	}
+	state, next, _ := strings.Cut(cookie.Value, "|")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(r.URL.Query().Get("state"))) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Invalid sign in state, please try again.\n")
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/login", MaxAge: -1})
+
+	ctx := r.Context()
+	conf := b.oauthConfig()
+	token, err := conf.Exchange(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		return errors.Wrap(err, "Exchange")
+	}
+	client := github.NewClient(conf.Client(ctx, token))
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return errors.Wrap(err, "Users.Get")
+	}
+	login := user.GetLogin()
+	role := b.authRole(ctx, client, login)
+	if err := b.store.RecordAuthCheck(ctx, AuthCheck{Login: login, Role: role, Checked: time.Now()}); err != nil {
+		return errors.Wrap(err, "RecordAuthCheck")
+	}
+	if role == "" {
+		if err := b.store.DeleteSessions(ctx, login); err != nil {
+			return errors.Wrap(err, "DeleteSessions")
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, "Your GitHub account (%s) is not allowed to sign in here.\n", html.EscapeString(login))
+		return nil
+	}
+
+	sessionToken, err := newToken("")
+	if err != nil {
+		return errors.Wrap(err, "newToken")
+	}
+	now := time.Now()
+	expires := now.Add(time.Duration(b.Config.Auth.SessionDays) * 24 * time.Hour)
+	if err := b.store.CreateSession(ctx, Session{
+		TokenHash: hashToken(sessionToken),
+		Login:     login,
+		Role:      role,
+		Created:   now,
+		Expires:   expires,
+	}); err != nil {
+		return errors.Wrap(err, "CreateSession")
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    sessionToken,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(b.Config.ExternalURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	b.audit(withAuditActor(ctx, login+"@"+remoteHost(r), AuditSourceHTTP), "login", string(role))
+	http.Redirect(w, r, b.Config.ExternalURL+safeRedirect(next), http.StatusFound)
+	return nil
+}
+
+// httpServeLogout signs out. It only accepts POST requests from our own pages, so that other
+// sites cannot sign users out.
+func (b *Bot) httpServeLogout(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
+	}
+	if !b.sameOrigin(r) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, "Cross-origin sign out requests are not allowed.\n")
+		return nil
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && b.store != nil {
+		if err := b.store.DeleteSession(r.Context(), hashToken(cookie.Value)); err != nil {
+			return errors.Wrap(err, "DeleteSession")
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, b.Config.ExternalURL+"/", http.StatusFound)
+	return nil
+}
+
+// httpServeTokens serves /tokens, where users manage their personal API tokens.
+func (b *Bot) httpServeTokens(w http.ResponseWriter, r *http.Request) error {
+	ctx := withAuditActor(r.Context(), auditActorFromRequest(r), AuditSourceHTTP)
+	id := b.httpIdentity(r)
+
+	type createdToken struct{ Name, Token string }
+	var created *createdToken
+	if r.Method == "POST" {
+		if b.rejectCrossOrigin(w, r) {
+			return nil
+		}
+		switch r.FormValue("action") {
+		case "create":
+			name := strings.TrimSpace(r.FormValue("name"))
+			role := Role(r.FormValue("role"))
+			if name == "" || role.rank() == 0 || !id.Role.atLeast(role) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = fmt.Fprintf(w, "A name and a role no higher than your own (%s) are required.\n", id.Role)
+				return nil
+			}
+			token, err := newToken(apiTokenPrefix)
+			if err != nil {
+				return errors.Wrap(err, "newToken")
+			}
+			if _, err := b.store.CreateAPIToken(ctx, APIToken{
+				TokenHash: hashToken(token),
+				Name:      name,
+				Login:     id.Login,
+				Role:      role,
+				Created:   time.Now(),
+			}); err != nil {
+				return errors.Wrap(err, "CreateAPIToken")
+			}
+			b.audit(ctx, "token-create", name)
+			created = &createdToken{Name: name, Token: token}
+		case "delete":
+			tokenID, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return nil
+			}
+			if err := b.store.DeleteAPIToken(ctx, id.Login, tokenID); err != nil {
+				return errors.Wrap(err, "DeleteAPIToken")
+			}
+			b.audit(ctx, "token-delete", strconv.FormatInt(tokenID, 10))
+		}
+	}
+
+	tokens, err := b.store.APITokens(ctx, id.Login)
+	if err != nil {
+		return errors.Wrap(err, "APITokens")
+	}
+	var grantable []Role
+	for _, role := range roles {
+		if id.Role.atLeast(role) {
+			grantable = append(grantable, role)
+		}
+	}
+	return b.render(w, r, "tokens", "API tokens", map[string]any{
+		"Created":     created,
+		"Tokens":      tokens,
+		"Roles":       grantable,
+		"SessionDays": b.Config.Auth.SessionDays,
+	})
+}
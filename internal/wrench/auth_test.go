@@ -0,0 +1,152 @@
+package wrench
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func TestAPITokenRole(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{Auth: AuthConfig{
+			Users:       map[string]Role{"carol": RoleViewer},
+			SessionDays: 30,
+		}}}
+
+		check := func(login string, role Role, age time.Duration) {
+			t.Helper()
+			if err := s.RecordAuthCheck(ctx, AuthCheck{Login: login, Role: role, Checked: time.Now().Add(-age)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		check("alice", RoleOperator, time.Hour)
+		check("bob", "", time.Hour)               // left the organization
+		check("dave", RoleAdmin, 31*24*time.Hour) // not signed in for too long
+		check("carol", RoleAdmin, 31*24*time.Hour)
+
+		for _, tst := range []struct {
+			login     string
+			tokenRole Role
+			wantRole  Role
+		}{
+			{"alice", RoleViewer, RoleViewer},
+			{"alice", RoleAdmin, RoleOperator},
+			{"bob", RoleViewer, ""},
+			{"dave", RoleViewer, ""},
+			{"carol", RoleAdmin, RoleViewer},
+			{"erin", RoleViewer, ""}, // never signed in
+		} {
+			got := b.apiTokenRole(ctx, APIToken{Login: tst.login, Role: tst.tokenRole})
+			if got != tst.wantRole {
+				t.Errorf("%s token with role %q: expected role %q, found %q", tst.login, tst.tokenRole, tst.wantRole, got)
+			}
+		}
+	})
+}
+
+func TestSessionMembershipLost(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{Auth: AuthConfig{SessionDays: 30}}}
+		now := time.Now()
+		for _, token := range []string{"laptop", "phone"} {
+			if err := s.CreateSession(ctx, Session{TokenHash: hashToken(token), Login: "alice", Role: RoleOperator, Created: now, Expires: now.Add(time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		identity := func(token string) *Identity {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+			return b.httpIdentity(r)
+		}
+		check := func(role Role) {
+			t.Helper()
+			if err := s.RecordAuthCheck(ctx, AuthCheck{Login: "alice", Role: role, Checked: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		check(RoleAdmin)
+		if id := identity("laptop"); id == nil || id.Role != RoleOperator {
+			t.Fatalf("expected the role the session was created with, found %+v", id)
+		}
+		check(RoleViewer)
+		if id := identity("laptop"); id == nil || id.Role != RoleViewer {
+			t.Fatalf("expected the role to be lowered to the latest check, found %+v", id)
+		}
+		check("")
+		if id := identity("laptop"); id != nil {
+			t.Fatalf("expected no identity after losing membership, found %+v", id)
+		}
+
+		if logins, err := s.SessionLogins(ctx); err != nil || len(logins) != 1 || logins[0] != "alice" {
+			t.Fatalf("unexpected SessionLogins %v %v", logins, err)
+		}
+		if err := s.DeleteSessions(ctx, "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if logins, err := s.SessionLogins(ctx); err != nil || len(logins) != 0 {
+			t.Fatalf("expected all sessions to be deleted, found %v %v", logins, err)
+		}
+	})
+}
+
+func TestCrossOriginRequests(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{ExternalURL: "https://wrench.example.com", Secret: "secret"}}
+		job, err := s.NewRunnerJob(ctx, api.Job{Title: "build", Payload: api.JobPayload{Cmd: []string{"echo"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		admin := &Identity{Login: "alice", Role: RoleAdmin, Via: "session"}
+
+		for _, tst := range []struct {
+			target string
+			body   string
+			serve  handlerFunc
+		}{
+			{"/rebuild", "", b.httpServeRebuild},
+			{"/tokens", "action=create&name=laptop&role=viewer", b.httpServeTokens},
+			{"/jobs/" + string(job) + "/retry", "", b.httpServeJob},
+		} {
+			for _, origin := range []string{"", "https://evil.example.com"} {
+				r := httptest.NewRequest("POST", tst.target, strings.NewReader(tst.body))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				if origin != "" {
+					r.Header.Set("Origin", origin)
+				}
+				r = r.WithContext(withIdentity(r.Context(), admin))
+				w := httptest.NewRecorder()
+				if err := tst.serve(w, r); err != nil {
+					t.Fatal(err)
+				}
+				if w.Code != http.StatusForbidden {
+					t.Errorf("%s from origin %q: got status %d, want 403", tst.target, origin, w.Code)
+				}
+			}
+		}
+		if tokens, err := s.APITokens(ctx, "alice"); err != nil || len(tokens) != 0 {
+			t.Fatalf("expected no tokens to be created, found %v %v", tokens, err)
+		}
+		if jobs, err := s.Jobs(ctx); err != nil || len(jobs) != 1 {
+			t.Fatalf("expected no job to be retried, found %v %v", jobs, err)
+		}
+
+		// Rebuilding asks for confirmation first.
+		r := httptest.NewRequest("GET", "/rebuild", nil).WithContext(withIdentity(ctx, admin))
+		w := httptest.NewRecorder()
+		if err := b.httpServeRebuild(w, r); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post">`) {
+			t.Fatalf("expected a confirmation form, got %d %q", w.Code, w.Body.String())
+		}
+	})
+}
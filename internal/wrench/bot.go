@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -26,7 +27,8 @@ type Bot struct {
 
 	started                    bool
 	logFile                    *os.File
-	store                      *Store
+	store                      Store
+	logStream                  logStream
 	github                     *github.Client
 	discordSession             *discordgo.Session
 	discordCommandHelp         [][2]string
@@ -34,8 +36,20 @@ type Bot struct {
 	discordCommandsEmbed       map[string]func(...string) *discordgo.MessageEmbed
 	discordCommandsEmbedSecure map[string]func(...string) *discordgo.MessageEmbed
 	runner                     *api.Client
+	runnerStopping             chan struct{}
+	runnerKill                 chan struct{}
+	runnerPollDone             chan struct{}
+	runnerJobs                 sync.WaitGroup
+	httpServersMu              sync.Mutex
+	httpServers                []*http.Server
+	httpShutdown               chan struct{}
+	pkgLimits                  *pkgLimiter
+	upstreamHealth             *pkgUpstreamHealth
+	stopOnce                   sync.Once
+	stopErr                    error
 	rebuildSelfMu              sync.Mutex
 	jobAcquire                 sync.Mutex
+	regressionsMu              sync.Mutex
 	schedule                   []ScheduledJob
 }
 
@@ -66,7 +80,9 @@ func (b *Bot) idLogf(id, format string, v ...any) {
 	}
 	// May be called before DB is initialized.
 	if b.store != nil {
-		_ = b.store.Log(context.Background(), id, msg)
+		b.logStream.write(id, func() (Log, error) {
+			return b.store.AppendLog(context.Background(), id, msg)
+		})
 	}
 }
 
@@ -124,13 +140,19 @@ func (b *Bot) run(s service.Service) error {
 
 	if b.Config.Runner == "" {
 		if b.Config.ModeType() == ModeWrench {
-			b.store, err = OpenStore(filepath.Join(b.Config.WrenchDir, "wrench.db") + "?_pragma=busy_timeout%3d10000")
+			b.store, err = OpenStore(b.Config)
 			if err != nil {
 				return errors.Wrap(err, "OpenStore")
 			}
+			if err := b.secretsKeyStart(context.Background()); err != nil {
+				return errors.Wrap(err, "secrets key")
+			}
+			b.retentionStart()
+			b.backupStart()
 			if err := b.githubStart(); err != nil {
 				return errors.Wrap(err, "github")
 			}
+			b.authRecheckStart()
 			if err := b.discordStart(); err != nil {
 				return errors.Wrap(err, "discord")
 			}
@@ -171,28 +193,42 @@ func (b *Bot) Stop(s service.Service) error {
 	return b.stop()
 }
 
+// stop shuts down gracefully. It may be called more than once, e.g. by both the signal handler
+// and the service manager.
 func (b *Bot) stop() error {
 	if !b.started {
 		return nil
 	}
-	_ = b.logFile.Close()
-	if b.Config.Runner == "" {
-		if err := b.githubStop(); err != nil {
-			return errors.Wrap(err, "github")
-		}
-		if err := b.discordStop(); err != nil {
-			return errors.Wrap(err, "discord")
-		}
-		if err := b.httpStop(); err != nil {
-			return errors.Wrap(err, "http")
-		}
-		if b.store != nil {
-			if err := b.store.Close(); err != nil {
-				return errors.Wrap(err, "Store.Close")
-			}
-		}
-		if err := b.schedulerStop(); err != nil {
-			return errors.Wrap(err, "scheduler")
+	b.stopOnce.Do(func() {
+		b.stopErr = b.doStop()
+		_ = b.logFile.Close()
+	})
+	return b.stopErr
+}
+
+func (b *Bot) doStop() error {
+	if b.Config.Runner != "" {
+		b.runnerStop()
+		return nil
+	}
+	if err := b.githubStop(); err != nil {
+		return errors.Wrap(err, "github")
+	}
+	if err := b.discordStop(); err != nil {
+		return errors.Wrap(err, "discord")
+	}
+	if err := b.schedulerStop(); err != nil {
+		return errors.Wrap(err, "scheduler")
+	}
+	// In-flight requests may still need the store, so it is closed last.
+	if err := b.httpStop(); err != nil {
+		return errors.Wrap(err, "http")
+	}
+	// Access times of pkg/zig proxy cache files are only saved periodically.
+	b.pkgCacheAccessSave()
+	if b.store != nil {
+		if err := b.store.Close(); err != nil {
+			return errors.Wrap(err, "Store.Close")
 		}
 	}
 	return nil
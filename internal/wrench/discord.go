@@ -2,6 +2,7 @@ package wrench
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 
@@ -157,13 +158,16 @@ func (b *Bot) discordOnMessageCreate(s *discordgo.Session, m *discordgo.MessageC
 					break
 				}
 			}
+			ctx := withAuditActor(context.Background(), m.Author.Username, AuditSourceDiscord)
 			if blocked {
+				b.audit(ctx, cmd+" (forbidden)", strings.Join(args[1:], " "))
 				_, err := s.ChannelMessageSendEmbed(m.ChannelID, &discordgo.MessageEmbed{
 					Title:       "Forbidden",
 					Description: fmt.Sprintf("You are not allowed to run this command '%s'.", m.Author.Username),
 				})
 				return err
 			}
+			b.audit(ctx, cmd, strings.Join(args[1:], " "))
 			response := handler(args[1:]...)
 			if response != nil {
 				if response.Description == "" {
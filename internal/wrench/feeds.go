@@ -0,0 +1,362 @@
+package wrench
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/hexops/wrench/internal/wrench/scripts"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// feedMaxEntries is the maximum number of entries in a feed.
+const feedMaxEntries = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary,omitempty"`
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeAtomFeed writes feed, whose entries must be ordered newest first.
+func (b *Bot) writeAtomFeed(w http.ResponseWriter, r *http.Request, feed atomFeed) error {
+	feed.ID = b.Config.ExternalURL + r.URL.RequestURI()
+	feed.Author = atomAuthor{Name: "wrench"}
+	feed.Links = append(feed.Links, atomLink{Href: feed.ID, Rel: "self", Type: "application/atom+xml"})
+	feed.Updated = atomTime(time.Unix(0, 0))
+	if len(feed.Entries) > 0 {
+		feed.Updated = feed.Entries[0].Updated
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_, _ = fmt.Fprint(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return errors.Wrap(enc.Encode(feed), "Encode")
+}
+
+// httpServeFeedJobs serves /feeds/jobs.atom, finished jobs optionally filtered by ?title= and
+// ?state= (success or error.)
+func (b *Bot) httpServeFeedJobs(w http.ResponseWriter, r *http.Request) error {
+	title := r.URL.Query().Get("title")
+	state := api.JobState(r.URL.Query().Get("state"))
+	filters := []JobsFilter{{Title: title, Limit: feedMaxEntries}}
+	switch state {
+	case api.JobStateSuccess, api.JobStateError:
+		filters = append(filters, JobsFilter{State: state})
+	case "":
+		for _, unfinished := range []api.JobState{api.JobStateReady, api.JobStateStarting, api.JobStateRunning} {
+			filters = append(filters, JobsFilter{NotState: unfinished})
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := fmt.Fprintf(w, "invalid state %q, expected success or error\n", state)
+		return err
+	}
+	jobs, err := b.store.Jobs(r.Context(), filters...)
+	if err != nil {
+		return errors.Wrap(err, "Jobs")
+	}
+
+	feed := atomFeed{Title: "wrench: finished jobs"}
+	if title != "" {
+		feed.Title += ": " + title
+	}
+	if state != "" {
+		feed.Title += " (" + string(state) + ")"
+	}
+	// Jobs are ordered by creation, but the feed should be ordered by when they finished.
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Updated.After(jobs[j].Updated) })
+	for _, job := range jobs {
+		summary := fmt.Sprintf("Job %s (%s) finished with state %s.", job.ID, job.Title, job.State)
+		if job.TargetRunnerID != "" {
+			summary = fmt.Sprintf("Job %s (%s) finished with state %s on runner %s.", job.ID, job.Title, job.State, job.TargetRunnerID)
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   fmt.Sprintf("%s: %s", job.Title, job.State),
+			ID:      fmt.Sprintf("%s/jobs/%s", b.Config.ExternalURL, job.ID),
+			Updated: atomTime(job.Updated),
+			Links: []atomLink{
+				{Href: fmt.Sprintf("%s/logs/%s", b.Config.ExternalURL, job.ID.LogID())},
+				{Href: fmt.Sprintf("%s/jobs/%s", b.Config.ExternalURL, job.ID), Rel: "related"},
+			},
+			Summary: summary,
+		})
+	}
+	return b.writeAtomFeed(w, r, feed)
+}
+
+// httpServeFeedGitHub serves /feeds/pull-requests.atom and /feeds/issues.atom, the pull requests
+// and issues created by wrench, from the GitHub API cache.
+func (b *Bot) httpServeFeedGitHub(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	pullRequests := strings.HasSuffix(r.URL.Path, "/pull-requests.atom")
+
+	type item struct {
+		title, url, state string
+		created, updated  time.Time
+	}
+	var items []item
+	for _, repo := range scripts.AllRepos {
+		if scripts.IsPrivateRepo(repo.Name) {
+			continue
+		}
+		if pullRequests {
+			prs, err := b.githubPullRequests(ctx, repo.Name)
+			if err != nil {
+				continue // not synced yet
+			}
+			for _, pr := range prs {
+				if pr.GetUser().GetLogin() != "wrench-bot" {
+					continue
+				}
+				state := pr.GetState()
+				if pr.GetMerged() || pr.MergedAt != nil {
+					state = "merged"
+				}
+				items = append(items, item{
+					title:   fmt.Sprintf("%s#%d: %s", repo.Name, pr.GetNumber(), pr.GetTitle()),
+					url:     pr.GetHTMLURL(),
+					state:   state,
+					created: pr.GetCreatedAt(),
+					updated: pr.GetUpdatedAt(),
+				})
+			}
+			continue
+		}
+		issues, err := b.githubIssues(ctx, repo.Name)
+		if err != nil {
+			continue // not synced yet
+		}
+		for _, issue := range issues {
+			if issue.GetUser().GetLogin() != "wrench-bot" || issue.IsPullRequest() {
+				continue
+			}
+			items = append(items, item{
+				title:   fmt.Sprintf("%s#%d: %s", repo.Name, issue.GetNumber(), issue.GetTitle()),
+				url:     issue.GetHTMLURL(),
+				state:   issue.GetState(),
+				created: issue.GetCreatedAt(),
+				updated: issue.GetUpdatedAt(),
+			})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].created.After(items[j].created) })
+	if len(items) > feedMaxEntries {
+		items = items[:feedMaxEntries]
+	}
+
+	feed := atomFeed{Title: "wrench: issues"}
+	if pullRequests {
+		feed.Title = "wrench: pull requests"
+	}
+	for _, item := range items {
+		entry := atomEntry{
+			Title:   item.title,
+			ID:      item.url,
+			Updated: atomTime(item.updated),
+			Links:   []atomLink{{Href: item.url}},
+			Summary: fmt.Sprintf("Created %s, %s.", item.created.UTC().Format(time.RFC3339), item.state),
+		}
+		// Link to the log of the job which created it, see httpServeRunnerJobUpdate.
+		if logID := b.feedItemLog(ctx, item.url); logID != "" {
+			entry.Links = append(entry.Links, atomLink{Href: b.Config.ExternalURL + "/logs/" + logID, Rel: "related"})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return b.writeAtomFeed(w, r, feed)
+}
+
+// feedItemLogsCacheName is the cache of which job log created each pull request or issue, by URL.
+const feedItemLogsCacheName = "feed-item-logs"
+
+// feedRecordItemLog records that the pull request or issue at url was created by the job with
+// the given log, so that feeds can link to it.
+func (b *Bot) feedRecordItemLog(ctx context.Context, url, logID string) {
+	if err := b.store.CacheSet(ctx, feedItemLogsCacheName, url, logID, nil); err != nil {
+		b.idLogf(logID, "error: CacheSet: %v", err)
+	}
+}
+
+// feedItemLog returns the ID of the job log which created the pull request or issue at url, if
+// known.
+func (b *Bot) feedItemLog(ctx context.Context, url string) string {
+	entry, err := b.store.CacheKey(ctx, feedItemLogsCacheName, url)
+	if err != nil {
+		return ""
+	}
+	return entry.Value
+}
+
+// zigVersionSeen is a Zig version observed in the upstream index.json by the pkg proxy.
+type zigVersionSeen struct {
+	Version   string
+	Date      string // from index.json, e.g. "2024-06-07"
+	Tarball   string // source tarball on this mirror
+	FirstSeen time.Time
+}
+
+var (
+	zigVersionsSeenMu sync.Mutex
+	zigVersionsSeen   []zigVersionSeen
+	zigVersionsLoaded bool
+)
+
+const zigVersionsSeenMax = 500
+
+func (b *Bot) zigVersionsSeenPath() string {
+	return filepath.Join(b.Config.WrenchDir, "zig-versions-seen.json")
+}
+
+// zigVersionsObserve records the versions in index, so that new versions appear in the
+// /feeds/zig-versions.atom feed. Versions seen for the first time ever are dated by their
+// index.json date, so the initial import does not look like a flood of new releases.
+func (b *Bot) zigVersionsObserve(index *orderedmap.OrderedMap[string, *orderedmap.OrderedMap[string, any]]) {
+	zigVersionsSeenMu.Lock()
+	defer zigVersionsSeenMu.Unlock()
+
+	initialImport := false
+	if !zigVersionsLoaded {
+		data, err := os.ReadFile(b.zigVersionsSeenPath())
+		if os.IsNotExist(err) {
+			initialImport = true
+		} else if err != nil {
+			b.logf("zig versions feed: %v", err)
+			return
+		} else if err := json.Unmarshal(data, &zigVersionsSeen); err != nil {
+			b.logf("zig versions feed: %v", err)
+			return
+		}
+		zigVersionsLoaded = true
+	}
+
+	known := make(map[string]struct{}, len(zigVersionsSeen))
+	for _, seen := range zigVersionsSeen {
+		known[seen.Version] = struct{}{}
+	}
+	changed := false
+	now := time.Now()
+	for entry := index.Oldest(); entry != nil; entry = entry.Next() {
+		version := entry.Key
+		if v, ok := entry.Value.Get("version"); ok {
+			// "master" is not a version, but has the version it currently refers to.
+			if s, ok := v.(string); ok {
+				version = s
+			}
+		}
+		if _, ok := known[version]; ok || !zigVersionRegexp.MatchString(version) {
+			continue
+		}
+		known[version] = struct{}{}
+
+		seen := zigVersionSeen{Version: version, FirstSeen: now}
+		if v, ok := entry.Value.Get("date"); ok {
+			seen.Date, _ = v.(string)
+		}
+		if v, ok := entry.Value.Get("src"); ok {
+			if src, ok := v.(map[string]any); ok {
+				seen.Tarball, _ = src["tarball"].(string)
+			}
+		}
+		if date, err := time.Parse(time.DateOnly, seen.Date); initialImport && err == nil {
+			seen.FirstSeen = date
+		}
+		zigVersionsSeen = append(zigVersionsSeen, seen)
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	sort.SliceStable(zigVersionsSeen, func(i, j int) bool {
+		return zigVersionsSeen[i].FirstSeen.After(zigVersionsSeen[j].FirstSeen)
+	})
+	if len(zigVersionsSeen) > zigVersionsSeenMax {
+		zigVersionsSeen = zigVersionsSeen[:zigVersionsSeenMax]
+	}
+	data, err := json.MarshalIndent(zigVersionsSeen, "", "  ")
+	if err == nil {
+		err = os.WriteFile(b.zigVersionsSeenPath(), data, 0o644)
+	}
+	if err != nil {
+		b.logf("zig versions feed: %v", err)
+	}
+}
+
+// zigVersionURL returns where to read about a Zig version: the commit it was built from for dev
+// versions, Mach's nominated Zig versions for Mach versions, and the release notes otherwise.
+func zigVersionURL(version string) string {
+	if _, commit, ok := strings.Cut(version, "+"); ok {
+		return "https://github.com/ziglang/zig/commit/" + commit
+	}
+	if strings.Contains(version, "-mach") {
+		return "https://machengine.org/docs/nominated-zig/"
+	}
+	return "https://ziglang.org/download/" + version + "/release-notes.html"
+}
+
+// httpServeFeedZigVersions serves /feeds/zig-versions.atom, new Zig versions observed in the
+// upstream index.json.
+func (b *Bot) httpServeFeedZigVersions(w http.ResponseWriter, r *http.Request) error {
+	// Make sure the index has been fetched recently.
+	if _, err := b.httpPkgZigIndexCached(); err != nil {
+		return err
+	}
+	zigVersionsSeenMu.Lock()
+	seen := append([]zigVersionSeen(nil), zigVersionsSeen...)
+	zigVersionsSeenMu.Unlock()
+	if len(seen) > feedMaxEntries {
+		seen = seen[:feedMaxEntries]
+	}
+
+	feed := atomFeed{Title: "Zig versions"}
+	for _, v := range seen {
+		entry := atomEntry{
+			Title:   "Zig " + v.Version,
+			ID:      b.Config.ExternalURL + "/zig/" + v.Version,
+			Updated: atomTime(v.FirstSeen),
+			Links:   []atomLink{{Href: zigVersionURL(v.Version)}},
+			Summary: fmt.Sprintf("Zig %s (dated %s) is available from this mirror.", v.Version, v.Date),
+		}
+		if v.Tarball != "" {
+			entry.Links = append(entry.Links, atomLink{Href: v.Tarball, Rel: "enclosure"})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return b.writeAtomFeed(w, r, feed)
+}
@@ -0,0 +1,80 @@
+package wrench
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func TestHttpServeFeedJobs(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{ExternalURL: "https://wrench.example.com"}}
+		for _, job := range []struct {
+			title string
+			state api.JobState
+		}{
+			{"build", api.JobStateSuccess},
+			{"build", api.JobStateError},
+			{"build", api.JobStateRunning},
+			{"test", api.JobStateSuccess},
+			{"test", api.JobStateReady},
+		} {
+			id, err := s.NewRunnerJob(ctx, api.Job{Title: job.title})
+			if err != nil {
+				t.Fatal(err)
+			}
+			created, err := s.JobByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			created.State = job.state
+			if err := s.UpsertRunnerJob(ctx, created); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tst := range []struct {
+			query string
+			want  []string
+		}{
+			{"", []string{"build: error", "build: success", "test: success"}},
+			{"state=success", []string{"build: success", "test: success"}},
+			{"state=error", []string{"build: error"}},
+			{"title=build", []string{"build: error", "build: success"}},
+			{"title=build&state=success", []string{"build: success"}},
+		} {
+			w := httptest.NewRecorder()
+			if err := b.httpServeFeedJobs(w, httptest.NewRequest("GET", "/feeds/jobs.atom?"+tst.query, nil)); err != nil {
+				t.Fatal(err)
+			}
+			var feed atomFeed
+			if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range feed.Entries {
+				got = append(got, entry.Title)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ", ") != strings.Join(tst.want, ", ") {
+				t.Errorf("%q: got entries %q, want %q", tst.query, got, tst.want)
+			}
+		}
+
+		for _, state := range []string{"running", "ready", "bogus"} {
+			w := httptest.NewRecorder()
+			if err := b.httpServeFeedJobs(w, httptest.NewRequest("GET", "/feeds/jobs.atom?state="+state, nil)); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != 400 {
+				t.Errorf("state=%s: got status %d, want 400", state, w.Code)
+			}
+		}
+	})
+}
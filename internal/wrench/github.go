@@ -66,6 +66,8 @@ func (b *Bot) sync(ctx context.Context) {
 			}
 			pullRequests = append(pullRequests, pagePRs...)
 			b.idLogf(logID, "%s/%s: progress: queried %v pull requests total (rate limit %v/%v)", org, repo, len(pullRequests), resp.Rate.Remaining, resp.Rate.Limit)
+			metricGitHubRateLimitRemaining.Set(float64(resp.Rate.Remaining))
+			metricGitHubRateLimit.Set(float64(resp.Rate.Limit))
 
 			page = resp.NextPage
 			if resp.NextPage == 0 {
@@ -97,6 +99,8 @@ func (b *Bot) sync(ctx context.Context) {
 			}
 			issues = append(issues, pageIssues...)
 			b.idLogf(logID, "%s/%s: progress: queried %v issues total (rate limit %v/%v)", org, repo, len(issues), resp.Rate.Remaining, resp.Rate.Limit)
+			metricGitHubRateLimitRemaining.Set(float64(resp.Rate.Remaining))
+			metricGitHubRateLimit.Set(float64(resp.Rate.Limit))
 
 			page = resp.NextPage
 			if resp.NextPage == 0 {
@@ -255,7 +259,6 @@ func (b *Bot) githubUpdateIssuesCache(ctx context.Context, repoPair string, issu
 	return nil
 }
 
-//nolint:unused
 func (b *Bot) githubCombinedStatusHEAD(ctx context.Context, repoPair string) (v *github.CombinedStatus, err error) {
 	cacheKey := repoPair + "-Repositories-GetCombinedStatus-HEAD"
 	entry, err := b.store.CacheKey(ctx, githubAPICacheName, cacheKey)
@@ -3,18 +3,16 @@ package wrench
 import (
 	"bytes"
 	"context"
-	"crypto/subtle"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"html"
-	htmltemplate "html/template"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -23,7 +21,6 @@ import (
 	"github.com/hexops/wrench/internal/errors"
 	"github.com/hexops/wrench/internal/wrench/api"
 	"github.com/hexops/wrench/internal/wrench/scripts"
-	"golang.org/x/crypto/acme/autocert"
 )
 
 type handlerFunc func(w http.ResponseWriter, r *http.Request) error
@@ -59,111 +56,108 @@ func (b *Bot) httpStart() error {
 		b.logf("invalid config mode=%q", b.Config.ModeType())
 	}
 
-	b.logf("http: listening on %v - %v", b.Config.Address, b.Config.ExternalURL)
-	if strings.HasSuffix(b.Config.Address, ":443") || strings.HasSuffix(b.Config.Address, ":https") {
-		// Serve HTTPS using LetsEncrypt
-		u, err := url.Parse(b.Config.ExternalURL)
-		if err != nil {
-			return fmt.Errorf("expected valid config.ExternalURL for LetsEncrypt, found: %v", b.Config.ExternalURL)
-		}
-		certManager := autocert.Manager{
-			Prompt:     autocert.AcceptTOS,
-			Cache:      autocert.DirCache(b.Config.LetsEncryptCacheDir),
-			Email:      b.Config.LetsEncryptEmail,
-			HostPolicy: autocert.HostWhitelist(u.Hostname()),
-		}
-
-		server := &http.Server{
-			Addr: ":https",
-			TLSConfig: &tls.Config{
-				GetCertificate: certManager.GetCertificate,
-			},
-			Handler: mux,
-		}
-
-		go func() {
-			err := http.ListenAndServe(":http", certManager.HTTPHandler(nil))
-			if err != nil {
-				log.Fatal("ListenAndServe:", err)
-			}
-		}()
-
-		// Key and cert are provided by LetsEncrypt
-		go func() {
-			err := server.ListenAndServeTLS("", "")
-			if err != nil {
-				log.Fatal("ListenAndServeTLS:", err)
-			}
-		}()
-		return nil
+	tlsConfig, err := b.httpTLSConfig()
+	if err != nil {
+		return err
 	}
+	b.logf("http: listening on %v - %v (TLS: %s)", b.Config.Address, b.Config.ExternalURL, b.Config.TLSMode())
+	b.httpShutdown = make(chan struct{})
+	b.httpServe(&http.Server{
+		Addr:      b.Config.Address,
+		TLSConfig: tlsConfig,
+		Handler:   mux,
+	})
+	return nil
+}
+
+// httpServe serves server in the background, with TLS if server.TLSConfig is set, until httpStop
+// shuts it down.
+func (b *Bot) httpServe(server *http.Server) {
+	b.httpServersMu.Lock()
+	b.httpServers = append(b.httpServers, server)
+	b.httpServersMu.Unlock()
 	go func() {
-		err := http.ListenAndServe(b.Config.Address, mux)
-		if err != nil {
-			log.Fatal("ListenAndServe(addr):", err)
+		var err error
+		if server.TLSConfig != nil {
+			// Key and cert are provided by TLSConfig
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("ListenAndServe(%s): %v", server.Addr, err)
 		}
 	}()
-	return nil
 }
 
 func (b *Bot) httpMuxDefault(handler func(prefix string, handle handlerFunc) http.Handler) http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-		logo := "https://raw.githubusercontent.com/hexops/media/b71e82ae9ea20c22a2eb3ab95d8ba48684635620/mach/wrench_rocket.svg"
-		_, _ = fmt.Fprintf(w, `<div style="padding: 1rem;">`)
-		_, _ = fmt.Fprintf(w, `<h1>[bot] wrench: let's fix this!</h1>`)
-		_, _ = fmt.Fprintf(w, `<div style="display: flex; align-items: center; width: 50rem;">`)
-		{
-			_, _ = fmt.Fprintf(w, `<img width="250px" align="left" src="%s">`, logo)
-			_, _ = fmt.Fprintf(w, `<div style="padding-left: 2rem;"><em><strong>Wrench</strong> here!</em> I'm the mascot of <a href="https://machengine.org">Mach engine</a>, and I help automate and maintain our projects. View my code <a href="https://github.com/hexops/wrench">on GitHub</a>!</div>`)
-		}
-		_, _ = fmt.Fprintf(w, `</div>`)
-
-		_, _ = fmt.Fprintf(w, `<h1>Where you can find me</h1>`)
-		_, _ = fmt.Fprintf(w, `<ul>`)
-		{
-			_, _ = fmt.Fprintf(w, `<li>On this website</li>`)
-			_, _ = fmt.Fprintf(w, `<li>In the <a href="https://discord.gg/XNG3NZgCqp">Mach discord</a></li>`)
-			_, _ = fmt.Fprintf(w, `<li>Making contributions <a href="https://github.com/wrench-bot">on GitHub</a> such as <a href="https://github.com/hexops/mach/pull/760">updating the version of Zig we use</a>, <a href="https://github.com/hexops/mach/pull/697">keeping our version of Dawn/WebGPU up-to-date</a>, and more.</li>`)
-		}
-		_, _ = fmt.Fprintf(w, `</ul>`)
-
-		_, _ = fmt.Fprintf(w, `<h1>Explore</h1>`)
-		_, _ = fmt.Fprintf(w, `<ul>`)
-		{
-			_, _ = fmt.Fprintf(w, `<li><a href="%s/projects">Projects overview</a></li>`, b.Config.ExternalURL)
-			_, _ = fmt.Fprintf(w, `<li><a href="%s/pull-requests">Pull requests</a></li>`, b.Config.ExternalURL)
-			_, _ = fmt.Fprintf(w, `<li><a href="%s/runners">Runners & jobs</a></li>`, b.Config.ExternalURL)
-			_, _ = fmt.Fprintf(w, `<li><a href="%s/logs">Job logs</a></li>`, b.Config.ExternalURL)
-			_, _ = fmt.Fprintf(w, `<li><a href="%s/stats">Stats</a></li>`, b.Config.ExternalURL)
-			_, _ = fmt.Fprintf(w, `<li><a href="%s/rebuild">Trigger a rebuild of wrench.machengine.org (admin-only)</a></li>`, b.Config.ExternalURL)
-		}
-		_, _ = fmt.Fprintf(w, `</ul>`)
-
-		_, _ = fmt.Fprintf(w, `<h2>Discord integration</h2>`)
-		_, _ = fmt.Fprintf(w, `<p>In the <a href="https://discord.gg/XNG3NZgCqp">Mach discord</a> join <code>#wrench</code> to see what I'm up to!</p>`)
-		_, _ = fmt.Fprintf(w, `<p>Type <code>!wrench</code> in the <code>#spam</code> channel or when direct messaging me for help.</p>`)
-		_, _ = fmt.Fprintf(w, `</div>`)
-	})
+	mux.Handle("/", handler("index", b.httpServeIndex))
+	mux.Handle("/static/", uiStaticHandler())
 	mux.Handle("/webhook/github", handler("webhook", b.httpServeWebHookGitHub))
-	mux.Handle("/rebuild", handler("rebuild", b.httpBasicAuthMiddleware(b.httpServeRebuild)))
+	mux.Handle("/rebuild", handler("rebuild", b.httpRequireRole(RoleAdmin, b.httpServeRebuild)))
+	mux.Handle("/audit", handler("audit", b.httpRequireRole(RoleAdmin, b.httpServeAudit)))
+	mux.Handle("/login", handler("login", b.httpServeLogin))
+	mux.Handle("/login/callback", handler("login-callback", b.httpServeLoginCallback))
+	mux.Handle("/logout", handler("logout", b.httpServeLogout))
+	mux.Handle("/tokens", handler("tokens", b.httpRequireRole(RoleViewer, b.httpServeTokens)))
 	mux.Handle("/logs/", handler("logs", b.httpServeLogs))
+	mux.Handle("/logs/search", handler("logs-search", b.httpServeLogsSearch))
+	mux.Handle("/logs/stream/", handler("logs-stream", b.httpServeLogsStream))
 	mux.Handle("/stats/", handler("stats", b.httpServeStats))
 	mux.Handle("/runners/", handler("runners", b.httpServeRunners))
+	mux.Handle("/jobs/", handler("jobs", b.httpServeJob))
+	mux.Handle("/badge/", handler("badge", b.httpServeBadge))
+	mux.Handle("/feeds/jobs.atom", handler("feeds", b.httpServeFeedJobs))
+	mux.Handle("/feeds/pull-requests.atom", handler("feeds", b.httpServeFeedGitHub))
+	mux.Handle("/feeds/issues.atom", handler("feeds", b.httpServeFeedGitHub))
+	mux.Handle("/metrics", b.metricsHandler())
 	mux.Handle("/pull-requests/", handler("pull-requests", b.httpServePullRequests))
 	mux.Handle("/projects/", handler("projects", b.httpServeProjects))
-	mux.Handle("/api/runner/poll", handler("api-runner-poll", botHttpAPI(b, b.httpServeRunnerPoll)))
-	mux.Handle("/api/runner/job-update", handler("api-runner-job-update", botHttpAPI(b, b.httpServeRunnerJobUpdate)))
-	mux.Handle("/api/runner/list", handler("api-runner-list", botHttpAPI(b, b.httpServeRunnerList)))
-	mux.Handle("/api/secrets/list", handler("api-secrets-list", botHttpAPI(b, b.httpServeSecretsList)))
-	mux.Handle("/api/secrets/delete", handler("api-secrets-delete", botHttpAPI(b, b.httpServeSecretsDelete)))
-	mux.Handle("/api/secrets/upsert", handler("api-secrets-upsert", botHttpAPI(b, b.httpServeSecretsUpsert)))
+	mux.Handle("/api/runner/poll", handler("api-runner-poll", b.httpRunnerMTLS(botHttpAPI(b, RoleAdmin, b.httpServeRunnerPoll))))
+	mux.Handle("/api/runner/job-update", handler("api-runner-job-update", b.httpRunnerMTLS(botHttpAPI(b, RoleAdmin, b.httpServeRunnerJobUpdate))))
+	mux.Handle("/api/runner/list", handler("api-runner-list", botHttpAPI(b, RoleViewer, b.httpServeRunnerList)))
+	mux.Handle("/api/secrets/list", handler("api-secrets-list", botHttpAPI(b, RoleAdmin, b.httpServeSecretsList)))
+	mux.Handle("/api/secrets/delete", handler("api-secrets-delete", botHttpAPI(b, RoleAdmin, b.httpServeSecretsDelete)))
+	mux.Handle("/api/secrets/upsert", handler("api-secrets-upsert", botHttpAPI(b, RoleAdmin, b.httpServeSecretsUpsert)))
+	mux.Handle("/api/stats/", handler("api-stats", b.httpServeStatsAPI))
+	mux.Handle("/api/logs/search", handler("api-logs-search", botHttpAPI(b, rolePublic, b.httpServeLogsSearchAPI)))
+	mux.Handle("/api/audit/list", handler("api-audit-list", botHttpAPI(b, RoleAdmin, b.httpServeAuditList)))
+	mux.Handle("/api/jobs/list", handler("api-jobs-list", botHttpAPI(b, rolePublic, b.httpServeJobsList)))
+	mux.Handle("/api/jobs/get", handler("api-jobs-get", botHttpAPI(b, rolePublic, b.httpServeJobsGet)))
+	mux.Handle("/api/jobs/create", handler("api-jobs-create", botHttpAPI(b, RoleOperator, b.httpServeJobsCreate)))
+	mux.Handle("/api/jobs/cancel", handler("api-jobs-cancel", botHttpAPI(b, RoleOperator, b.httpServeJobsCancel)))
+	mux.Handle("/api/jobs/logs", handler("api-jobs-logs", botHttpAPI(b, rolePublic, b.httpServeJobsLogs)))
 	return mux
 }
 
+// httpStop stops accepting new connections and waits up to Config.ShutdownTimeoutSeconds for
+// in-flight requests, such as package downloads, to finish before closing them.
 func (b *Bot) httpStop() error {
+	if b.httpShutdown != nil {
+		// Live log streams never finish on their own.
+		close(b.httpShutdown)
+	}
+	b.httpServersMu.Lock()
+	servers := b.httpServers
+	b.httpServers = nil
+	b.httpServersMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.Config.ShutdownTimeout())
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				b.logf("http: %s: shutdown timed out, closing remaining connections: %v", server.Addr, err)
+				_ = server.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
 	if b.discordSession == nil {
 		return nil
 	}
@@ -201,6 +195,7 @@ func (b *Bot) httpServeWebHookGitHub(w http.ResponseWriter, r *http.Request) err
 			b.logf("http: discordGitHubPushEvent: %v", err)
 		}
 		if ev.Repo.GetFullName() == "hexops/wrench" {
+			b.audit(withAuditActor(r.Context(), ev.GetSender().GetLogin(), AuditSourceGitHub), "rebuild", ev.GetHeadCommit().GetID())
 			return b.runRebuild()
 		}
 		return nil
@@ -325,8 +320,21 @@ func (b *Bot) discordGitHubIssuesEvent(ev *github.IssuesEvent) error {
 	})
 }
 
+// httpServeRebuild serves /rebuild, which asks for confirmation and then rebuilds and restarts
+// wrench.
 func (b *Bot) httpServeRebuild(w http.ResponseWriter, r *http.Request) error {
-	return b.runRebuild()
+	if r.Method != "POST" {
+		return b.render(w, r, "rebuild", "Rebuild", nil)
+	}
+	if b.rejectCrossOrigin(w, r) {
+		return nil
+	}
+	b.audit(withAuditActor(r.Context(), auditActorFromRequest(r), AuditSourceHTTP), "rebuild", "")
+	if err := b.runRebuild(); err != nil {
+		return err
+	}
+	http.Redirect(w, r, b.Config.ExternalURL+"/logs/restart-self", http.StatusSeeOther)
+	return nil
 }
 
 func (b *Bot) runRebuild() error {
@@ -351,6 +359,23 @@ func (b *Bot) runRebuild() error {
 	return scripts.Exec("wrench svc restart").IgnoreError()(w)
 }
 
+func (b *Bot) httpServeIndex(w http.ResponseWriter, r *http.Request) error {
+	return b.render(w, r, "index", "", nil)
+}
+
+func (b *Bot) httpServeAudit(w http.ResponseWriter, r *http.Request) error {
+	events, err := b.store.AuditEvents(r.Context(), AuditFilter{
+		Actor:  r.URL.Query().Get("actor"),
+		Action: r.URL.Query().Get("action"),
+		Limit:  500,
+	})
+	if err != nil {
+		return errors.Wrap(err, "AuditEvents")
+	}
+
+	return b.render(w, r, "audit", "Audit log", events)
+}
+
 func (b *Bot) httpServeLogs(w http.ResponseWriter, r *http.Request) error {
 	_, id := path.Split(r.URL.Path)
 	if id == "" {
@@ -358,19 +383,19 @@ func (b *Bot) httpServeLogs(w http.ResponseWriter, r *http.Request) error {
 		if err != nil {
 			return errors.Wrap(err, "LogIDs")
 		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_, _ = fmt.Fprintf(w, `<ul>`)
-		for _, id := range logIDs {
-			_, _ = fmt.Fprintf(w, `<li><a href="%s/logs/%s">%s</a></li>`, b.Config.ExternalURL, id, id)
-		}
-		_, _ = fmt.Fprintf(w, `</ul>`)
-		return nil
+		return b.render(w, r, "logs", "Logs", map[string]any{
+			"Query": LogSearchQuery{},
+			"IDs":   logIDs,
+		})
 	}
 
 	logs, err := b.store.Logs(r.Context(), id)
 	if err != nil {
 		return errors.Wrap(err, "Logs")
 	}
+	if jobID, ok := logJobID(id); ok && r.URL.Query().Get("raw") == "" {
+		return b.httpWriteJobLogs(w, r, id, jobID, logs)
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	for _, log := range logs {
 		_, _ = fmt.Fprintf(w, "%v %v\n", log.Time.UTC().Format(time.RFC3339), log.Message)
@@ -378,213 +403,77 @@ func (b *Bot) httpServeLogs(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func (b *Bot) httpServeStats(w http.ResponseWriter, r *http.Request) error {
-	_, id := path.Split(r.URL.Path)
-	if id == "" {
-		statIDs, err := b.store.StatIDs(r.Context())
-		if err != nil {
-			return errors.Wrap(err, "StatIDs")
-		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_, _ = fmt.Fprintf(w, `<ul>`)
-		for _, id := range statIDs {
-			_, _ = fmt.Fprintf(w, `<li><a href="%s/stats/%s">%s</a></li>`, b.Config.ExternalURL, id, id)
-		}
-		_, _ = fmt.Fprintf(w, `</ul>`)
-		return nil
-	}
+// httpWriteJobLogs writes a job log page which follows the log (via /logs/stream/<id>) until the
+// job finishes, showing the final job state at the bottom.
+func (b *Bot) httpWriteJobLogs(w http.ResponseWriter, r *http.Request, id string, jobID api.JobID, logs []Log) error {
+	job, err := b.store.JobByID(r.Context(), jobID)
+	if err != nil && err != ErrNotFound {
+		return errors.Wrap(err, "JobByID")
+	}
+	follow := err != ErrNotFound && !jobFinished(job.State)
+	streamURL := b.Config.ExternalURL + "/logs/stream/" + url.PathEscape(id)
+	if len(logs) > 0 {
+		// The stream only needs to send the lines written after those on the page.
+		streamURL += "?after=" + strconv.FormatInt(logs[len(logs)-1].ID, 10)
+	}
+	return b.render(w, r, "job_logs", id, map[string]any{
+		"JobID":     jobID,
+		"State":     job.State,
+		"Logs":      logs,
+		"Follow":    follow,
+		"StreamURL": streamURL,
+	})
+}
 
-	stats, err := b.store.Stats(r.Context(), id)
+func (b *Bot) httpServeLogsSearch(w http.ResponseWriter, r *http.Request) error {
+	query := LogSearchQuery{Phrase: r.URL.Query().Get("q")}
+	if r.URL.Query().Get("jobs") != "" {
+		query.IDPrefix = "job-"
+	}
+	results, err := b.store.SearchLogs(r.Context(), query)
 	if err != nil {
-		return errors.Wrap(err, "Stats")
-	}
-
-	// stats := []api.Stat{
-	// 	{
-	// 		Time:     time.Now(),
-	// 		Type:     api.StatTypeBytes,
-	// 		Value:    1 * 1024,
-	// 		Metadata: map[string]any{"zig version": "0.12.0-dev.170+750998eef"},
-	// 	},
-	// 	{
-	// 		Time:     time.Now().Add(24 * time.Hour),
-	// 		Type:     api.StatTypeBytes,
-	// 		Value:    4 * 1024 * 1024,
-	// 		Metadata: map[string]any{"zig version": "0.12.0-dev.170+750998eef.2"},
-	// 	},
-	// 	{
-	// 		Time:     time.Now().Add(48 * time.Hour),
-	// 		Type:     api.StatTypeBytes,
-	// 		Value:    3 * 1024 * 1024,
-	// 		Metadata: map[string]any{"zig version": "0.12.0-dev.170+750998eef.3"},
-	// 	},
-	// }
-
-	// var stats []api.Stat
-	// for _, d := range []time.Duration{
-	// 	1 * time.Nanosecond,
-	// 	1 * time.Millisecond,
-	// 	123 * time.Millisecond,
-	// 	1 * time.Second,
-	// 	(1 * time.Minute) + (23 * time.Second),
-	// 	(1 * time.Hour) + (2 * time.Minute) + (34 * time.Second),
-	// 	12 * time.Hour,
-	// } {
-	// 	stats = append(stats, api.Stat{
-	// 		Time:     time.Now(),
-	// 		Type:     api.StatTypeNs,
-	// 		Value:    int64(d),
-	// 		Metadata: map[string]any{"zig version": "0.12.0-dev.170+750998eef"},
-	// 	})
-	// }
-
-	unit := ""
-	var data [][]any
-	var metadata []map[string]any
-	for index, stat := range stats {
-		data = append(data, []any{
-			index,
-			stat.Value,
+		return errors.Wrap(err, "SearchLogs")
+	}
+
+	type searchResult struct {
+		api.LogSearchResult
+		Parts []snippetPart
+	}
+	var view []searchResult
+	for _, result := range results {
+		view = append(view, searchResult{
+			LogSearchResult: result,
+			Parts:           highlightSnippet(result.Snippet, result.Matches),
 		})
-		meta := stat.Metadata
-		meta["label"] = fmt.Sprintf("%v", meta)
-		if v, ok := meta["zig version"]; ok {
-			meta["label"] = v.(string)[strings.LastIndex(v.(string), "."):]
-		}
-		unit = stat.Type
-		meta["time"] = stat.Time.UTC().String()
-		metadata = append(metadata, meta)
-	}
-
-	t, err := htmltemplate.New("T").Parse(`
-<!DOCTYPE html>
-<html>
-<head>
-</head>
-<body>
-	<div id="div_g" style="width:100%; height:500px;"></div>
-	<p>Select a region to zoom in. Refresh the page to zoom out. Shift+click to pan.</p>
-	<div id="gutter"></div>
-
-	<link rel="stylesheet" href="https://dygraphs.com/dist/dygraph.css">
-	<script src="https://dygraphs.com/dist/dygraph.js"></script>
-
-<style>
-.dygraph-axis-label-x {
-	-webkit-transform: rotate(-30deg); 
-	-moz-transform: rotate(-30deg);
-	position: relative;
-	top: 1rem;
+	}
+	return b.render(w, r, "logs_search", "Search logs", map[string]any{
+		"Query":   query,
+		"Results": view,
+	})
 }
-#div_g {
-	margin-bottom: 3rem;
+
+// snippetPart is a part of a log search snippet, which either matches the search phrase or not.
+type snippetPart struct {
+	Text  string
+	Match bool
 }
-</style>
-<script>
-var data = {{.Data}};
-var metadata = {{.Metadata}};
-var unit = {{.Unit}};
-
-document.addEventListener("DOMContentLoaded", function(event) { 
-	function oneDecimal(v) {
-		return Math.round(v * 10) / 10;
-	}
-	function formatNanoseconds(ns) {
-		var ms = 1e+6;
-		var s = ms * 1000.0;
-		var m = s * 60.0;
-		var h = m * 60.0;
-		if ((ns/ms) < 1.0) {
-			return ns + 'ns'
-		} else if ((ns/s) < 1.0) {
-			return Math.round(ns/ms) + 'ms'
-		} else if ((ns/m) < 1.0) {
-			return oneDecimal(ns/s) + 's'
-		} else if ((ns/h) < 1.0) {
-			return Math.trunc(ns/m) + 'm' + Math.round((ns%m)/s) + 's'
-		} else {
-			return Math.trunc(ns/h) + 'h' + Math.trunc((ns%h)/m) + 'm' + Math.round(((ns%h)%m)/s) + 's'
-		}
-	}
-	function formatValue(v) {
-		if (unit == 'ns') {
-			return formatNanoseconds(v);
-		} else if (unit == 'b') {
-			var kib = 1024.0;
-			var mib = kib * 1024;
-			var gib = mib * 1024;
-			var tib = gib * 1024;
-			if (v < kib) {
-				return oneDecimal(v) + 'b'
-			}
-			if (v < mib) {
-				return oneDecimal(v / kib) + 'KiB'
-			}
-			if (v < gib) {
-				return oneDecimal(v / mib) + 'MiB'
-			}
-			if (v < tib) {
-				return oneDecimal(v / gib) + 'GiB'
-			}
-			if (v < (tib * 1024.0)) {
-				return oneDecimal(v / tib) + 'TiB'
-			}
-			return v + 'b'
-		} else {
-			return v + '';
+
+// highlightSnippet splits snippet into parts matching the given [start, end) byte ranges, and the
+// parts in between.
+func highlightSnippet(snippet string, matches [][2]int) []snippetPart {
+	var parts []snippetPart
+	last := 0
+	for _, m := range matches {
+		if m[0] > last {
+			parts = append(parts, snippetPart{Text: snippet[last:m[0]]})
 		}
+		parts = append(parts, snippetPart{Text: snippet[m[0]:m[1]], Match: true})
+		last = m[1]
 	}
-	new Dygraph(
-		document.getElementById("div_g"),
-		data,
-		{
-			labels: ['Date','Value'],
-			axes: {
-				x: {
-					axisLabelFormatter: function(index, gran, opts) {
-						return metadata[Math.round(index)]["label"];
-					},
-					pixelsPerLabel: 50,
-					axisLabelWidth: 100,
-				},
-				y: {
-					axisLabelFormatter: function(value, gran, opts) {
-						return formatValue(value);
-					},
-					valueFormatter: function(value, opts, seriesName, dygraph, row, col) {
-						return formatValue(value);
-					},
-				},
-			},
-			highlightCallback: function(e, x, pts, row) {
-				var gutter = document.getElementById('gutter');
-				gutter.innerHTML = "<b>Data point:</b><br>"
-				gutter.innerHTML += formatValue(data[row][1]) + "<br>";
-				for (const key in metadata[row]) {
-					gutter.innerHTML += key + ': ' + metadata[row][key] + "<br>";
-				}
-			},
-		},
-	);
-});
-</script>
-</body>
-</html>
-`)
-	if err != nil {
-		return errors.Wrap(err, "Template.Parse")
+	if last < len(snippet) {
+		parts = append(parts, snippetPart{Text: snippet[last:]})
 	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	err = t.ExecuteTemplate(w, "T", map[string]any{
-		"Data":     data,
-		"Metadata": metadata,
-		"Unit":     unit,
-	})
-	if err != nil {
-		return errors.Wrap(err, "ExecuteTemplate")
-	}
-	return nil
+	return parts
 }
 
 func (b *Bot) httpServeRunners(w http.ResponseWriter, r *http.Request) error {
@@ -605,21 +494,7 @@ func (b *Bot) httpServeRunners(w http.ResponseWriter, r *http.Request) error {
 			return errors.New("no such runner")
 		}
 
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_, _ = fmt.Fprintf(w, "<h2>Runner %s:%s</h2>", runner.ID, runner.Arch)
-		_, _ = fmt.Fprintf(w, `<ul>`)
-		for _, pair := range [][2]string{
-			{"Registered", runner.RegisteredAt.UTC().Format(time.RFC3339)},
-			{"Last seen", humanizeTimeRecent(runner.LastSeenAt)},
-			{"Wrench version", runner.Env.WrenchVersion},
-			{"Wrench commit title", runner.Env.WrenchCommitTitle},
-			{"Wrench date", runner.Env.WrenchDate},
-			{"Wrench Go version", runner.Env.WrenchGoVersion},
-		} {
-			_, _ = fmt.Fprintf(w, `<li><strong>%s</strong>: %s</li>`, pair[0], pair[1])
-		}
-		_, _ = fmt.Fprintf(w, `</ul>`)
-		return nil
+		return b.render(w, r, "runner", "Runner "+runner.ID, runner)
 	}
 
 	runners, err := b.store.Runners(r.Context())
@@ -643,73 +518,38 @@ func (b *Bot) httpServeRunners(w http.ResponseWriter, r *http.Request) error {
 		return errors.Wrap(err, "Jobs(1)")
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-	_, _ = fmt.Fprintf(w, "<h2>Runners</h2>")
-	{
-		var values [][]string
-		for _, runner := range runners {
-			wrenchDate := runner.Env.WrenchDate
-			wrenchDateTime, err := time.Parse(time.RFC3339, runner.Env.WrenchDate)
-			if err == nil {
-				wrenchDate = humanize.Time(wrenchDateTime)
-			}
-			values = append(values, []string{
-				fmt.Sprintf(`<a href="/runners/%s">%s</a>`, runner.ID, runner.ID),
-				runner.Arch,
-				runner.RegisteredAt.UTC().Format(time.RFC3339),
-				humanizeTimeRecent(runner.LastSeenAt),
-				runner.Env.WrenchVersion,
-				wrenchDate,
-			})
-		}
-		tableStyle(w)
-		table(w, []string{"id", "arch", "registered", "last seen", "version", "built"}, values)
-	}
-
-	_, _ = fmt.Fprintf(w, "<h2>Jobs</h2>")
-	{
-		var values [][]string
-		for _, job := range jobs {
-			values = append(values, []string{
-				fmt.Sprintf(`<a href="%v/logs/job-%v">%v</a>`, b.Config.ExternalURL, job.ID, job.ID),
-				string(job.State),
-				job.Title,
-				job.TargetRunnerID,
-				job.TargetRunnerArch,
-				humanizeTimeMaybeZero(job.ScheduledStart),
-				humanize.Time(job.Updated),
-				job.Created.UTC().Format(time.RFC3339),
-			})
-		}
-		tableStyle(w)
-		table(w, []string{"id", "state", "title", "target runner ID", "target runner arch", "scheduled start", "last updated", "created"}, values)
-	}
-	_, _ = fmt.Fprintf(w, "<h2>Finished jobs</h2>")
-	{
-		var values [][]string
-		for _, job := range finishedJobs {
-			values = append(values, []string{
-				fmt.Sprintf(`<a href="%v/logs/job-%v">%v</a>`, b.Config.ExternalURL, job.ID, job.ID),
-				string(job.State),
-				job.Title,
-				job.TargetRunnerID,
-				job.TargetRunnerArch,
-				humanizeTimeMaybeZero(job.ScheduledStart),
-				humanize.Time(job.Updated),
-				job.Created.UTC().Format(time.RFC3339),
-			})
+	type runnerRow struct {
+		api.Runner
+		Built string
+	}
+	var rows []runnerRow
+	for _, runner := range runners {
+		built := runner.Env.WrenchDate
+		if t, err := time.Parse(time.RFC3339, runner.Env.WrenchDate); err == nil {
+			built = humanize.Time(t)
 		}
-		tableStyle(w)
-		table(w, []string{"id", "state", "title", "target runner ID", "target runner arch", "scheduled start", "last updated", "created"}, values)
+		rows = append(rows, runnerRow{Runner: runner, Built: built})
 	}
-	return nil
+	return b.render(w, r, "runners", "Runners & jobs", map[string]any{
+		"Runners":      rows,
+		"Jobs":         jobs,
+		"FinishedJobs": finishedJobs,
+	})
 }
 
 func (b *Bot) httpServePullRequests(w http.ResponseWriter, r *http.Request) error {
-	prList := func(label, state string, draft, filterDraft bool) error {
-		_, _ = fmt.Fprintf(w, "<h2>Pull requests (%s)</h2>", label)
-		var values [][]string
+	type pullRequest struct {
+		Repo, RepoShortName string
+		URL, Title          string
+		AuthorURL, Author   string
+		Created             time.Time
+	}
+	type section struct {
+		Label        string
+		PullRequests []pullRequest
+	}
+	prList := func(label, state string, draft, filterDraft bool) (section, error) {
+		list := section{Label: label}
 		renderPRs := func(wrench bool) error {
 			for _, repo := range scripts.AllRepos {
 				repoPair := repo.Name
@@ -727,38 +567,44 @@ func (b *Bot) httpServePullRequests(w http.ResponseWriter, r *http.Request) erro
 					if filterDraft && draft != *pr.Draft {
 						continue
 					}
-					values = append(values, []string{
-						fmt.Sprintf(`<a href="https://github.com/%s/pulls">%s</a>`, repoPair, strings.TrimPrefix(repoPair, "hexops/")),
-						fmt.Sprintf(`<a href="%s">%s</a>`, *pr.HTMLURL, html.EscapeString(*pr.Title)),
-						fmt.Sprintf(`<a href="%s">%s</a>`, *pr.User.HTMLURL, html.EscapeString(*pr.User.Login)),
-						humanizeTimeRecent(*pr.CreatedAt),
+					list.PullRequests = append(list.PullRequests, pullRequest{
+						Repo:          repoPair,
+						RepoShortName: strings.TrimPrefix(repoPair, "hexops/"),
+						URL:           *pr.HTMLURL,
+						Title:         *pr.Title,
+						AuthorURL:     *pr.User.HTMLURL,
+						Author:        *pr.User.Login,
+						Created:       *pr.CreatedAt,
 					})
 				}
 			}
 			return nil
 		}
 		if err := renderPRs(false); err != nil {
-			return err
+			return list, err
 		}
 		if err := renderPRs(true); err != nil {
+			return list, err
+		}
+		return list, nil
+	}
+
+	var sections []section
+	for _, s := range []struct {
+		label, state       string
+		draft, filterDraft bool
+	}{
+		{"open", "open", false, true},
+		{"draft", "open", true, true},
+		{"closed", "closed", true, false},
+	} {
+		list, err := prList(s.label, s.state, s.draft, s.filterDraft)
+		if err != nil {
 			return err
 		}
-		tableStyle(w)
-		table(w, []string{"repository", "title", "author", "created"}, values)
-		return nil
+		sections = append(sections, list)
 	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := prList("open", "open", false, true); err != nil {
-		return err
-	}
-	if err := prList("draft", "open", true, true); err != nil {
-		return err
-	}
-	if err := prList("closed", "closed", true, false); err != nil {
-		return err
-	}
-	return nil
+	return b.render(w, r, "pull_requests", "Pull requests", sections)
 }
 
 func (b *Bot) httpServeProjects(w http.ResponseWriter, r *http.Request) error {
@@ -780,50 +626,22 @@ func (b *Bot) httpServeProjects(w http.ResponseWriter, r *http.Request) error {
 		return count, nil
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-	_, _ = fmt.Fprintf(w, `
-<style>
-.row {
-	display: flex;
-	justify-content: center;
-	flex-wrap: wrap;
-}
-.row>span {
-	font-weight: bold;
-	font-size: 20px;
-}
-.row>div {
-	display: flex;
-	flex-direction: column;
-	justify-content: space-around;
-	align-items: center;
-	width: 7rem;
-	height: 7rem;
-	outline: 1px solid black;
-}
-.row>div>span {
-	padding: .25rem;
-	font-weight: bold;
-	word-break: break-word;
-}
-.row>div>ul {
-	margin: 0;
-	padding: 0;
-}
-</style>
-`)
-
-	detail := r.URL.Query().Has("detail")
-	if !detail {
-		_, _ = fmt.Fprintf(w, `<div class="row">`)
+	type project struct {
+		Repo, ShortName     string
+		Long, Detail        bool
+		Status, Symbol      string
+		HeadSHA             string
+		Open, Draft, Closed int
 	}
-	for _, category := range scripts.AllReposByCategory {
-		if detail {
-			_, _ = fmt.Fprintf(w, `<div class="row"><span>%s</span></div>`, category.Name)
-			_, _ = fmt.Fprintf(w, `<div class="row">`)
-		}
-		for _, repo := range category.Repos {
+	type category struct {
+		Name     string
+		Projects []project
+	}
+	detail := r.URL.Query().Has("detail")
+	var categories []category
+	for _, c := range scripts.AllReposByCategory {
+		cat := category{Name: c.Name}
+		for _, repo := range c.Repos {
 			repoPair := repo.Name
 			if scripts.IsPrivateRepo(repoPair) {
 				continue
@@ -842,79 +660,40 @@ func (b *Bot) httpServeProjects(w http.ResponseWriter, r *http.Request) error {
 			}
 
 			// Determine CI status
-			checkRuns, err := b.githubCheckRunsHEAD(r.Context(), repoPair)
+			ciStatus, headSHA, err := b.repoCIStatus(r.Context(), repo, false)
 			if err != nil {
 				return err
 			}
-			completed := 0
-			pending := 0
-			failure := false
-			headSHA := ""
-			for _, run := range checkRuns.CheckRuns {
-				headSHA = *run.HeadSHA
-				if *run.Status == "completed" {
-					completed++
-				}
-				if *run.Status == "pending" || *run.Status == "in_progress" {
-					pending++
-				}
-				if run.Conclusion != nil && *run.Conclusion == "failure" {
-					failure = true
-				}
-			}
-
-			reportNoCIAsGreen := repo.CI == scripts.None || repoPair == "hexops/machengine.org"
-			statusColor := "#fff"
-			status := "↻"
-			if pending > 0 {
-				status = "↻"
-			} else if failure {
-				status = "✖️"
-				statusColor = "#ff5757"
-			} else if *checkRuns.Total == 0 && !reportNoCIAsGreen {
-				status = "∅"
-				statusColor = "#d2d2d2"
-			} else if completed > 0 || reportNoCIAsGreen {
-				statusColor = "#0d0"
-				status = "✓"
+			status, symbol := "pending", "↻"
+			switch ciStatus {
+			case ciStatusFailing:
+				status, symbol = "failing", "✖️"
+			case ciStatusNone:
+				status, symbol = "none", "∅"
+			case ciStatusPassing:
+				status, symbol = "passing", "✓"
 			}
 
 			repoShortName := strings.TrimPrefix(repoPair, "hexops/")
-			fontSize := "14px"
-			if len(repoShortName) >= len("mach-freetype") {
-				fontSize = "12px"
-			}
-
-			displayHidden := `display: none;`
-			if detail {
-				displayHidden = ""
-			}
-			_, _ = fmt.Fprintf(w, `<div style="background: %s;">
-	<span style="font-size: `+fontSize+`;">%s %s</span>
-	<ul style="%s">
-		<li>%s open</li>
-		<li>%s drafts</li>
-		<li>%s closed</li>
-	</ul>
-</div>`,
-				statusColor,
-				fmt.Sprintf(`<a href="https://github.com/%s">%s</a>`, repoPair, repoShortName),
-				fmt.Sprintf(`<a href="https://github.com/%s/commit/%s">%v</a>`, repoPair, headSHA, status),
-				displayHidden,
-				fmt.Sprintf(`<a href="https://github.com/%s/pulls">%v</a>`, repoPair, numOpenPRs),
-				fmt.Sprintf(`<a href="https://github.com/%s/pulls">%v</a>`, repoPair, numDraftPRs),
-				fmt.Sprintf(`<a href="https://github.com/%s/pulls">%v</a>`, repoPair, numClosedPRs),
-			)
-
-		}
-		if detail {
-			_, _ = fmt.Fprintf(w, `</div>`)
+			cat.Projects = append(cat.Projects, project{
+				Repo:      repoPair,
+				ShortName: repoShortName,
+				Long:      len(repoShortName) >= len("mach-freetype"),
+				Detail:    detail,
+				Status:    status,
+				Symbol:    symbol,
+				HeadSHA:   headSHA,
+				Open:      numOpenPRs,
+				Draft:     numDraftPRs,
+				Closed:    numClosedPRs,
+			})
 		}
+		categories = append(categories, cat)
 	}
-	if !detail {
-		_, _ = fmt.Fprintf(w, `</div>`)
-	}
-	return nil
+	return b.render(w, r, "projects", "Projects", map[string]any{
+		"Detail":     detail,
+		"Categories": categories,
+	})
 }
 
 func humanizeTimeMaybeZero(t time.Time) string {
@@ -931,65 +710,12 @@ func humanizeTimeRecent(t time.Time) string {
 	return humanize.Time(t)
 }
 
-func tableStyle(w io.Writer) {
-	_, _ = fmt.Fprintf(w, `
-<style>
-table {
-    border: solid 1px #DDEEEE;
-    border-collapse: collapse;
-    border-spacing: 0;
-}
-table thead th {
-    border: solid 1px #DDEEEE;
-    background-color: #DDEFEF;
-    padding: 0.75rem;
-    text-align: left;
-}
-table tbody td {
-    border: solid 1px #DDEEEE;
-    padding: 0.75rem;
-}
-</style>`)
-}
-
-func table(w io.Writer, rows []string, values [][]string) {
-	_, _ = fmt.Fprintf(w, `<table>`)
-	_, _ = fmt.Fprintf(w, `<thead><tr>`)
-	for _, label := range rows {
-		_, _ = fmt.Fprintf(w, "<th>%s</th>", label)
-	}
-	_, _ = fmt.Fprintf(w, `</tr></thead>`)
-	_, _ = fmt.Fprintf(w, `<tbody>`)
-	for _, row := range values {
-		_, _ = fmt.Fprintf(w, `<tr>`)
-		for _, value := range row {
-			_, _ = fmt.Fprintf(w, `<td>%s</td>`, value)
-		}
-		_, _ = fmt.Fprintf(w, `</tr>`)
-	}
-	_, _ = fmt.Fprintf(w, `</tbody></table>`)
-}
+// rolePublic is given to botHttpAPI for endpoints which anyone may use. Like the web UI, the API
+// lets anyone read logs and jobs, as job logs are linked from e.g. public pull requests.
+const rolePublic Role = ""
 
-func (b *Bot) httpBasicAuthMiddleware(handler handlerFunc) handlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) error {
-		if b.Config.Secret == "" {
-			return errors.New("API not enabled; Config.Secret not configured.")
-		}
-
-		_, pass, ok := r.BasicAuth()
-		if !ok || subtle.ConstantTimeCompare([]byte(pass), []byte(b.Config.Secret)) != 1 {
-			w.Header().Set("WWW-Authenticate", `Basic realm="wrench"`)
-			w.WriteHeader(401)
-			_, err := w.Write([]byte("Unauthorised.\n"))
-			return err
-		}
-
-		return handler(w, r)
-	}
-}
-
-func botHttpAPI[Request any, Response any](b *Bot, handler func(context.Context, *Request) (*Response, error)) handlerFunc {
-	return b.httpBasicAuthMiddleware(func(w http.ResponseWriter, r *http.Request) error {
+func botHttpAPI[Request any, Response any](b *Bot, role Role, handler func(context.Context, *Request) (*Response, error)) handlerFunc {
+	serve := func(w http.ResponseWriter, r *http.Request) error {
 		if r.Method != "POST" {
 			return errors.New("POST is required for this endpoint")
 		}
@@ -1001,15 +727,23 @@ func botHttpAPI[Request any, Response any](b *Bot, handler func(context.Context,
 				return errors.Wrap(err, "Decode")
 			}
 		}
-		resp, err := handler(r.Context(), &req)
+		ctx := withAuditActor(r.Context(), auditActorFromRequest(r), AuditSourceAPI)
+		resp, err := handler(ctx, &req)
 		if err != nil {
 			return err
 		}
 		return errors.Wrap(json.NewEncoder(w).Encode(resp), "Encode")
-	})
+	}
+	if role == rolePublic {
+		return serve
+	}
+	return b.httpRequireRole(role, serve)
 }
 
 func (b *Bot) httpServeRunnerPoll(ctx context.Context, r *api.RunnerPollRequest) (*api.RunnerPollResponse, error) {
+	if err := checkRunnerCert(ctx, r.ID); err != nil {
+		return nil, err
+	}
 	err := b.store.RunnerSeen(ctx, r.ID, r.Arch, r.Env)
 	if err != nil {
 		return nil, errors.Wrap(err, "RunnerSeen")
@@ -1098,6 +832,7 @@ jobSearch:
 				return nil, errors.Wrap(err, "UpsertRunnerJob(1)")
 			}
 			b.idLogf(job.ID.LogID(), "job assigned to runner: %v:%v", r.ID, r.Arch)
+			b.metricsObserveJobState(ctx, job)
 			return &api.RunnerPollResponse{Start: &api.RunnerJobStart{
 				ID:                 job.ID,
 				Title:              job.Title,
@@ -1121,6 +856,9 @@ func stringIf(s string, conditional bool) string {
 }
 
 func (b *Bot) httpServeRunnerJobUpdate(ctx context.Context, r *api.RunnerJobUpdateRequest) (*api.RunnerJobUpdateResponse, error) {
+	if err := checkRunnerCert(ctx, r.ID); err != nil {
+		return nil, err
+	}
 	// Update job state.
 	job, err := b.store.JobByID(ctx, r.Job.ID)
 	if err != nil {
@@ -1129,11 +867,20 @@ func (b *Bot) httpServeRunnerJobUpdate(ctx context.Context, r *api.RunnerJobUpda
 		}
 		return nil, errors.Wrap(err, "JobsByID")
 	}
+	// A runner may only update the jobs it was assigned by httpServeRunnerPoll, otherwise one
+	// runner (or a stolen runner certificate) could finish or log to any other runner's job.
+	if job.State == api.JobStateReady || job.TargetRunnerID != r.ID {
+		return nil, fmt.Errorf("job %s is not assigned to runner %q", job.ID, r.ID)
+	}
+	previousState := job.State
 	job.State = r.Job.State
 	err = b.store.UpsertRunnerJob(ctx, job)
 	if err != nil {
 		return nil, errors.Wrap(err, "UpsertRunnerJob(0)")
 	}
+	if job.State != previousState {
+		b.metricsObserveJobState(ctx, job)
+	}
 
 	if r.Job.State == api.JobStateSuccess && len(r.Job.Response.PushedRepos) > 0 {
 		// Ensure pull requests exist.
@@ -1178,6 +925,7 @@ func (b *Bot) httpServeRunnerJobUpdate(ctx context.Context, r *api.RunnerJobUpda
 				return nil, errors.Wrap(err, "githubUpsertPullRequest")
 			}
 			b.idLogf(r.Job.ID.LogID(), "pull request: %s", *pr.HTMLURL)
+			b.feedRecordItemLog(ctx, *pr.HTMLURL, r.Job.ID.LogID())
 			_ = isNew
 			// if isNew {
 			// 	b.discord("I sent a PR just now: %s", *pr.HTMLURL)
@@ -1204,6 +952,7 @@ func (b *Bot) httpServeRunnerJobUpdate(ctx context.Context, r *api.RunnerJobUpda
 				return nil, errors.Wrap(err, "githubUpsertIssue")
 			}
 			b.idLogf(r.Job.ID.LogID(), "issue: %s", *issue.HTMLURL)
+			b.feedRecordItemLog(ctx, *issue.HTMLURL, r.Job.ID.LogID())
 			_ = isNew
 			// if isNew {
 			// 	b.discord("I created an issue just now: %s", *issue.HTMLURL)
@@ -1212,6 +961,7 @@ func (b *Bot) httpServeRunnerJobUpdate(ctx context.Context, r *api.RunnerJobUpda
 	}
 
 	if r.Job.State == api.JobStateSuccess && len(r.Job.Response.Stats) > 0 {
+		var recorded []api.Stat
 		for _, stat := range r.Job.Response.Stats {
 			if stat.Time.IsZero() {
 				stat.Time = time.Now()
@@ -1220,8 +970,11 @@ func (b *Bot) httpServeRunnerJobUpdate(ctx context.Context, r *api.RunnerJobUpda
 			stat.Metadata["arch"] = r.Arch
 			if err := b.store.RecordStat(ctx, stat); err != nil {
 				b.idLogf(r.Job.ID.LogID(), "error recording stat: %v", err)
+				continue
 			}
+			recorded = append(recorded, stat)
 		}
+		go b.checkRegressions(context.Background(), recorded)
 	}
 
 	// Log job messages.
@@ -1259,13 +1012,9 @@ func (b *Bot) httpServeRunnerList(ctx context.Context, r *api.RunnerListRequest)
 }
 
 func (b *Bot) httpServeSecretsList(ctx context.Context, r *api.SecretsListRequest) (*api.SecretsListResponse, error) {
-	secrets, err := b.store.Secrets(ctx)
+	ids, err := b.store.SecretIDs(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "Secrets")
-	}
-	var ids []string
-	for _, secret := range secrets {
-		ids = append(ids, secret.ID)
+		return nil, errors.Wrap(err, "SecretIDs")
 	}
 	return &api.SecretsListResponse{IDs: ids}, nil
 }
@@ -1275,6 +1024,7 @@ func (b *Bot) httpServeSecretsDelete(ctx context.Context, r *api.SecretsDeleteRe
 	if err != nil {
 		return nil, errors.Wrap(err, "DeleteSecret")
 	}
+	b.audit(ctx, "secret-delete", r.ID)
 	return &api.SecretsDeleteResponse{}, nil
 }
 
@@ -1283,5 +1033,30 @@ func (b *Bot) httpServeSecretsUpsert(ctx context.Context, r *api.SecretsUpsertRe
 	if err != nil {
 		return nil, errors.Wrap(err, "UpsertSecret")
 	}
+	b.audit(ctx, "secret-upsert", r.ID)
 	return &api.SecretsUpsertResponse{}, nil
 }
+
+func (b *Bot) httpServeLogsSearchAPI(ctx context.Context, r *api.LogsSearchRequest) (*api.LogsSearchResponse, error) {
+	results, err := b.store.SearchLogs(ctx, LogSearchQuery{
+		Phrase:   r.Phrase,
+		IDPrefix: r.IDPrefix,
+		Limit:    r.Limit,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "SearchLogs")
+	}
+	return &api.LogsSearchResponse{Results: results}, nil
+}
+
+func (b *Bot) httpServeAuditList(ctx context.Context, r *api.AuditListRequest) (*api.AuditListResponse, error) {
+	events, err := b.store.AuditEvents(ctx, AuditFilter{
+		Actor:  r.Actor,
+		Action: r.Action,
+		Limit:  r.Limit,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "AuditEvents")
+	}
+	return &api.AuditListResponse{Events: events}, nil
+}
@@ -0,0 +1,250 @@
+package wrench
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/hexops/wrench/internal/wrench/scripts"
+)
+
+// Badge colors, matching shields.io.
+const (
+	badgeGreen  = "#4c1"
+	badgeRed    = "#e05d44"
+	badgeBlue   = "#007ec6"
+	badgeGrey   = "#9f9f9f"
+	badgeYellow = "#dfb317"
+)
+
+// httpServeBadge serves SVG status badges for use in READMEs:
+//
+//   - /badge/job/<scheduled job id>.svg, from the state of the latest job.
+//   - /badge/project/<repo>.svg, from the cached CI status of the repository's HEAD.
+//
+// The label may be overridden with ?label=
+func (b *Bot) httpServeBadge(w http.ResponseWriter, r *http.Request) error {
+	kind, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/badge/"), "/")
+	name, ok := strings.CutSuffix(name, ".svg")
+	if !ok || name == "" {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	var label, message, color string
+	switch kind {
+	case "job":
+		var schedule *ScheduledJob
+		for _, scheduled := range b.schedule {
+			if string(scheduled.Job.ID) == name {
+				schedule = &scheduled
+				break
+			}
+		}
+		if schedule == nil {
+			http.NotFound(w, r)
+			return nil
+		}
+		label = name
+		message, color = b.badgeJobStatus(r.Context(), *schedule)
+	case "project":
+		repoPair := name
+		if !strings.Contains(repoPair, "/") {
+			repoPair = "hexops/" + repoPair
+		}
+		var repo *scripts.Repo
+		for _, candidate := range scripts.AllRepos {
+			if candidate.Name == repoPair && !scripts.IsPrivateRepo(repoPair) {
+				repo = &candidate
+				break
+			}
+		}
+		if repo == nil {
+			http.NotFound(w, r)
+			return nil
+		}
+		label = strings.TrimPrefix(repoPair, "hexops/")
+		status, _, err := b.repoCIStatus(r.Context(), *repo, true)
+		if err != nil {
+			b.logf("http: badge: %s: %v", repoPair, err)
+			message, color = "unknown", badgeGrey
+		} else {
+			message, color = status.badge()
+		}
+	default:
+		http.NotFound(w, r)
+		return nil
+	}
+	if v := r.URL.Query().Get("label"); v != "" {
+		label = v
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	// Badges are mostly fetched through caching proxies (e.g. GitHub's camo), which should
+	// refresh them reasonably often.
+	w.Header().Set("Cache-Control", "public, max-age=300, s-maxage=300")
+	_, err := w.Write(renderBadge(label, message, color))
+	return err
+}
+
+func (b *Bot) badgeJobStatus(ctx context.Context, schedule ScheduledJob) (message, color string) {
+	var filters []JobsFilter
+	if schedule.Job.TargetRunnerID != "" && schedule.Job.TargetRunnerID != "*" {
+		filters = append(filters, JobsFilter{TargetRunnerID: schedule.Job.TargetRunnerID})
+	}
+	// Jobs which are scheduled to run later are ignored, so that the badge reflects the last run.
+	jobs, err := b.store.Jobs(ctx, append([]JobsFilter{{Title: schedule.Job.Title}}, filters...)...)
+	if err != nil {
+		b.logf("http: badge: %s: %v", schedule.Job.ID, errors.Wrap(err, "Jobs"))
+		return "unknown", badgeGrey
+	}
+	var last *api.Job
+	for i, job := range jobs {
+		if job.State == api.JobStateReady {
+			continue
+		}
+		if last == nil || job.Created.After(last.Created) {
+			last = &jobs[i]
+		}
+	}
+	if last == nil {
+		return "not run yet", badgeGrey
+	}
+	switch last.State {
+	case api.JobStateSuccess:
+		return "passing", badgeGreen
+	case api.JobStateError:
+		return "failing", badgeRed
+	default:
+		return "running", badgeBlue
+	}
+}
+
+// ciStatus is the CI status of a repository's HEAD commit.
+type ciStatus int
+
+const (
+	ciStatusPending ciStatus = iota
+	ciStatusFailing
+	ciStatusNone
+	ciStatusPassing
+)
+
+func (s ciStatus) badge() (message, color string) {
+	switch s {
+	case ciStatusFailing:
+		return "failing", badgeRed
+	case ciStatusNone:
+		return "no CI", badgeGrey
+	case ciStatusPassing:
+		return "passing", badgeGreen
+	default:
+		return "pending", badgeYellow
+	}
+}
+
+// repoCIStatus returns the CI status of the repository's HEAD commit, from the check runs cached
+// by the github sync, along with the HEAD commit SHA if known.
+//
+// With commitStatuses, the combined commit status is taken into account too, as not all CI
+// reports check runs (e.g. external services only report commit statuses.) The /projects page
+// does not, and only considers check runs.
+func (b *Bot) repoCIStatus(ctx context.Context, repo scripts.Repo, commitStatuses bool) (ciStatus, string, error) {
+	checkRuns, err := b.githubCheckRunsHEAD(ctx, repo.Name)
+	if err != nil {
+		return 0, "", err
+	}
+	total := checkRuns.GetTotal()
+	completed := 0
+	pending := 0
+	failure := false
+	headSHA := ""
+	for _, run := range checkRuns.CheckRuns {
+		headSHA = *run.HeadSHA
+		if *run.Status == "completed" {
+			completed++
+		}
+		if *run.Status == "pending" || *run.Status == "in_progress" {
+			pending++
+		}
+		if run.Conclusion != nil && *run.Conclusion == "failure" {
+			failure = true
+		}
+	}
+
+	if commitStatuses {
+		if combined, err := b.githubCombinedStatusHEAD(ctx, repo.Name); err == nil && combined.GetTotalCount() > 0 {
+			total += combined.GetTotalCount()
+			switch combined.GetState() {
+			case "failure", "error":
+				failure = true
+			case "pending":
+				pending++
+			case "success":
+				completed++
+			}
+			if headSHA == "" {
+				headSHA = combined.GetSHA()
+			}
+		}
+	}
+
+	reportNoCIAsGreen := repo.CI == scripts.None || repo.Name == "hexops/machengine.org"
+	switch {
+	case pending > 0:
+		return ciStatusPending, headSHA, nil
+	case failure:
+		return ciStatusFailing, headSHA, nil
+	case total == 0 && !reportNoCIAsGreen:
+		return ciStatusNone, headSHA, nil
+	case completed > 0 || reportNoCIAsGreen:
+		return ciStatusPassing, headSHA, nil
+	}
+	return ciStatusPending, headSHA, nil
+}
+
+// renderBadge renders a shields.io "flat" style badge.
+func renderBadge(label, message, color string) []byte {
+	labelWidth := badgeTextWidth(label) + 10
+	messageWidth := badgeTextWidth(message) + 10
+	width := labelWidth + messageWidth
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, width, label, message)
+	fmt.Fprintf(&sb, `<title>%s: %s</title>`, label, message)
+	sb.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&sb, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, width)
+	fmt.Fprintf(&sb, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`, labelWidth, labelWidth, messageWidth, color, width)
+	sb.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	for _, text := range []struct {
+		x int
+		s string
+	}{{labelWidth / 2, label}, {labelWidth + messageWidth/2, message}} {
+		fmt.Fprintf(&sb, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, text.x, text.s, text.x, text.s)
+	}
+	sb.WriteString(`</g></svg>`)
+	return []byte(sb.String())
+}
+
+// badgeTextWidth approximates the width of text in 11px Verdana.
+func badgeTextWidth(s string) int {
+	width := 0.0
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune("iljtfI.,:;|!' ()[]", r):
+			width += 4
+		case strings.ContainsRune("mwMW", r):
+			width += 10
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			width += 7.5
+		default:
+			width += 6.5
+		}
+	}
+	return int(width + 0.5)
+}
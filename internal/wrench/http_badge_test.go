@@ -0,0 +1,73 @@
+package wrench
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v48/github"
+	"github.com/hexops/wrench/internal/wrench/scripts"
+)
+
+func TestRepoCIStatus(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{}}
+		repo := scripts.Repo{Name: "hexops/example", CI: scripts.Zig}
+		run := func(status, conclusion string) *github.CheckRun {
+			r := &github.CheckRun{HeadSHA: github.String("abc"), Status: github.String(status)}
+			if conclusion != "" {
+				r.Conclusion = github.String(conclusion)
+			}
+			return r
+		}
+		cache := func(key string, v any) {
+			t.Helper()
+			data, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.CacheSet(ctx, githubAPICacheName, repo.Name+key, string(data), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tst := range []struct {
+			name           string
+			runs           []*github.CheckRun
+			combined       string // combined commit status state, if any
+			want, wantBare ciStatus
+			wantMessage    string
+		}{
+			{name: "no CI", want: ciStatusNone, wantBare: ciStatusNone, wantMessage: "no CI"},
+			{name: "passing", runs: []*github.CheckRun{run("completed", "success")}, want: ciStatusPassing, wantBare: ciStatusPassing, wantMessage: "passing"},
+			{name: "failing", runs: []*github.CheckRun{run("completed", "success"), run("completed", "failure")}, want: ciStatusFailing, wantBare: ciStatusFailing, wantMessage: "failing"},
+			{name: "running", runs: []*github.CheckRun{run("in_progress", "")}, want: ciStatusPending, wantBare: ciStatusPending, wantMessage: "pending"},
+			{name: "queued", runs: []*github.CheckRun{run("queued", "")}, want: ciStatusPending, wantBare: ciStatusPending, wantMessage: "pending"},
+			{name: "commit status only", combined: "success", want: ciStatusPassing, wantBare: ciStatusNone, wantMessage: "passing"},
+			{name: "failing commit status", runs: []*github.CheckRun{run("completed", "success")}, combined: "failure", want: ciStatusFailing, wantBare: ciStatusPassing, wantMessage: "failing"},
+		} {
+			cache("-Checks-ListCheckRunsForRef-HEAD", &github.ListCheckRunsResults{Total: github.Int(len(tst.runs)), CheckRuns: tst.runs})
+			combined := &github.CombinedStatus{TotalCount: github.Int(0)}
+			if tst.combined != "" {
+				combined = &github.CombinedStatus{TotalCount: github.Int(1), State: github.String(tst.combined), SHA: github.String("abc")}
+			}
+			cache("-Repositories-GetCombinedStatus-HEAD", combined)
+
+			got, _, err := b.repoCIStatus(ctx, repo, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tst.want {
+				t.Errorf("%s: got status %v, want %v", tst.name, got, tst.want)
+			}
+			if message, _ := got.badge(); message != tst.wantMessage {
+				t.Errorf("%s: got badge %q, want %q", tst.name, message, tst.wantMessage)
+			}
+			// The /projects page only considers check runs.
+			if got, _, err := b.repoCIStatus(ctx, repo, false); err != nil || got != tst.wantBare {
+				t.Errorf("%s: without commit statuses, got status %v (%v), want %v", tst.name, got, err, tst.wantBare)
+			}
+		}
+	})
+}
@@ -0,0 +1,306 @@
+package wrench
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func (b *Bot) httpServeJobsList(ctx context.Context, r *api.JobsListRequest) (*api.JobsListResponse, error) {
+	limit := r.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, 500)
+
+	filters := []JobsFilter{
+		{
+			State:                       r.State,
+			NotState:                    r.NotState,
+			Title:                       r.Title,
+			NotTitle:                    r.NotTitle,
+			TargetRunnerID:              r.TargetRunnerID,
+			ScheduledStartLessOrEqualTo: r.ScheduledStartLessOrEqualTo,
+		},
+		// One extra job tells us whether there is a next page.
+		{Limit: limit + 1},
+	}
+	if r.Cursor != "" {
+		if !validJobID(api.JobID(r.Cursor)) {
+			return nil, fmt.Errorf("invalid cursor %q", r.Cursor)
+		}
+		filters = append(filters, JobsFilter{IDLessThan: api.JobID(r.Cursor)})
+	}
+	jobs, err := b.store.Jobs(ctx, filters...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Jobs")
+	}
+	resp := &api.JobsListResponse{Jobs: jobs}
+	if len(jobs) > limit {
+		resp.Jobs = jobs[:limit]
+		resp.NextCursor = string(resp.Jobs[limit-1].ID)
+	}
+	return resp, nil
+}
+
+// jobByID is like Store.JobByID, but returns ErrNotFound for malformed (e.g. user-provided) IDs.
+func (b *Bot) jobByID(ctx context.Context, id api.JobID) (api.Job, error) {
+	if !validJobID(id) {
+		return api.Job{}, ErrNotFound
+	}
+	return b.store.JobByID(ctx, id)
+}
+
+func (b *Bot) httpServeJobsGet(ctx context.Context, r *api.JobsGetRequest) (*api.JobsGetResponse, error) {
+	job, err := b.jobByID(ctx, r.ID)
+	if err == ErrNotFound {
+		return &api.JobsGetResponse{NotFound: true}, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "JobByID")
+	}
+	return &api.JobsGetResponse{Job: job}, nil
+}
+
+// checkJobSecretsRole returns an error unless the identity in ctx may create a job with the
+// payload. Operators may run any command, so only admins may hand secrets to it.
+func checkJobSecretsRole(ctx context.Context, payload api.JobPayload) error {
+	if len(payload.SecretIDs) == 0 {
+		return nil
+	}
+	if id := identityFromContext(ctx); id == nil || !id.Role.atLeast(RoleAdmin) {
+		return fmt.Errorf("Payload.SecretIDs requires the %s role", RoleAdmin)
+	}
+	return nil
+}
+
+func (b *Bot) httpServeJobsCreate(ctx context.Context, r *api.JobsCreateRequest) (*api.JobsCreateResponse, error) {
+	if r.Title == "" {
+		return nil, errors.New("Title is required")
+	}
+	if err := checkJobSecretsRole(ctx, r.Payload); err != nil {
+		return nil, err
+	}
+	if r.TargetRunnerID != "" {
+		runners, err := b.store.Runners(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Runners")
+		}
+		found := false
+		for _, runner := range runners {
+			if runner.ID == r.TargetRunnerID {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid runner ID %q (see 'wrench runners')", r.TargetRunnerID)
+		}
+	}
+	id, err := b.store.NewRunnerJob(ctx, api.Job{
+		Title:            r.Title,
+		TargetRunnerID:   r.TargetRunnerID,
+		TargetRunnerArch: r.TargetRunnerArch,
+		Payload:          r.Payload,
+		ScheduledStart:   r.ScheduledStart,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "NewRunnerJob")
+	}
+	b.idLogf(id.LogID(), "job created: %v", r.Title)
+	b.audit(ctx, "job-create", string(id))
+	return &api.JobsCreateResponse{ID: id}, nil
+}
+
+func (b *Bot) httpServeJobsCancel(ctx context.Context, r *api.JobsCancelRequest) (*api.JobsCancelResponse, error) {
+	job, err := b.jobByID(ctx, r.ID)
+	if err == ErrNotFound {
+		return &api.JobsCancelResponse{NotFound: true}, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "JobByID")
+	}
+	if job.State == api.JobStateSuccess || job.State == api.JobStateError {
+		return nil, fmt.Errorf("job has already finished (%s)", job.State)
+	}
+	if err := b.markJobCancelled(ctx, job); err != nil {
+		return nil, err
+	}
+	b.audit(ctx, "job-cancel", string(job.ID))
+	return &api.JobsCancelResponse{}, nil
+}
+
+func (b *Bot) httpServeJobsLogs(ctx context.Context, r *api.JobsLogsRequest) (*api.JobsLogsResponse, error) {
+	job, err := b.jobByID(ctx, r.ID)
+	if err == ErrNotFound {
+		return &api.JobsLogsResponse{NotFound: true}, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "JobByID")
+	}
+	logs, err := b.store.Logs(ctx, job.ID.LogID())
+	if err != nil {
+		return nil, errors.Wrap(err, "Logs")
+	}
+	resp := &api.JobsLogsResponse{State: job.State, Offset: len(logs)}
+	for _, log := range logs[min(max(r.Offset, 0), len(logs)):] {
+		resp.Logs = append(resp.Logs, api.Log{Time: log.Time, Message: log.Message})
+	}
+	return resp, nil
+}
+
+// httpServeJob serves /jobs/<id>, a detail page for a job, and /jobs/<id>/retry.
+func (b *Bot) httpServeJob(w http.ResponseWriter, r *http.Request) error {
+	rest := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if rest == "" {
+		http.Redirect(w, r, b.Config.ExternalURL+"/runners", http.StatusFound)
+		return nil
+	}
+	id, action, _ := strings.Cut(rest, "/")
+	job, err := b.jobByID(r.Context(), api.JobID(id))
+	if err == ErrNotFound {
+		http.NotFound(w, r)
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "JobByID")
+	}
+	switch action {
+	case "":
+		return b.httpWriteJob(w, r, job)
+	case "retry":
+		return b.httpRequireRole(RoleOperator, func(w http.ResponseWriter, r *http.Request) error {
+			return b.httpServeJobRetry(w, r, job)
+		})(w, r)
+	}
+	http.NotFound(w, r)
+	return nil
+}
+
+func (b *Bot) httpWriteJob(w http.ResponseWriter, r *http.Request, job api.Job) error {
+	events, err := b.store.JobEvents(r.Context(), job.ID)
+	if err != nil {
+		return errors.Wrap(err, "JobEvents")
+	}
+	logs, err := b.store.Logs(r.Context(), job.ID.LogID())
+	if err != nil {
+		return errors.Wrap(err, "Logs")
+	}
+	logIDs, err := b.store.LogIDs(r.Context())
+	if err != nil {
+		return errors.Wrap(err, "LogIDs")
+	}
+
+	// Assigning a job to a runner overwrites its target runner, so the original target is taken
+	// from when the job was created.
+	targetRunnerID := originalTargetRunnerID(job, events)
+	var assignedRunner string
+	var readyAt, startedAt, finishedAt time.Time
+	for _, e := range events {
+		switch {
+		case e.State == api.JobStateReady:
+			readyAt, startedAt, finishedAt = e.Time, time.Time{}, time.Time{}
+		case e.State == api.JobStateStarting:
+			startedAt, assignedRunner = e.Time, e.RunnerID
+		case jobFinished(e.State):
+			finishedAt = e.Time
+		}
+	}
+	queueWait, runDuration := "-", "-"
+	if !readyAt.IsZero() && !startedAt.IsZero() {
+		queueWait = startedAt.Sub(readyAt).Round(time.Second).String()
+	}
+	if !startedAt.IsZero() {
+		end := finishedAt
+		if end.IsZero() {
+			end = time.Now()
+		}
+		runDuration = end.Sub(startedAt).Round(time.Second).String()
+	}
+
+	type timelineEvent struct {
+		api.JobEvent
+		After string
+	}
+	var timeline []timelineEvent
+	for i, e := range events {
+		after := ""
+		if i > 0 {
+			after = e.Time.Sub(events[i-1].Time).Round(time.Second).String()
+		}
+		timeline = append(timeline, timelineEvent{JobEvent: e, After: after})
+	}
+
+	jobLogIDs := []string{job.ID.LogID()}
+	for _, logID := range logIDs {
+		if strings.HasPrefix(logID, job.ID.LogID()+"-") {
+			jobLogIDs = append(jobLogIDs, logID)
+		}
+	}
+
+	// Pull requests and issues are logged by httpServeRunnerJobUpdate as they are created.
+	var links []string
+	for _, log := range logs {
+		for _, prefix := range []string{"pull request: ", "issue: "} {
+			if link, ok := strings.CutPrefix(log.Message, prefix); ok && strings.HasPrefix(link, "https://") {
+				links = append(links, link)
+			}
+		}
+	}
+
+	return b.render(w, r, "job", "Job "+string(job.ID), map[string]any{
+		"Job":            job,
+		"Command":        "wrench " + strings.Join(job.Payload.Cmd, " "),
+		"TargetRunner":   strings.Trim(targetRunnerID+" "+job.TargetRunnerArch, " "),
+		"AssignedRunner": assignedRunner,
+		"Secrets":        strings.Join(job.Payload.SecretIDs, ", "),
+		"QueueWait":      queueWait,
+		"RunDuration":    runDuration,
+		"Timeline":       timeline,
+		"LogIDs":         jobLogIDs,
+		"Links":          links,
+	})
+}
+
+// httpServeJobRetry runs a job again, as a new job with the same title, target and payload. A
+// GET request shows a confirmation button, so that signing in from the job page works.
+func (b *Bot) httpServeJobRetry(w http.ResponseWriter, r *http.Request, job api.Job) error {
+	if r.Method != "POST" {
+		return b.render(w, r, "job_retry", "Retry job "+string(job.ID), job)
+	}
+	if b.rejectCrossOrigin(w, r) {
+		return nil
+	}
+	ctx := withAuditActor(r.Context(), auditActorFromRequest(r), AuditSourceHTTP)
+	if err := checkJobSecretsRole(ctx, job.Payload); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, "Forbidden: the job uses secrets (%s), so retrying it requires the %s role.\n", strings.Join(job.Payload.SecretIDs, ", "), RoleAdmin)
+		return nil
+	}
+	events, err := b.store.JobEvents(ctx, job.ID)
+	if err != nil {
+		return errors.Wrap(err, "JobEvents")
+	}
+	id, err := b.store.NewRunnerJob(ctx, api.Job{
+		Title:            job.Title,
+		TargetRunnerID:   originalTargetRunnerID(job, events),
+		TargetRunnerArch: job.TargetRunnerArch,
+		Payload:          job.Payload,
+	})
+	if err != nil {
+		return errors.Wrap(err, "NewRunnerJob")
+	}
+	b.idLogf(id.LogID(), "job created: %v (retry of %v)", job.Title, job.ID)
+	b.audit(ctx, "job-retry", string(job.ID))
+	http.Redirect(w, r, fmt.Sprintf("%s/jobs/%s", b.Config.ExternalURL, id), http.StatusSeeOther)
+	return nil
+}
+
+// originalTargetRunnerID returns the runner the job targeted when it was created, which may be
+// empty (any runner.)
+func originalTargetRunnerID(job api.Job, events []api.JobEvent) string {
+	if len(events) > 0 && events[0].State == api.JobStateReady {
+		return events[0].RunnerID
+	}
+	return job.TargetRunnerID
+}
@@ -0,0 +1,136 @@
+package wrench
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func TestHttpServeJobRetry(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{ExternalURL: "https://wrench.example.com", Secret: "secret"}}
+		plain, err := s.NewRunnerJob(ctx, api.Job{Title: "build", Payload: api.JobPayload{Cmd: []string{"echo"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		withSecrets, err := s.NewRunnerJob(ctx, api.Job{Title: "release", Payload: api.JobPayload{Cmd: []string{"echo"}, SecretIDs: []string{"linux/token"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		retry := func(id api.JobID, role Role) int {
+			r := httptest.NewRequest("POST", "/jobs/"+string(id)+"/retry", nil)
+			r.Header.Set("Origin", b.Config.ExternalURL)
+			r = r.WithContext(withIdentity(r.Context(), &Identity{Login: "alice", Role: role, Via: "session"}))
+			w := httptest.NewRecorder()
+			if err := b.httpServeJob(w, r); err != nil {
+				t.Fatal(err)
+			}
+			return w.Code
+		}
+		jobCount := func() int {
+			jobs, err := s.Jobs(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return len(jobs)
+		}
+
+		for _, tst := range []struct {
+			job      api.JobID
+			role     Role
+			wantCode int
+		}{
+			{plain, RoleViewer, http.StatusForbidden},
+			{plain, RoleOperator, http.StatusSeeOther},
+			{withSecrets, RoleOperator, http.StatusForbidden},
+			{withSecrets, RoleAdmin, http.StatusSeeOther},
+		} {
+			before := jobCount()
+			code := retry(tst.job, tst.role)
+			created := jobCount() - before
+			if code != tst.wantCode || (created == 1) != (code == http.StatusSeeOther) {
+				t.Errorf("retry %s as %s: expected status %d, found %d with %d jobs created", tst.job, tst.role, tst.wantCode, code, created)
+			}
+		}
+	})
+}
+
+func TestJobsAPI(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		b := &Bot{store: s, Config: &Config{}}
+		ctx := withIdentity(context.Background(), &Identity{Login: "alice", Role: RoleOperator, Via: "token"})
+
+		// wrench jobs run
+		var ids []api.JobID
+		for _, title := range []string{"build", "test", "build"} {
+			resp, err := b.httpServeJobsCreate(ctx, &api.JobsCreateRequest{Title: title, Payload: api.JobPayload{Cmd: []string{"echo"}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, resp.ID)
+		}
+		if _, err := b.httpServeJobsCreate(ctx, &api.JobsCreateRequest{Title: "release", Payload: api.JobPayload{SecretIDs: []string{"linux/token"}}}); err == nil {
+			t.Fatal("expected an operator to be unable to create a job with secrets")
+		}
+		if _, err := b.httpServeJobsCreate(ctx, &api.JobsCreateRequest{Title: "build", TargetRunnerID: "nonexistent"}); err == nil {
+			t.Fatal("expected an unknown runner to be rejected")
+		}
+
+		// wrench jobs list, a page at a time.
+		page, err := b.httpServeJobsList(ctx, &api.JobsListRequest{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Jobs) != 2 || page.Jobs[0].ID != ids[2] || page.Jobs[1].ID != ids[1] || page.NextCursor == "" {
+			t.Fatalf("unexpected first page %+v", page)
+		}
+		page, err = b.httpServeJobsList(ctx, &api.JobsListRequest{Limit: 2, Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Jobs) != 1 || page.Jobs[0].ID != ids[0] || page.NextCursor != "" {
+			t.Fatalf("unexpected last page %+v", page)
+		}
+		if page, err := b.httpServeJobsList(ctx, &api.JobsListRequest{Title: "test"}); err != nil || len(page.Jobs) != 1 || page.Jobs[0].ID != ids[1] {
+			t.Fatalf("unexpected jobs titled test %+v %v", page, err)
+		}
+		if _, err := b.httpServeJobsList(ctx, &api.JobsListRequest{Cursor: "' OR 1=1"}); err == nil {
+			t.Fatal("expected an invalid cursor to be rejected")
+		}
+
+		// wrench jobs show
+		if resp, err := b.httpServeJobsGet(ctx, &api.JobsGetRequest{ID: ids[1]}); err != nil || resp.Job.Title != "test" {
+			t.Fatalf("unexpected job %+v %v", resp, err)
+		}
+		if resp, err := b.httpServeJobsGet(ctx, &api.JobsGetRequest{ID: "nonexistent"}); err != nil || !resp.NotFound {
+			t.Fatalf("expected the job not to be found, found %+v %v", resp, err)
+		}
+
+		// wrench jobs cancel
+		if _, err := b.httpServeJobsCancel(ctx, &api.JobsCancelRequest{ID: ids[0]}); err != nil {
+			t.Fatal(err)
+		}
+		if resp, err := b.httpServeJobsGet(ctx, &api.JobsGetRequest{ID: ids[0]}); err != nil || resp.Job.State != api.JobStateError {
+			t.Fatalf("expected the cancelled job to have failed, found %+v %v", resp, err)
+		}
+		if _, err := b.httpServeJobsCancel(ctx, &api.JobsCancelRequest{ID: ids[0]}); err == nil {
+			t.Fatal("expected cancelling a finished job to fail")
+		}
+
+		// wrench jobs logs, following from an offset.
+		logs, err := b.httpServeJobsLogs(ctx, &api.JobsLogsRequest{ID: ids[0]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs.Logs) != 2 || logs.Logs[1].Message != "error: job cancelled" || logs.Offset != 2 || logs.State != api.JobStateError {
+			t.Fatalf("unexpected logs %+v", logs)
+		}
+		if logs, err := b.httpServeJobsLogs(ctx, &api.JobsLogsRequest{ID: ids[0], Offset: logs.Offset}); err != nil || len(logs.Logs) != 0 {
+			t.Fatalf("expected no new logs, found %+v %v", logs, err)
+		}
+	})
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
 	"regexp"
@@ -15,13 +15,19 @@ import (
 	"time"
 
 	"github.com/hexops/wrench/internal/errors"
-	"github.com/hexops/wrench/internal/wrench/scripts"
 	"github.com/natefinch/atomic"
 	orderedmap "github.com/wk8/go-ordered-map/v2"
 )
 
 func (b *Bot) httpMuxPkgProxy(handler func(prefix string, handle handlerFunc) http.Handler) http.Handler {
+	b.pkgLimits = newPkgLimiter(b.Config.PkgLimits)
+	b.upstreamHealth = newPkgUpstreamHealth(b)
+	b.upstreamHealth.start()
 	mux := http.NewServeMux()
+	mux.Handle("/metrics", b.metricsHandler())
+	mux.Handle("/feeds/zig-versions.atom", handler("feeds", b.httpServeFeedZigVersions))
+	mux.Handle("/static/", uiStaticHandler())
+	mux.Handle("/cache", handler("cache", b.httpRequireRole(RoleAdmin, b.httpPkgCacheReport)))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if b.Config.ModeType() == ModeZig {
 			if r.URL.Path == "/" {
@@ -45,7 +51,8 @@ func (b *Bot) httpMuxPkgProxy(handler func(prefix string, handle handlerFunc) ht
 			handler("zig", b.httpPkgZig).ServeHTTP(w, r)
 			return
 		}
-		split := strings.Split(r.URL.Path, "/")
+		_, rest, _ := b.pkgUpstreamFor(r.URL.Path)
+		split := strings.Split(rest, "/")
 		if len(split) == 3 {
 			// https://pkg.machengine.org/<project>/<file>
 			handler("pkg", b.httpPkgPkg).ServeHTTP(w, r)
@@ -70,76 +77,33 @@ func (b *Bot) httpMuxPkgProxy(handler func(prefix string, handle handlerFunc) ht
 			time.Sleep(1 * time.Minute)
 		}
 	}()
+	b.pkgCacheStart()
 	return mux
 }
 
 func (b *Bot) httpPkgZigRoot(w http.ResponseWriter, r *http.Request) error {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-	_, _ = fmt.Fprintf(w, `
-<h1 style="margin-bottom: 0.25rem;">Zig download mirror</h1>
-
-<div>
-
-<p>This site acts as a mirror of <a href="https://ziglang.org/download">ziglang.org/download</a></p>
-<p>The rewrite logic is as follows:</p>
-<div style="margin-left: 1rem;">
-	<pre>
-<strong>https://ziglang.org/builds/$FILE</strong> -> <strong>%s/zig/$FILE</strong>
-</pre>
-</div>
-<p>Note: .tar.gz, .zip, and .minisig signatures are available for download. Signatures can also be downloaded from ziglang.org for verification purposes.</p>
-
-</div>
-
-<p>~ <a href="https://github.com/hexops/wrench">Wrench</a>.</p>
-`, b.Config.ExternalURL)
-	return nil
+	return b.render(w, r, "pkg_zig", "", nil)
 }
+
 func (b *Bot) httpPkgRoot(w http.ResponseWriter, r *http.Request) error {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_, _ = fmt.Fprintf(w, "%s", `
-<h1 style="margin-bottom: 0.25rem;">pkg.machengine.org</h1>
-<strong style="font-weight: 16px; margin-top: 0; margin-left: 1rem;"><em>The <a href="https://machengine.org">Mach</a> package download server</em></strong>
-
-<div style="margin-left: 2rem;">
-
-<h3 style="margin-top: 2rem;">Zig downloads</h3>
-<p>This site acts as a mirror of <a href="https://ziglang.org/download">ziglang.org/download</a></p>
-<div style="margin-left: 1rem;">
-	<p>The rewrite logic is as follows:</p>
-	<pre>
-<strong>https://ziglang.org/builds/$FILE</strong> -> <strong>https://pkg.machengine.org/zig/$FILE</strong>
-</pre>
-</div>
-<p>Note: .tar.gz, .zip, and .minisig signatures are available for download. Signatures can also be downloaded from ziglang.org for verification purposes.</p>
-
-<h3 style="margin-top: 2rem;">Mach downloads</h3>
-<p>This site serves Zig packages for all <a href="https://wrench.machengine.org/projects/">Mach projects</a>.</p>
-<div style="margin-left: 1rem;">
-	<p>The rewrite logic is as follows:</p>
-	<pre>
-<strong>https://github.com/hexops/$PROJECT/archive/$FILE</strong> -> <strong>https://pkg.machengine.org/$PROJECT/$FILE</strong>
-</pre>
-</div>
-<p>As well as binary release artifacts for some projects, built via our CI pipelines.</p>
-<div style="margin-left: 1rem;">
-	<p>The rewrite logic is as follows:</p>
-	<pre>
-<strong>https://github.com/hexops/$PROJECT/releases/download/$VERSION/$FILE</strong> -> <strong>https://pkg.machengine.org/$PROJECT/artifact/$VERSION/$FILE</strong>
-</pre>
-</div>
-
-<h3 style="margin-top: 2rem;">Contact</h3>
-<ul>
-	<li><a href="https://github.com/hexops/mach/issues?q=is%3Aopen+is%3Aissue+label%3Awrench">Issue tracker</a></li>
-	<li><a href="https://discord.gg/XNG3NZgCqp">Mach discord</a></li>
-	<li><a href="https://github.com/hexops/wrench">Wrench source on GitHub</a></li>
-</ul>
-
-</div>
-`)
-	return nil
+	type zigUpstream struct {
+		Kind string
+		URLs []string
+	}
+	zig := []zigUpstream{
+		{Kind: "stable releases", URLs: b.Config.ZigUpstreams.Stable},
+		{Kind: "Mach-nominated dev builds", URLs: b.Config.ZigUpstreams.Mach},
+		{Kind: "other dev builds", URLs: b.Config.ZigUpstreams.Dev},
+	}
+	pkg := make([]PkgUpstreamConfig, len(b.Config.PkgUpstreams))
+	for i, u := range b.Config.PkgUpstreams {
+		u.Prefix = pkgUpstreamPrefix(u.Prefix)
+		pkg[i] = u
+	}
+	return b.render(w, r, "pkg", "", map[string]any{
+		"Zig": zig,
+		"Pkg": pkg,
+	})
 }
 
 var (
@@ -235,12 +199,19 @@ func (b *Bot) httpPkgZig(w http.ResponseWriter, r *http.Request) error {
 		}
 
 		b.idLogf("zig", "serve %s", filePath)
-		http.ServeContent(w, r, fname, fi.ModTime(), f)
+		b.pkgCacheTouch(filePath)
+		http.ServeContent(b.pkgLimits.throttle(r, &countingResponseWriter{ResponseWriter: w, counter: metricPkgBytesServed.WithLabelValues("zig")}), r, fname, fi.ModTime(), f)
 		return nil
 	}
-	if _, err := os.Stat(filePath); err == nil {
+	if b.zigCachedVerified(version, versionKind, fname) {
+		metricPkgCacheRequests.WithLabelValues("zig", "hit").Inc()
 		return serveCacheHit()
 	}
+	metricPkgCacheRequests.WithLabelValues("zig", "miss").Inc()
+	if ok, limit, retryAfter := b.pkgLimits.allowMiss(r); !ok {
+		pkgRejectRateLimited(w, "zig", limit, retryAfter)
+		return nil
+	}
 
 	if err := b.httpPkgEnsureZigDownloadCached(version, versionKind, fname); err != nil {
 		if !strings.Contains(err.Error(), "ignored") {
@@ -365,25 +336,13 @@ var (
 	fsParallelismLock sync.Mutex
 )
 
-func (b *Bot) httpPkgEnsureZigDownloadCached(version, versionKind, fname string) error {
-	dirPath := path.Join("cache/zig/", versionKind, version)
-	filePath := path.Join(dirPath, fname)
-	if _, err := os.Stat(filePath); err == nil {
+func (b *Bot) httpPkgEnsureZigDownloadCached(version, versionKind, fname string) (err error) {
+	filePath := path.Join("cache/zig/", versionKind, version, fname)
+	if b.zigCachedVerified(version, versionKind, fname) {
 		return nil
 	}
 
-	url := ""
-	if versionKind == "mach" && !b.Config.PkgProxyDisableMachMirror {
-		url = "https://pkg.machengine.org" + path.Join("/zig/", fname)
-	} else if versionKind == "mach" && b.Config.PkgProxyDisableMachMirror {
-		url = "https://ziglang.org" + path.Join("/builds/", fname)
-	} else if versionKind == "stable" {
-		url = "https://ziglang.org" + path.Join("/download/", version, fname)
-	} else {
-		url = "https://ziglang.org" + path.Join("/builds/", fname)
-	}
-
-	// URLs that we know do not exist
+	// Files that we know do not exist
 	ignored := map[string]struct{}{}
 	// minisig files for these two versions no longer exist anywhere.
 	for _, version := range []string{"0.12.0-dev.2063+804cee3b9", "0.12.0-dev.3180+83e578a18"} {
@@ -404,22 +363,61 @@ func (b *Bot) httpPkgEnsureZigDownloadCached(version, versionKind, fname string)
 		} {
 			for _, sub := range []string{".minisig"} {
 				fname := strings.Replace(tmpl+sub, "$VERSION", version, 1)
-				ignored["https://pkg.machengine.org/zig/"+fname] = struct{}{}
+				ignored[fname] = struct{}{}
 			}
 		}
 	}
 
-	if _, ignore := ignored[url]; ignore {
-		return errors.New("ignored")
+	if _, ignore := ignored[fname]; ignore {
+		return errZigIgnored
+	}
+
+	// The signature is needed to verify the download.
+	pk, err := b.zigPublicKey()
+	if err != nil {
+		return err
+	}
+	if pk != nil && !strings.HasSuffix(fname, ".minisig") {
+		if err := b.httpPkgEnsureZigSignatureCached(version, versionKind, fname); err != nil {
+			return err
+		}
+	}
+
+	var templates []string
+	switch versionKind {
+	case "stable":
+		templates = b.Config.ZigUpstreams.Stable
+	case "mach":
+		templates = b.Config.ZigUpstreams.Mach
+	default:
+		templates = b.Config.ZigUpstreams.Dev
+	}
+	urls := b.upstreamHealth.order(expandUpstreamURLs(templates, "VERSION", version, "FILE", fname))
+	if len(urls) == 0 {
+		return errors.New("no upstream configured for " + versionKind + " Zig versions")
+	}
+	for i, url := range urls {
+		err = b.httpPkgZigFetch(version, url, filePath)
+		if err == nil {
+			return nil
+		}
+		if i+1 < len(urls) {
+			b.idLogf("zig", "falling back from %s: %v", url, err)
+		}
 	}
+	return err
+}
 
+// httpPkgZigFetch fetches a download of the Zig version from url into the cache at filePath.
+func (b *Bot) httpPkgZigFetch(version, url, filePath string) (err error) {
 	logWriter := b.idWriter("zig")
 
 	cachedResponsesMu.Lock()
 	cachedError, isCachedError := cachedResponses[url]
 	cachedResponsesMu.Unlock()
 	if isCachedError {
-		if cachedError.expire >= time.Now().Unix() {
+		// Errors with no expiry are cached forever.
+		if cachedError.expire != 0 && cachedError.expire < time.Now().Unix() {
 			cachedResponsesMu.Lock()
 			delete(cachedResponses, url)
 			cachedResponsesMu.Unlock()
@@ -430,10 +428,15 @@ func (b *Bot) httpPkgEnsureZigDownloadCached(version, versionKind, fname string)
 		}
 	}
 	_, _ = fmt.Fprintf(logWriter, "fetch: %s > %s\n", url, filePath)
+	defer func() {
+		if err != nil {
+			metricPkgUpstreamErrors.WithLabelValues("zig").Inc()
+		}
+	}()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
-	resp, err := httpGet(ctx, url)
+	resp, err := b.httpPkgGet(ctx, url)
 	if err != nil {
 		return errors.Wrap(err, "Get")
 	}
@@ -441,7 +444,7 @@ func (b *Bot) httpPkgEnsureZigDownloadCached(version, versionKind, fname string)
 
 	if resp.StatusCode >= 400 && resp.StatusCode <= 500 {
 		// 404 not found, 403 forbidden, etc.
-		err := fmt.Errorf("bad response status: %s", resp.Status)
+		err := &upstreamStatusError{code: resp.StatusCode, status: resp.Status}
 
 		// We cache fetch errors for 120s, to avoid overwhelming the origin server.
 		var expiry = time.Now().Unix() + 120
@@ -471,13 +474,134 @@ func (b *Bot) httpPkgEnsureZigDownloadCached(version, versionKind, fname string)
 	fsParallelismLock.Lock()
 	defer fsParallelismLock.Unlock()
 
+	verifyFailed := false
+	err = b.httpPkgWriteCached("zig", resp, filePath, func(f *os.File) error {
+		err := b.zigVerifyDownload(filePath, f)
+		verifyFailed = err != nil
+		return err
+	})
+	if verifyFailed {
+		b.zigRemoveUnverified(filePath)
+
+		// Like fetch errors, verification failures are cached to avoid overwhelming the origin.
+		cachedResponsesMu.Lock()
+		cachedResponses[url] = cachedResponse{err: err, expire: time.Now().Unix() + 120}
+		cachedResponsesMu.Unlock()
+	}
+	return err
+}
+
+// httpPkgEnsureZigSignatureCached ensures the .minisig signature of the Zig download fname is
+// cached. A signature missing upstream is not an error if Config.ZigAllowUnsigned.
+func (b *Bot) httpPkgEnsureZigSignatureCached(version, versionKind, fname string) error {
+	err := b.httpPkgEnsureZigDownloadCached(version, versionKind, fname+".minisig")
+	var status *upstreamStatusError
+	missing := errors.Is(err, errZigIgnored) || (errors.As(err, &status) && status.code == http.StatusNotFound)
+	if missing && b.Config.ZigAllowUnsigned {
+		return nil
+	}
+	return errors.Wrap(err, "signature")
+}
+
+// errZigIgnored is returned for Zig downloads known not to exist upstream.
+var errZigIgnored = errors.New("ignored")
+
+// upstreamStatusError is an unsuccessful response status from upstream.
+type upstreamStatusError struct {
+	code   int
+	status string
+}
+
+func (e *upstreamStatusError) Error() string {
+	return "bad response status: " + e.status
+}
+
+// httpPkgDownload fetches a file into the cache at filePath, from the first of the upstream urls
+// that has it.
+func (b *Bot) httpPkgDownload(kind string, urls []string, filePath string) (err error) {
+	urls = b.upstreamHealth.order(urls)
+	if len(urls) == 0 {
+		return errors.New("no upstream configured")
+	}
+	for i, url := range urls {
+		err = b.httpPkgDownloadFrom(kind, url, filePath)
+		if err == nil || err == errObjectTooLarge {
+			return err
+		}
+		if i+1 < len(urls) {
+			b.idLogf(kind, "falling back from %s: %v", url, err)
+		}
+	}
+	return err
+}
+
+// httpPkgDownloadFrom fetches url into the cache at filePath.
+func (b *Bot) httpPkgDownloadFrom(kind, url, filePath string) (err error) {
+	_, _ = fmt.Fprintf(b.idWriter(kind), "fetch: %s > %s\n", url, filePath)
+	defer func() {
+		if err != nil {
+			metricPkgUpstreamErrors.WithLabelValues(kind).Inc()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	resp, err := b.httpPkgGet(ctx, url)
+	if err != nil {
+		return errors.Wrap(err, "Get")
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad response status: %s", resp.Status)
+	}
+	return b.httpPkgWriteCached(kind, resp, filePath, nil)
+}
+
+// httpPkgWriteCached writes the body of an upstream response to the cache at filePath, if verify
+// (when not nil) accepts it. The file is written atomically, so that a failed download never
+// leaves a partial or unverified file to be served.
+func (b *Bot) httpPkgWriteCached(kind string, resp *http.Response, filePath string, verify func(f *os.File) error) error {
+	body, err := limitObjectSize(resp, b.pkgLimits.maxObjectBytes())
+	if err != nil {
+		metricPkgRejected.WithLabelValues(kind, "size").Inc()
+		return err
+	}
+	dirPath := path.Dir(filePath)
 	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
 		return errors.Wrap(err, "MkdirAll "+dirPath)
 	}
-	err = atomic.WriteFile(filePath, resp.Body)
+	f, err := os.CreateTemp(dirPath, ".download-*")
 	if err != nil {
+		return errors.Wrap(err, "CreateTemp")
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath) //nolint:errcheck
+	defer f.Close()          //nolint:errcheck
+	if _, err := io.Copy(f, body); err != nil {
+		if l, ok := body.(*limitedReader); ok && l.n < 0 {
+			metricPkgRejected.WithLabelValues(kind, "size").Inc()
+			return errObjectTooLarge
+		}
 		return errors.Wrap(err, "Write "+filePath)
 	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "Sync "+filePath)
+	}
+	if verify != nil {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "Seek")
+		}
+		if err := verify(f); err != nil {
+			return errors.Wrap(err, "verify "+filePath)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "Close "+filePath)
+	}
+	if err := atomic.ReplaceFile(tmpPath, filePath); err != nil {
+		return errors.Wrap(err, "ReplaceFile "+filePath)
+	}
+	pkgCacheEvictSoon()
 	return nil
 }
 
@@ -485,9 +609,12 @@ func (b *Bot) httpPkgEnsureZigDownloadCached(version, versionKind, fname string)
 // -> https://github.com/hexops/<project>/archive/<file>
 //
 // e.g. https://pkg.machengine.org/mach-ecs/83a3ed801008a976dd79e10068157b02c3b76a36.tar.gz
+//
+// Or, per Config.PkgUpstreams, https://pkg.machengine.org/<prefix>/<project>/<file>
 func (b *Bot) httpPkgPkg(w http.ResponseWriter, r *http.Request) error {
-	split := strings.Split(r.URL.Path, "/")
-	if len(split) != 3 {
+	upstream, rest, ok := b.pkgUpstreamFor(r.URL.Path)
+	split := strings.Split(rest, "/")
+	if !ok || len(split) != 3 {
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = fmt.Fprintf(w, "invalid path\n")
 		return nil
@@ -517,6 +644,7 @@ func (b *Bot) httpPkgPkg(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
+	project = pkgUpstreamProject(upstream, project)
 	cachePath := path.Join("cache/pkg/", project, fname)
 	serveCacheHit := func() error {
 		w.Header().Set("cache-control", "public, max-age=31536000, immutable")
@@ -531,23 +659,33 @@ func (b *Bot) httpPkgPkg(w http.ResponseWriter, r *http.Request) error {
 		}
 
 		b.idLogf("pkg", "serve %s", cachePath)
-		http.ServeContent(w, r, fname, fi.ModTime(), f)
+		b.pkgCacheTouch(cachePath)
+		http.ServeContent(b.pkgLimits.throttle(r, &countingResponseWriter{ResponseWriter: w, counter: metricPkgBytesServed.WithLabelValues("pkg")}), r, fname, fi.ModTime(), f)
 		return nil
 	}
 	if _, err := os.Stat(cachePath); err == nil {
+		metricPkgCacheRequests.WithLabelValues("pkg", "hit").Inc()
 		return serveCacheHit()
 	}
-
-	u := &url.URL{
-		Scheme: "https",
-		Host:   "github.com",
-		Path:   path.Join("hexops", project, "archive", fname),
+	metricPkgCacheRequests.WithLabelValues("pkg", "miss").Inc()
+	if !b.pkgLimits.allowProject(project) {
+		metricPkgRejected.WithLabelValues("pkg", "project").Inc()
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, "project not allowed\n")
+		return nil
+	}
+	if ok, limit, retryAfter := b.pkgLimits.allowMiss(r); !ok {
+		pkgRejectRateLimited(w, "pkg", limit, retryAfter)
+		return nil
 	}
-	url := u.String()
-	logWriter := b.idWriter("pkg")
-	_ = os.MkdirAll(path.Join("cache/pkg/", project), os.ModePerm)
-	if err := scripts.DownloadFile(url, cachePath)(logWriter); err != nil {
-		b.idLogf("pkg", "error downloading file: %s url=%s", err, url)
+
+	urls := expandUpstreamURLs(upstream.Archive,
+		"PROJECT", path.Base(project),
+		"FILE", fname,
+		"REF", strings.TrimSuffix(fname, ".tar.gz"),
+	)
+	if err := b.httpPkgDownload("pkg", urls, cachePath); err != nil {
+		b.idLogf("pkg", "error downloading file: %s urls=%v", err, urls)
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = fmt.Fprintf(w, "unable to fetch\n")
 		return nil
@@ -559,9 +697,12 @@ func (b *Bot) httpPkgPkg(w http.ResponseWriter, r *http.Request) error {
 // -> https://github.com/hexops/<project>/releases/download/<version>/<file>
 //
 // e.g. https://pkg.machengine.org/mach-dxcompiler/artifact/2024.02.10+4ccd240.1/aarch64-linux-gnu_ReleaseFast_lib.tar.zst
+//
+// Or, per Config.PkgUpstreams, https://pkg.machengine.org/<prefix>/<project>/artifact/<version>/<file>
 func (b *Bot) httpPkgArtifact(w http.ResponseWriter, r *http.Request) error {
-	split := strings.Split(r.URL.Path, "/")
-	if len(split) != 5 {
+	upstream, rest, ok := b.pkgUpstreamFor(r.URL.Path)
+	split := strings.Split(rest, "/")
+	if !ok || len(split) != 5 {
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = fmt.Fprintf(w, "invalid path, found %v elements expected 5\n", len(split))
 		return nil
@@ -583,6 +724,7 @@ func (b *Bot) httpPkgArtifact(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
+	project = pkgUpstreamProject(upstream, project)
 	cachePath := path.Join("cache/pkg-artifact/", project, version, fname)
 	serveCacheHit := func() error {
 		w.Header().Set("cache-control", "public, max-age=31536000, immutable")
@@ -597,24 +739,34 @@ func (b *Bot) httpPkgArtifact(w http.ResponseWriter, r *http.Request) error {
 		}
 
 		b.idLogf("artifact", "serve %s", cachePath)
-		http.ServeContent(w, r, fname, fi.ModTime(), f)
+		b.pkgCacheTouch(cachePath)
+		http.ServeContent(b.pkgLimits.throttle(r, &countingResponseWriter{ResponseWriter: w, counter: metricPkgBytesServed.WithLabelValues("artifact")}), r, fname, fi.ModTime(), f)
 		return nil
 	}
 	if _, err := os.Stat(cachePath); err == nil {
+		metricPkgCacheRequests.WithLabelValues("artifact", "hit").Inc()
 		return serveCacheHit()
 	}
+	metricPkgCacheRequests.WithLabelValues("artifact", "miss").Inc()
+	if !b.pkgLimits.allowProject(project) {
+		metricPkgRejected.WithLabelValues("artifact", "project").Inc()
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, "project not allowed\n")
+		return nil
+	}
+	if ok, limit, retryAfter := b.pkgLimits.allowMiss(r); !ok {
+		pkgRejectRateLimited(w, "artifact", limit, retryAfter)
+		return nil
+	}
 
 	// e.g. https://github.com/hexops/mach-dxcompiler/releases/download/2024.02.10+4ccd240.1/aarch64-linux-gnu_ReleaseFast_lib.tar.zst
-	u := &url.URL{
-		Scheme: "https",
-		Host:   "github.com",
-		Path:   path.Join("hexops", project, "releases/download", version, fname),
-	}
-	url := u.String()
-	logWriter := b.idWriter("pkg")
-	_ = os.MkdirAll(path.Join("cache/pkg-artifact/", project, version), os.ModePerm)
-	if err := scripts.DownloadFile(url, cachePath)(logWriter); err != nil {
-		b.idLogf("artifact", "error downloading file: %s url=%s", err, url)
+	urls := expandUpstreamURLs(upstream.Artifact,
+		"PROJECT", path.Base(project),
+		"VERSION", version,
+		"FILE", fname,
+	)
+	if err := b.httpPkgDownload("artifact", urls, cachePath); err != nil {
+		b.idLogf("artifact", "error downloading file: %s urls=%v", err, urls)
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = fmt.Fprintf(w, "unable to fetch\n")
 		return nil
@@ -661,33 +813,18 @@ func (b *Bot) httpPkgZigIndexCached() ([]byte, error) {
 	}
 
 	// Fetch the latest upstream Zig index.json
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-	defer cancel()
-	resp, err := httpGet(ctx, "https://ziglang.org/download/index.json")
+	latestIndex, err := b.httpPkgZigFetchIndex(b.Config.ZigUpstreams.Index)
 	if err != nil {
-		return nil, errors.Wrap(err, "fetching upstream https://ziglang.org/download/index.json")
-	}
-	defer resp.Body.Close() //nolint:errcheck
-	latestIndex := orderedmap.New[string, *orderedmap.OrderedMap[string, any]]()
-	if err := json.NewDecoder(resp.Body).Decode(&latestIndex); err != nil {
-		return nil, errors.Wrap(err, "parsing upstream https://ziglang.org/builds/index.json")
+		return nil, err
 	}
 
+	// Fetch the Mach index.json which contains Mach nominated versions, but is otherwise not as
+	// up-to-date as ziglang.org's version.
 	var machIndex *orderedmap.OrderedMap[string, *orderedmap.OrderedMap[string, any]]
-	{
-		// Fetch the Mach index.json which contains Mach nominated versions, but is otherwise not as
-		// up-to-date as ziglang.org's version.
-		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
-		defer cancel()
-		resp, err = httpGet(ctx, "https://machengine.org/zig/index.json")
+	if len(b.Config.ZigUpstreams.MachIndex) > 0 {
+		machIndex, err = b.httpPkgZigFetchIndex(b.Config.ZigUpstreams.MachIndex)
 		if err != nil {
-			b.logf("failed to fetch https://machengine.org/zig/index.json: %s (simply moving on with only the official index.json)", err)
-		} else {
-			defer resp.Body.Close() //nolint:errcheck
-			machIndex = orderedmap.New[string, *orderedmap.OrderedMap[string, any]]()
-			if err := json.NewDecoder(resp.Body).Decode(&machIndex); err != nil {
-				b.logf("parsing mach https://machengine.org/zig/index.json: %s (simply moving on with only the official index.json)", err)
-			}
+			b.logf("%s (simply moving on with only the official index.json)", err)
 		}
 	}
 
@@ -746,10 +883,44 @@ func (b *Bot) httpPkgZigIndexCached() ([]byte, error) {
 		return nil, errors.Wrap(err, "marshalling index.json")
 	}
 	httpPkgZigIndexFetchedAt = time.Now()
+	b.zigVersionsObserve(latestIndex)
 
 	return httpPkgZigIndexCached, nil
 }
 
+// httpPkgZigFetchIndex fetches an index.json from the first of the upstream urls that responds
+// with one.
+func (b *Bot) httpPkgZigFetchIndex(urls []string) (*orderedmap.OrderedMap[string, *orderedmap.OrderedMap[string, any]], error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no upstream configured for index.json")
+	}
+	var err error
+	for _, url := range b.upstreamHealth.order(urls) {
+		var index *orderedmap.OrderedMap[string, *orderedmap.OrderedMap[string, any]]
+		index, err = func() (*orderedmap.OrderedMap[string, *orderedmap.OrderedMap[string, any]], error) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			resp, err := b.httpPkgGet(ctx, url)
+			if err != nil {
+				return nil, errors.Wrap(err, "fetching upstream "+url)
+			}
+			defer resp.Body.Close() //nolint:errcheck
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("fetching upstream %s: bad response status: %s", url, resp.Status)
+			}
+			index := orderedmap.New[string, *orderedmap.OrderedMap[string, any]]()
+			if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+				return nil, errors.Wrap(err, "parsing upstream "+url)
+			}
+			return index, nil
+		}()
+		if err == nil {
+			return index, nil
+		}
+	}
+	return nil, err
+}
+
 // Like http.Get, but actually respects a timeout instead of leaking a goroutine to forever run.
 func httpGet(ctx context.Context, url string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
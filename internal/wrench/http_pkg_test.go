@@ -0,0 +1,106 @@
+package wrench
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHttpPkgZigFetchCachedError(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	b := &Bot{Config: &Config{WrenchDir: t.TempDir()}}
+	url := upstream.URL + "/zig-0.13.0.tar.xz"
+	fetch := func() error {
+		return b.httpPkgZigFetch("0.13.0", url, "cache/zig/0.13.0/zig-0.13.0.tar.xz")
+	}
+	first := fetch()
+	if first == nil || requests.Load() != 1 {
+		t.Fatalf("expected an error after 1 request, found %v after %d", first, requests.Load())
+	}
+
+	// Within the TTL, the cached error is returned without asking upstream again.
+	if err := fetch(); err != first || requests.Load() != 1 {
+		t.Fatalf("expected the cached error without a request, found %v after %d requests", err, requests.Load())
+	}
+
+	// Once expired, upstream is asked again.
+	cachedResponsesMu.Lock()
+	cached := cachedResponses[url]
+	cached.expire = time.Now().Unix() - 1
+	cachedResponses[url] = cached
+	cachedResponsesMu.Unlock()
+	if err := fetch(); err == nil || requests.Load() != 2 {
+		t.Fatalf("expected a new request after expiry, found %v after %d requests", err, requests.Load())
+	}
+}
+
+func TestZigCachedVerifiedRemovesFailed(t *testing.T) {
+	t.Chdir(t.TempDir())
+	publicKey, minisig := testMinisign(t, []byte("the real download"), "file:zig-0.13.0.tar.xz", true)
+	b := &Bot{Config: &Config{WrenchDir: t.TempDir(), ZigPublicKey: publicKey}}
+
+	filePath := path.Join("cache/zig", "stable", "0.13.0", "zig-0.13.0.tar.xz")
+	if err := os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte("a tampered download"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath+".minisig", minisig, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b.pkgCacheTouch(filePath)
+	b.pkgCacheTouch(filePath + ".minisig")
+
+	if b.zigCachedVerified("0.13.0", "stable", "zig-0.13.0.tar.xz") {
+		t.Fatal("expected a tampered download not to be served")
+	}
+	for _, p := range []string{filePath, filePath + ".minisig"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, found %v", p, err)
+		}
+		pkgCacheAccessMu.Lock()
+		_, ok := pkgCacheAccess[p]
+		pkgCacheAccessMu.Unlock()
+		if ok {
+			t.Errorf("expected the access time of %s to be forgotten", p)
+		}
+	}
+}
+
+func TestHttpPkgRoot(t *testing.T) {
+	b := &Bot{Config: &Config{
+		Mode:         "pkg",
+		ExternalURL:  "https://pkg.example.com",
+		ZigUpstreams: ZigUpstreamConfig{Dev: []string{"https://zig.mirror.example.com/builds/$FILE"}},
+		PkgUpstreams: []PkgUpstreamConfig{{Prefix: "acme", Archive: []string{"https://git.example.com/acme/$PROJECT/$FILE"}}},
+	}}
+	w := httptest.NewRecorder()
+	if err := b.httpPkgRoot(w, httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"<strong>https://zig.mirror.example.com/builds/$FILE</strong> -> <strong>https://pkg.example.com/zig/$FILE</strong> (other dev builds)",
+		"<strong>https://git.example.com/acme/$PROJECT/$FILE</strong> -> <strong>https://pkg.example.com/acme/$PROJECT/$FILE</strong>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected page to contain %q, found:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "ziglang.org/builds") {
+		t.Errorf("expected only the configured Zig upstreams, found:\n%s", body)
+	}
+}
@@ -0,0 +1,290 @@
+package wrench
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+// StatsQuery filters stats by time range and metadata.
+type StatsQuery struct {
+	// (optional) Only stats recorded at or after Since, and before Until.
+	Since, Until time.Time
+
+	// (optional) Only stats whose metadata has all of these values, e.g. {"runner": "linux"}.
+	Metadata map[string]string
+}
+
+// statsQueryMetadataParams are shorthand query parameters for common metadata keys. Any other
+// metadata key can be matched with meta.<key>=<value>.
+var statsQueryMetadataParams = map[string]string{
+	"runner": "runner",
+	"arch":   "arch",
+	"zig":    "zig version",
+}
+
+// parseStatsQuery parses a StatsQuery from URL query parameters:
+//
+//	since=2024-01-02 (or RFC3339)
+//	until=2024-02-01T00:00:00Z
+//	runner=linux, arch=linux/amd64, zig=0.12.0-dev.170+750998eef
+//	meta.<key>=<value>
+func parseStatsQuery(values url.Values) (StatsQuery, error) {
+	query := StatsQuery{Metadata: map[string]string{}}
+	parseTime := func(name string) (time.Time, error) {
+		v := values.Get(name)
+		if v == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse("2006-01-02", v); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s time %q, expected YYYY-MM-DD or RFC3339", name, v)
+		}
+		return t, nil
+	}
+	var err error
+	if query.Since, err = parseTime("since"); err != nil {
+		return query, err
+	}
+	if query.Until, err = parseTime("until"); err != nil {
+		return query, err
+	}
+	for param, key := range statsQueryMetadataParams {
+		if v := values.Get(param); v != "" {
+			query.Metadata[key] = v
+		}
+	}
+	for param := range values {
+		if key, ok := strings.CutPrefix(param, "meta."); ok {
+			query.Metadata[key] = values.Get(param)
+		}
+	}
+	return query, nil
+}
+
+func (q StatsQuery) match(stat api.Stat) bool {
+	if !q.Since.IsZero() && stat.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !stat.Time.Before(q.Until) {
+		return false
+	}
+	for key, value := range q.Metadata {
+		if v, ok := stat.Metadata[key]; !ok || fmt.Sprint(v) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bot) queryStats(r *http.Request, id string, query StatsQuery) ([]api.Stat, error) {
+	stats, err := b.store.Stats(r.Context(), id)
+	if err != nil {
+		return nil, errors.Wrap(err, "Stats")
+	}
+	matching := stats[:0]
+	for _, stat := range stats {
+		if query.match(stat) {
+			matching = append(matching, stat)
+		}
+	}
+	return matching, nil
+}
+
+// httpServeStatsAPI serves /api/stats/<id>, the raw stats series as JSON (or CSV with
+// format=csv), filtered by the parameters described in parseStatsQuery.
+func (b *Bot) httpServeStatsAPI(w http.ResponseWriter, r *http.Request) error {
+	_, id := path.Split(r.URL.Path)
+	if id == "" {
+		return errors.New("expected /api/stats/<id>")
+	}
+	query, err := parseStatsQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "error: %s", err)
+		return nil
+	}
+	stats, err := b.queryStats(r, id, query)
+	if err != nil {
+		return err
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		return errors.Wrap(json.NewEncoder(w).Encode(api.StatsResponse{ID: id, Stats: stats}), "Encode")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".csv"))
+		return writeStatsCSV(w, stats)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "error: unknown format %q, expected json or csv", format)
+		return nil
+	}
+}
+
+// writeStatsCSV writes stats as CSV, with a column for each metadata key.
+func writeStatsCSV(w io.Writer, stats []api.Stat) error {
+	keySet := map[string]struct{}{}
+	for _, stat := range stats {
+		for key := range stat.Metadata {
+			keySet[key] = struct{}{}
+		}
+	}
+	var keys []string
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write(append([]string{"time", "id", "value", "type"}, keys...))
+	for _, stat := range stats {
+		record := []string{
+			stat.Time.UTC().Format(time.RFC3339),
+			stat.ID,
+			strconv.FormatInt(stat.Value, 10),
+			stat.Type,
+		}
+		for _, key := range keys {
+			v, ok := stat.Metadata[key]
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, fmt.Sprint(v))
+		}
+		_ = cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// httpServeStats serves /stats/<id>, a graph of a stat. Further stats to overlay can be given
+// with id=<id> parameters, and each series can be split by a metadata key with split=<key> (e.g.
+// split=runner to compare runners.) The parameters described in parseStatsQuery filter the
+// stats.
+func (b *Bot) httpServeStats(w http.ResponseWriter, r *http.Request) error {
+	_, id := path.Split(r.URL.Path)
+	var ids []string
+	if id != "" {
+		ids = append(ids, id)
+	}
+	ids = append(ids, r.URL.Query()["id"]...)
+	if len(ids) == 0 {
+		statIDs, err := b.store.StatIDs(r.Context())
+		if err != nil {
+			return errors.Wrap(err, "StatIDs")
+		}
+		return b.render(w, r, "stats_index", "Stats", statIDs)
+	}
+	query, err := parseStatsQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "error: %s", err)
+		return nil
+	}
+	split := r.URL.Query().Get("split")
+
+	// Each series is a stat ID, or a stat ID and value of the split metadata key.
+	type point struct {
+		series int
+		stat   api.Stat
+	}
+	var (
+		labels = []string{"Date"}
+		points []point
+	)
+	for _, id := range ids {
+		stats, err := b.queryStats(r, id, query)
+		if err != nil {
+			return err
+		}
+		seriesByValue := map[string]int{}
+		for _, stat := range stats {
+			name := id
+			if split != "" {
+				name = fmt.Sprintf("%s (%s=%v)", id, split, stat.Metadata[split])
+			}
+			series, ok := seriesByValue[name]
+			if !ok {
+				series = len(labels) - 1
+				seriesByValue[name] = series
+				labels = append(labels, name)
+			}
+			points = append(points, point{series: series, stat: stat})
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].stat.Time.Before(points[j].stat.Time)
+	})
+
+	// Each series has the unit of its own stats. The y axis only gets a unit if all series
+	// agree on it.
+	units := make([]string, len(labels)-1)
+	var data [][]any
+	var metadata []map[string]any
+	for index, p := range points {
+		stat := p.stat
+		row := make([]any, len(labels))
+		row[0] = index
+		row[p.series+1] = stat.Value
+		data = append(data, row)
+		meta := stat.Metadata
+		if meta == nil {
+			meta = map[string]any{}
+		}
+		meta["label"] = fmt.Sprintf("%v", meta)
+		if v, ok := meta["zig version"].(string); ok {
+			meta["label"] = v[strings.LastIndex(v, "."):]
+		}
+		units[p.series] = stat.Type
+		meta["time"] = stat.Time.UTC().String()
+		meta["series"] = labels[p.series+1]
+		metadata = append(metadata, meta)
+	}
+
+	unit := ""
+	for i, u := range units {
+		if i == 0 {
+			unit = u
+		} else if u != unit {
+			unit = ""
+			break
+		}
+	}
+
+	type link struct{ ID, URL string }
+	var links []link
+	for _, id := range ids {
+		links = append(links, link{
+			ID:  id,
+			URL: b.Config.ExternalURL + "/api/stats/" + url.PathEscape(id) + "?" + r.URL.RawQuery,
+		})
+	}
+	return b.render(w, r, "stats", strings.Join(ids, ", "), map[string]any{
+		"Links": links,
+		"Chart": map[string]any{
+			"series":   labels[1:],
+			"data":     data,
+			"metadata": metadata,
+			"units":    units,
+			"unit":     unit,
+		},
+	})
+}
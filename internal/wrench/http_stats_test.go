@@ -0,0 +1,64 @@
+package wrench
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func TestHttpServeStatsAPI(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{}}
+		day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, runner := range []string{"linux", "mac", "linux"} {
+			if err := s.RecordStat(ctx, api.Stat{
+				ID:       "build-time",
+				Type:     "ns",
+				Time:     day.Add(time.Duration(i) * 24 * time.Hour),
+				Value:    int64(i + 1),
+				Metadata: map[string]any{"runner": runner},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		get := func(target string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			if err := b.httpServeStatsAPI(w, httptest.NewRequest("GET", target, nil)); err != nil {
+				t.Fatal(err)
+			}
+			return w
+		}
+
+		w := get("/api/stats/build-time?runner=linux&since=2024-01-02")
+		if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+			t.Fatalf("unexpected content type %q", got)
+		}
+		var resp api.StatsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.ID != "build-time" || len(resp.Stats) != 1 || resp.Stats[0].Value != 3 {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+
+		w = get("/api/stats/build-time?format=csv&runner=mac")
+		want := "time,id,value,type,runner\n2024-01-02T00:00:00Z,build-time,2,ns,mac\n"
+		if got := w.Body.String(); got != want {
+			t.Fatalf("got CSV %q, want %q", got, want)
+		}
+
+		for _, target := range []string{
+			"/api/stats/build-time?format=xml",
+			"/api/stats/build-time?since=yesterday",
+		} {
+			if w := get(target); w.Code != 400 {
+				t.Errorf("%s: got status %d, want 400", target, w.Code)
+			}
+		}
+	})
+}
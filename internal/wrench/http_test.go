@@ -0,0 +1,108 @@
+package wrench
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func TestRunnerJobUpdateAssignedRunner(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{}}
+		id, err := s.NewRunnerJob(ctx, api.Job{Title: "build", Payload: api.JobPayload{Cmd: []string{"echo"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		update := func(runnerID string, state api.JobState) error {
+			_, err := b.httpServeRunnerJobUpdate(ctx, &api.RunnerJobUpdateRequest{
+				ID:  runnerID,
+				Job: &api.RunnerJobUpdate{ID: id, State: state},
+			})
+			return err
+		}
+
+		// Not assigned to any runner yet.
+		if err := update("linux", api.JobStateRunning); err == nil {
+			t.Fatal("expected update of an unassigned job to be rejected")
+		}
+		job, err := s.JobByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.State, job.TargetRunnerID = api.JobStateStarting, "linux"
+		if err := s.UpsertRunnerJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		if err := update("mac", api.JobStateError); err == nil {
+			t.Fatal("expected update by another runner to be rejected")
+		}
+		if err := update("linux", api.JobStateRunning); err != nil {
+			t.Fatal(err)
+		}
+		if job, err := s.JobByID(ctx, id); err != nil || job.State != api.JobStateRunning {
+			t.Fatalf("expected job to be running, found %v %v", job.State, err)
+		}
+	})
+}
+
+func TestHttpStopWaitsForRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	b := &Bot{Config: &Config{ShutdownTimeoutSeconds: 1}}
+	started := make(chan struct{})
+	b.httpServe(&http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			_, _ = io.WriteString(w, "done")
+		}),
+	})
+	get := func(path string) (string, error) {
+		var resp *http.Response
+		var err error
+		for range 50 {
+			if resp, err = http.Get("http://" + addr + path); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond) // not listening yet
+		}
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// An in-flight request finishes before the server stops.
+	result := make(chan string, 1)
+	go func() {
+		body, err := get("/slow")
+		if err != nil {
+			body = err.Error()
+		}
+		result <- body
+	}()
+	<-started
+	if err := b.httpStop(); err != nil {
+		t.Fatal(err)
+	}
+	if body := <-result; body != "done" {
+		t.Fatalf("expected the in-flight request to finish, got %q", body)
+	}
+	if _, err := http.Get("http://" + addr + "/slow"); err == nil {
+		t.Fatal("expected the server to be stopped")
+	}
+}
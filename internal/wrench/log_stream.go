@@ -0,0 +1,202 @@
+package wrench
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+// logStream fans out log lines written via idLogf to live subscribers, such as the
+// /logs/stream/<id> Server-Sent Events endpoint. The zero value is ready to use.
+type logStream struct {
+	// idLocks serialize writing to and subscribing to a log, striped by a hash of the log ID, so
+	// that a slow store write or subscriber catch-up only holds up the logs sharing its lock.
+	idLocks [64]sync.Mutex
+
+	mu   sync.Mutex // guards subs
+	subs map[string]map[chan Log]struct{}
+}
+
+func (l *logStream) idLock(id string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return &l.idLocks[h.Sum32()%uint32(len(l.idLocks))]
+}
+
+// write calls store (which should persist the log line) and then publishes the stored line to all
+// subscribers of id. Both happen under the lock of id, so a subscriber's snapshot never misses or
+// duplicates a line. Lines which could not be stored are not published.
+func (l *logStream) write(id string, store func() (Log, error)) {
+	idLock := l.idLock(id)
+	idLock.Lock()
+	defer idLock.Unlock()
+	log, err := store()
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.subs[id] {
+		select {
+		case ch <- log:
+		default:
+			// The subscriber is not keeping up; drop it. EventSource clients will reconnect and
+			// resume from the last line they received.
+			delete(l.subs[id], ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe calls snapshot (which should read the persisted logs of id) and subscribes to new
+// lines written after it. The returned channel is closed if the subscriber falls behind.
+func (l *logStream) subscribe(id string, snapshot func() error) (<-chan Log, func(), error) {
+	idLock := l.idLock(id)
+	idLock.Lock()
+	defer idLock.Unlock()
+	if err := snapshot(); err != nil {
+		return nil, nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subs == nil {
+		l.subs = map[string]map[chan Log]struct{}{}
+	}
+	if l.subs[id] == nil {
+		l.subs[id] = map[chan Log]struct{}{}
+	}
+	ch := make(chan Log, 256)
+	l.subs[id][ch] = struct{}{}
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, ok := l.subs[id][ch]; ok {
+			delete(l.subs[id], ch)
+			close(ch)
+		}
+		if len(l.subs[id]) == 0 {
+			delete(l.subs, id)
+		}
+	}, nil
+}
+
+// jobFinished reports whether the job is in a final state.
+func jobFinished(state api.JobState) bool {
+	return state == api.JobStateSuccess || state == api.JobStateError
+}
+
+// logJobID returns the job ID for a job log ID (job-<id>), or false if id is not a job log.
+func logJobID(id string) (api.JobID, bool) {
+	if !strings.HasPrefix(id, "job-") {
+		return "", false
+	}
+	jobID := api.JobID(strings.TrimPrefix(id, "job-"))
+	return jobID, validJobID(jobID)
+}
+
+// httpServeLogsStream streams a log as Server-Sent Events: every line is sent as a message event
+// whose ID is the line's Log.ID, so that reconnecting clients (Last-Event-ID) resume where they
+// left off. Clients which already have some lines may start after them with ?after=<Log.ID>. For
+// job logs, a 'state' event is sent whenever the job state changes, and the stream
+// ends once the job finishes.
+func (b *Bot) httpServeLogsStream(w http.ResponseWriter, r *http.Request) error {
+	_, id := path.Split(r.URL.Path)
+	if id == "" {
+		return errors.New("expected log ID")
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming not supported")
+	}
+	lastEventID := int64(-1)
+	for _, v := range []string{r.URL.Query().Get("after"), r.Header.Get("Last-Event-ID")} {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			lastEventID = n
+		}
+	}
+
+	var logs []Log
+	live, unsubscribe, err := b.logStream.subscribe(id, func() (err error) {
+		logs, err = b.store.Logs(r.Context(), id)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "Logs")
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	writeLog := func(log Log) {
+		if log.ID <= lastEventID {
+			return
+		}
+		lastEventID = log.ID
+		_, _ = fmt.Fprintf(w, "id: %d\n", log.ID)
+		for _, line := range strings.Split(log.Time.UTC().Format(time.RFC3339)+" "+log.Message, "\n") {
+			_, _ = fmt.Fprintf(w, "data: %s\n", line)
+		}
+		_, _ = fmt.Fprintf(w, "\n")
+	}
+	for _, log := range logs {
+		writeLog(log)
+	}
+	flusher.Flush()
+
+	jobID, isJob := logJobID(id)
+	var lastState api.JobState
+	checkState := func() (finished bool) {
+		if !isJob {
+			return false
+		}
+		job, err := b.store.JobByID(r.Context(), jobID)
+		if err != nil {
+			return false
+		}
+		if job.State != lastState {
+			lastState = job.State
+			_, _ = fmt.Fprintf(w, "event: state\ndata: %s\n\n", job.State)
+		}
+		return jobFinished(job.State)
+	}
+	if checkState() {
+		flusher.Flush()
+		return nil
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-b.httpShutdown:
+			return nil
+		case log, ok := <-live:
+			if !ok {
+				return nil
+			}
+			writeLog(log)
+		case <-ticker.C:
+			if checkState() {
+				flusher.Flush()
+				return nil
+			}
+			// Keep the connection alive through proxies.
+			_, _ = fmt.Fprintf(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,79 @@
+package wrench
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func TestLogsStreamResume(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{}}
+		id, err := s.NewRunnerJob(ctx, api.Job{Title: "build", Payload: api.JobPayload{Cmd: []string{"echo"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range []string{"one", "two", "three"} {
+			b.idLogf(id.LogID(), "%s", msg)
+		}
+		job, err := s.JobByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.State = api.JobStateSuccess
+		if err := s.UpsertRunnerJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		logs, err := s.Logs(ctx, id.LogID())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stream := func(url, lastEventID string) string {
+			r := httptest.NewRequest("GET", url, nil)
+			if lastEventID != "" {
+				r.Header.Set("Last-Event-ID", lastEventID)
+			}
+			w := httptest.NewRecorder()
+			if err := b.httpServeLogsStream(w, r); err != nil {
+				t.Fatal(err)
+			}
+			return w.Body.String()
+		}
+		messages := func(body string) (ids, data []string) {
+			for _, line := range strings.Split(body, "\n") {
+				if v, ok := strings.CutPrefix(line, "id: "); ok {
+					ids = append(ids, v)
+				}
+				if v, ok := strings.CutPrefix(line, "data: "); ok {
+					data = append(data, v[strings.Index(v, " ")+1:])
+				}
+			}
+			return ids, data
+		}
+
+		ids, data := messages(stream("/logs/stream/"+id.LogID(), ""))
+		// The lines, then the final job state.
+		if strings.Join(data, ",") != "one,two,three,success" {
+			t.Fatalf("expected all lines, found %q", data)
+		}
+		for i, log := range logs {
+			if ids[i] != strconv.FormatInt(log.ID, 10) {
+				t.Fatalf("expected event IDs to be log IDs, found %q for %+v", ids, logs)
+			}
+		}
+
+		// Reconnecting clients and pages which already show some lines get only the rest.
+		if _, data := messages(stream("/logs/stream/"+id.LogID(), ids[0])); strings.Join(data, ",") != "two,three,success" {
+			t.Fatalf("Last-Event-ID: expected the lines after the first, found %q", data)
+		}
+		if _, data := messages(stream("/logs/stream/"+id.LogID()+"?after="+ids[1], "")); strings.Join(data, ",") != "three,success" {
+			t.Fatalf("after: expected the lines after the second, found %q", data)
+		}
+	})
+}
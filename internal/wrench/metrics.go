@@ -0,0 +1,216 @@
+package wrench
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics updated as things happen. Metrics derived from the store (jobs, runners) are instead
+// computed when scraped, see jobsCollector.
+var (
+	metricJobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wrench_job_duration_seconds",
+		Help:    "Time jobs took to run, from starting until they finished.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 16), // 1s to ~9h
+	}, []string{"title", "state"})
+	metricJobQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wrench_job_queue_wait_seconds",
+		Help:    "Time jobs waited to be assigned to a runner.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 16),
+	}, []string{"title"})
+	metricGitHubRateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "wrench_github_rate_limit_remaining",
+		Help: "GitHub API requests remaining in the current rate limit window, as of the last sync.",
+	})
+	metricGitHubRateLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "wrench_github_rate_limit",
+		Help: "GitHub API requests allowed per rate limit window, as of the last sync.",
+	})
+	metricPkgCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wrench_pkg_cache_requests_total",
+		Help: "pkg/zig proxy requests for files, by whether they were already cached.",
+	}, []string{"kind", "result"})
+	metricPkgBytesServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wrench_pkg_served_bytes_total",
+		Help: "Bytes served by the pkg/zig proxy.",
+	}, []string{"kind"})
+	metricPkgUpstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wrench_pkg_upstream_errors_total",
+		Help: "Errors fetching files from upstream in the pkg/zig proxy.",
+	}, []string{"kind"})
+	metricPkgRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wrench_pkg_rejected_total",
+		Help: "pkg/zig proxy requests rejected by PkgLimits, by the limit hit (client, global, project or size).",
+	}, []string{"kind", "limit"})
+	metricPkgZigVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wrench_pkg_zig_verifications_total",
+		Help: "Zig downloads verified against their minisign signature, by result (verified, unsigned or failed).",
+	}, []string{"result"})
+	metricPkgUpstreamUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wrench_pkg_upstream_up",
+		Help: "Whether a pkg/zig proxy upstream is up (1) or down (0), as of the last request or health check.",
+	}, []string{"upstream"})
+	metricPkgCacheBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wrench_pkg_cache_bytes",
+		Help: "Size of the pkg/zig proxy caches on disk, as of the last eviction check.",
+	}, []string{"kind"})
+	metricPkgCacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wrench_pkg_cache_evictions_total",
+		Help: "Files evicted from the pkg/zig proxy caches to stay within their size limits.",
+	}, []string{"kind"})
+)
+
+// metricsHandler serves /metrics in the Prometheus format.
+func (b *Bot) metricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metricPkgCacheRequests,
+		metricPkgBytesServed,
+		metricPkgUpstreamErrors,
+		metricPkgRejected,
+		metricPkgZigVerifications,
+		metricPkgUpstreamUp,
+		metricPkgCacheBytes,
+		metricPkgCacheEvictions,
+	)
+	if b.Config.ModeType() == ModeWrench {
+		registry.MustRegister(
+			metricJobDuration,
+			metricJobQueueWait,
+			metricGitHubRateLimitRemaining,
+			metricGitHubRateLimit,
+			&jobsCollector{b: b},
+		)
+	}
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+var (
+	jobsDesc = prometheus.NewDesc(
+		"wrench_jobs",
+		"Number of jobs, by state and title.",
+		[]string{"state", "title"}, nil,
+	)
+	runnerLastSeenDesc = prometheus.NewDesc(
+		"wrench_runner_last_seen_seconds",
+		"Seconds since the runner last polled for jobs.",
+		[]string{"runner", "arch"}, nil,
+	)
+	runnerRunningJobsDesc = prometheus.NewDesc(
+		"wrench_runner_running_jobs",
+		"Number of jobs the runner is starting or running.",
+		[]string{"runner", "arch"}, nil,
+	)
+)
+
+// jobsCollector reports job and runner metrics from the store when scraped.
+type jobsCollector struct {
+	b *Bot
+}
+
+func (c *jobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jobsDesc
+	ch <- runnerLastSeenDesc
+	ch <- runnerRunningJobsDesc
+}
+
+func (c *jobsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	counts, err := c.b.store.JobCounts(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(jobsDesc, err)
+	}
+	type jobsKey struct{ state, title string }
+	byKey := map[jobsKey]int64{}
+	for _, count := range counts {
+		byKey[jobsKey{string(count.State), c.b.metricJobTitle(count.Title)}] += count.Count
+	}
+	for key, count := range byKey {
+		ch <- prometheus.MustNewConstMetric(jobsDesc, prometheus.GaugeValue, float64(count), key.state, key.title)
+	}
+
+	runners, err := c.b.store.Runners(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(runnerLastSeenDesc, err)
+		return
+	}
+	running, err := c.b.store.Jobs(ctx,
+		JobsFilter{NotState: api.JobStateSuccess},
+		JobsFilter{NotState: api.JobStateError},
+		JobsFilter{NotState: api.JobStateReady},
+	)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(runnerRunningJobsDesc, err)
+		return
+	}
+	for _, runner := range runners {
+		ch <- prometheus.MustNewConstMetric(runnerLastSeenDesc, prometheus.GaugeValue, time.Since(runner.LastSeenAt).Seconds(), runner.ID, runner.Arch)
+		n := 0
+		for _, job := range running {
+			if job.TargetRunnerID == runner.ID {
+				n++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(runnerRunningJobsDesc, prometheus.GaugeValue, float64(n), runner.ID, runner.Arch)
+	}
+}
+
+// metricJobTitle returns the title label to use for a job. Job titles can be chosen freely (e.g.
+// 'wrench jobs run'), so only the titles of scheduled jobs are used as-is and all others are
+// reported as "other", to keep the number of series bounded.
+func (b *Bot) metricJobTitle(title string) string {
+	for _, scheduled := range b.schedule {
+		if scheduled.Job.Title == title {
+			return title
+		}
+	}
+	return "other"
+}
+
+// metricsObserveJobState records job duration metrics after a job changed state.
+func (b *Bot) metricsObserveJobState(ctx context.Context, job api.Job) {
+	events, err := b.store.JobEvents(ctx, job.ID)
+	if err != nil {
+		return
+	}
+	var queuedAt, startedAt time.Time
+	for _, e := range events {
+		switch e.State {
+		case api.JobStateReady:
+			queuedAt = e.Time
+		case api.JobStateStarting:
+			startedAt = e.Time
+		}
+	}
+	if job.ScheduledStart.After(queuedAt) {
+		queuedAt = job.ScheduledStart
+	}
+	switch {
+	case job.State == api.JobStateStarting && !queuedAt.IsZero():
+		metricJobQueueWait.WithLabelValues(b.metricJobTitle(job.Title)).Observe(time.Since(queuedAt).Seconds())
+	case jobFinished(job.State) && !startedAt.IsZero():
+		metricJobDuration.WithLabelValues(b.metricJobTitle(job.Title), string(job.State)).Observe(time.Since(startedAt).Seconds())
+	}
+}
+
+// countingResponseWriter counts the bytes of the response body written.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	counter prometheus.Counter
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.counter.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,45 @@
+package wrench
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestJobsCollectorTitles(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		b := &Bot{store: s, Config: &Config{}, schedule: []ScheduledJob{{Job: api.Job{ID: "nightly", Title: "nightly"}}}}
+		for _, title := range []string{"nightly", "script foo a", "script foo b"} {
+			if _, err := s.NewRunnerJob(ctx, api.Job{Title: title}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ch := make(chan prometheus.Metric, 100)
+		(&jobsCollector{b: b}).Collect(ch)
+		close(ch)
+		got := map[string]float64{}
+		for m := range ch {
+			if m.Desc() != jobsDesc {
+				continue
+			}
+			var pb dto.Metric
+			if err := m.Write(&pb); err != nil {
+				t.Fatal(err)
+			}
+			for _, l := range pb.GetLabel() {
+				if l.GetName() == "title" {
+					got[l.GetValue()] += pb.GetGauge().GetValue()
+				}
+			}
+		}
+		want := map[string]float64{"nightly": 1, "other": 2}
+		if len(got) != len(want) || got["nightly"] != want["nightly"] || got["other"] != want["other"] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	})
+}
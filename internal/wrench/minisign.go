@@ -0,0 +1,135 @@
+package wrench
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hexops/wrench/internal/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+// zsfPublicKey is the minisign public key of the Zig Software Foundation, which Zig releases and
+// builds are signed with. See https://ziglang.org/download
+const zsfPublicKey = "RWSGOq2NVecA2UPNdBUZykf1CCb147pkmdtYxgb3Ti+JO/wCYvhbAb/U"
+
+// minisignPublicKey is a minisign (https://jedisct1.github.io/minisign/) Ed25519 public key.
+type minisignPublicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+// parseMinisignPublicKey parses a base64 public key, as found on the second line of a minisign
+// .pub file.
+func parseMinisignPublicKey(s string) (minisignPublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return minisignPublicKey{}, errors.Wrap(err, "decoding public key")
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize {
+		return minisignPublicKey{}, fmt.Errorf("invalid public key length %d", len(raw))
+	}
+	if string(raw[:2]) != "Ed" {
+		return minisignPublicKey{}, fmt.Errorf("unsupported public key algorithm %q", raw[:2])
+	}
+	var pk minisignPublicKey
+	copy(pk.keyID[:], raw[2:10])
+	pk.key = ed25519.PublicKey(raw[10:])
+	return pk, nil
+}
+
+// minisignSignature is a parsed .minisig file.
+type minisignSignature struct {
+	// algorithm is "Ed" (the signature is of the file itself) or "ED" (the signature is of the
+	// BLAKE2b-512 hash of the file.)
+	algorithm      string
+	keyID          [8]byte
+	signature      []byte
+	trustedComment string
+
+	// globalSignature is the signature of signature and trustedComment together.
+	globalSignature []byte
+}
+
+// parseMinisignSignature parses the contents of a .minisig file.
+func parseMinisignSignature(data []byte) (minisignSignature, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if len(lines) < 4 {
+		return minisignSignature{}, errors.New("invalid signature: expected 4 lines")
+	}
+	if !strings.HasPrefix(lines[0], "untrusted comment: ") {
+		return minisignSignature{}, errors.New("invalid signature: missing untrusted comment")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return minisignSignature{}, errors.Wrap(err, "decoding signature")
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return minisignSignature{}, fmt.Errorf("invalid signature length %d", len(raw))
+	}
+	trustedComment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return minisignSignature{}, errors.New("invalid signature: missing trusted comment")
+	}
+	globalSignature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return minisignSignature{}, errors.Wrap(err, "decoding global signature")
+	}
+	if len(globalSignature) != ed25519.SignatureSize {
+		return minisignSignature{}, fmt.Errorf("invalid global signature length %d", len(globalSignature))
+	}
+	sig := minisignSignature{
+		algorithm:       string(raw[:2]),
+		signature:       raw[10:],
+		trustedComment:  trustedComment,
+		globalSignature: globalSignature,
+	}
+	copy(sig.keyID[:], raw[2:10])
+	if sig.algorithm != "Ed" && sig.algorithm != "ED" {
+		return minisignSignature{}, fmt.Errorf("unsupported signature algorithm %q", sig.algorithm)
+	}
+	return sig, nil
+}
+
+// verify checks that sig is a valid signature of the contents of r by pk.
+func (pk minisignPublicKey) verify(sig minisignSignature, r io.Reader) error {
+	if sig.keyID != pk.keyID {
+		return fmt.Errorf("signed by key %X, expected key %X", reverse(sig.keyID[:]), reverse(pk.keyID[:]))
+	}
+	var message []byte
+	if sig.algorithm == "ED" {
+		h, err := blake2b.New512(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(h, r); err != nil {
+			return errors.Wrap(err, "reading")
+		}
+		message = h.Sum(nil)
+	} else {
+		var err error
+		if message, err = io.ReadAll(r); err != nil {
+			return errors.Wrap(err, "reading")
+		}
+	}
+	if !ed25519.Verify(pk.key, message, sig.signature) {
+		return errors.New("signature verification failed")
+	}
+	global := append(bytes.Clone(sig.signature), sig.trustedComment...)
+	if !ed25519.Verify(pk.key, global, sig.globalSignature) {
+		return errors.New("trusted comment signature verification failed")
+	}
+	return nil
+}
+
+// reverse returns a reversed copy of b. minisign displays key IDs as little-endian numbers.
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package wrench
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testMinisign signs file like 'minisign -S' would, returning the public key and the .minisig
+// file. If prehash, the file's BLAKE2b-512 hash is signed (as by default since minisign 0.11.)
+func testMinisign(t *testing.T, file []byte, trustedComment string, prehash bool) (string, []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	algorithm, message := "Ed", file
+	if prehash {
+		hash := blake2b.Sum512(file)
+		algorithm, message = "ED", hash[:]
+	}
+	signature := ed25519.Sign(priv, message)
+	globalSignature := ed25519.Sign(priv, append(bytes.Clone(signature), trustedComment...))
+
+	publicKey := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...))
+	minisig := fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), keyID...), signature...)),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(globalSignature),
+	)
+	return publicKey, []byte(minisig)
+}
+
+func TestMinisignVerify(t *testing.T) {
+	if _, err := parseMinisignPublicKey(zsfPublicKey); err != nil {
+		t.Fatalf("parsing the Zig Software Foundation key: %v", err)
+	}
+
+	file := []byte("zig-0.13.0.tar.xz contents")
+	for _, prehash := range []bool{true, false} {
+		publicKey, minisig := testMinisign(t, file, "timestamp:1717974431\tfile:zig-0.13.0.tar.xz\thashed", prehash)
+		pk, err := parseMinisignPublicKey(publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := parseMinisignSignature(minisig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pk.verify(sig, bytes.NewReader(file)); err != nil {
+			t.Fatalf("prehash=%v: expected valid signature, got %v", prehash, err)
+		}
+		if err := pk.verify(sig, bytes.NewReader(append(bytes.Clone(file), '!'))); err == nil {
+			t.Fatalf("prehash=%v: expected tampered file to fail verification", prehash)
+		}
+
+		tampered, err := parseMinisignSignature([]byte(strings.Replace(string(minisig), "file:zig-0.13.0.tar.xz", "file:zig-0.12.0.tar.xz", 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pk.verify(tampered, bytes.NewReader(file)); err == nil {
+			t.Fatalf("prehash=%v: expected tampered trusted comment to fail verification", prehash)
+		}
+
+		otherKey, _ := testMinisign(t, file, "", prehash)
+		other, err := parseMinisignPublicKey(otherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := other.verify(sig, bytes.NewReader(file)); err == nil {
+			t.Fatalf("prehash=%v: expected signature by another key to fail verification", prehash)
+		}
+	}
+
+	if _, err := parseMinisignSignature([]byte("not a signature")); err == nil {
+		t.Fatal("expected error parsing invalid signature")
+	}
+}
@@ -0,0 +1,398 @@
+package wrench
+
+import (
+	"cmp"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/natefinch/atomic"
+)
+
+const pkgCacheLogID = "cache"
+
+// pkgCacheMinAge is how long a file must not have been accessed before it may be evicted, so that
+// a file is not evicted while it is likely still being downloaded by clients.
+const pkgCacheMinAge = 10 * time.Minute
+
+// pkgCache is one of the pkg/zig proxy caches on disk.
+type pkgCache struct {
+	kind string // "zig", "pkg" or "artifact", as in metrics
+	dir  string
+	mib  func(PkgCacheConfig) int
+}
+
+var pkgCaches = []pkgCache{
+	{kind: "zig", dir: "cache/zig", mib: func(c PkgCacheConfig) int { return c.ZigMiB }},
+	{kind: "pkg", dir: "cache/pkg", mib: func(c PkgCacheConfig) int { return c.PkgMiB }},
+	{kind: "artifact", dir: "cache/pkg-artifact", mib: func(c PkgCacheConfig) int { return c.ArtifactMiB }},
+}
+
+// quotaBytes returns the size limit of the cache, or -1 if unlimited.
+func (c pkgCache) quotaBytes(cfg PkgCacheConfig) int64 {
+	if mib := c.mib(cfg); mib > 0 {
+		return int64(mib) * 1024 * 1024
+	}
+	return -1
+}
+
+// Last access times of cached files by path, persisted in pkg-cache-access.json. They are saved
+// periodically rather than on every access. Files without one have not been served since they
+// were cached, and their modification time is used instead.
+var (
+	pkgCacheAccessMu     sync.Mutex
+	pkgCacheAccessLoaded bool
+	pkgCacheAccessDirty  bool
+	pkgCacheAccess       map[string]time.Time
+)
+
+func (b *Bot) pkgCacheAccessPath() string {
+	return filepath.Join(b.Config.WrenchDir, "pkg-cache-access.json")
+}
+
+// pkgCacheAccessLoad loads pkg-cache-access.json, if it has not been loaded yet. The caller must
+// hold pkgCacheAccessMu.
+func (b *Bot) pkgCacheAccessLoad() {
+	if pkgCacheAccessLoaded {
+		return
+	}
+	pkgCacheAccess = map[string]time.Time{}
+	data, err := os.ReadFile(b.pkgCacheAccessPath())
+	if err != nil && !os.IsNotExist(err) {
+		b.idLogf(pkgCacheLogID, "%v", err)
+	} else if err == nil {
+		if err := json.Unmarshal(data, &pkgCacheAccess); err != nil {
+			b.idLogf(pkgCacheLogID, "%v", err)
+		}
+	}
+	pkgCacheAccessLoaded = true
+}
+
+// pkgCacheTouch records that the cached file was accessed now.
+func (b *Bot) pkgCacheTouch(filePath string) {
+	pkgCacheAccessMu.Lock()
+	defer pkgCacheAccessMu.Unlock()
+	b.pkgCacheAccessLoad()
+	pkgCacheAccess[filePath] = time.Now().Truncate(time.Second)
+	pkgCacheAccessDirty = true
+}
+
+// pkgCacheForgetAccess removes the access times of files no longer cached.
+func (b *Bot) pkgCacheForgetAccess(filePaths ...string) {
+	pkgCacheAccessMu.Lock()
+	defer pkgCacheAccessMu.Unlock()
+	b.pkgCacheAccessLoad()
+	for _, filePath := range filePaths {
+		delete(pkgCacheAccess, filePath)
+	}
+	pkgCacheAccessDirty = true
+}
+
+// pkgCacheAccessSave writes pkg-cache-access.json, if access times changed since it was last
+// written.
+func (b *Bot) pkgCacheAccessSave() {
+	pkgCacheAccessMu.Lock()
+	defer pkgCacheAccessMu.Unlock()
+	if !pkgCacheAccessDirty {
+		return
+	}
+	data, err := json.MarshalIndent(pkgCacheAccess, "", "  ")
+	if err != nil {
+		b.idLogf(pkgCacheLogID, "%v", err)
+		return
+	}
+	if err := atomic.WriteFile(b.pkgCacheAccessPath(), strings.NewReader(string(data))); err != nil {
+		b.idLogf(pkgCacheLogID, "%v", err)
+		return
+	}
+	pkgCacheAccessDirty = false
+}
+
+// pkgCacheFile is a file in a pkg/zig proxy cache.
+type pkgCacheFile struct {
+	path string
+
+	// size includes the .minisig signature of Zig downloads, which is evicted together with the
+	// download.
+	size       int64
+	lastAccess time.Time
+
+	// group is "stable", "mach" or "dev" for Zig downloads, and otherwise the project.
+	group     string
+	evictable bool
+
+	// tier orders eviction: evictable files of lower tiers are all evicted before those of higher
+	// tiers, least recently accessed first within a tier. Zig dev versions are tier 0, and
+	// versions no longer nominated by Mach tier 1, as they are more likely to still be in use.
+	tier int
+}
+
+// pkgCacheFiles lists the files in the cache.
+func (b *Bot) pkgCacheFiles(c pkgCache) ([]*pkgCacheFile, error) {
+	files := map[string]*pkgCacheFile{}
+	err := filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == c.dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".download-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		p = filepath.ToSlash(p)
+		group, _, _ := strings.Cut(strings.TrimPrefix(p, c.dir+"/"), "/")
+		files[p] = &pkgCacheFile{path: p, size: info.Size(), lastAccess: info.ModTime(), group: group, evictable: true}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c.kind == "zig" {
+		// Mach-nominated versions are only evictable once they are no longer nominated, in which
+		// case they are no longer served from cache/zig/mach either.
+		var index map[string]map[string]any
+		if indexFile, err := b.httpPkgZigIndexCached(); err != nil {
+			b.idLogf(pkgCacheLogID, "not evicting Mach-nominated Zig versions: %v", err)
+		} else if err := json.Unmarshal(indexFile, &index); err != nil {
+			b.idLogf(pkgCacheLogID, "not evicting Mach-nominated Zig versions: %v", err)
+		}
+		for p, f := range files {
+			if download, ok := files[strings.TrimSuffix(p, ".minisig")]; ok && download != f {
+				download.size += f.size
+				delete(files, p)
+				continue
+			}
+			switch f.group {
+			case "dev":
+			case "mach":
+				version := path.Base(path.Dir(p))
+				kind, err := b.zigVersionKind(version, index)
+				f.evictable = index != nil && err == nil && kind != "mach"
+				f.tier = 1
+			default:
+				f.evictable = false
+			}
+		}
+	}
+
+	pkgCacheAccessMu.Lock()
+	b.pkgCacheAccessLoad()
+	for p, f := range files {
+		if t, ok := pkgCacheAccess[p]; ok && t.After(f.lastAccess) {
+			f.lastAccess = t
+		}
+	}
+	pkgCacheAccessMu.Unlock()
+
+	list := make([]*pkgCacheFile, 0, len(files))
+	for _, f := range files {
+		list = append(list, f)
+	}
+	slices.SortFunc(list, func(a, b *pkgCacheFile) int {
+		return cmp.Or(a.lastAccess.Compare(b.lastAccess), cmp.Compare(a.path, b.path))
+	})
+	return list, nil
+}
+
+// pkgCacheEvictionOrder returns the files which may be evicted now, in the order they should be:
+// by tier, and least recently accessed first within a tier. files must be sorted by last access,
+// as returned by pkgCacheFiles.
+func pkgCacheEvictionOrder(files []*pkgCacheFile, now time.Time) []*pkgCacheFile {
+	var order []*pkgCacheFile
+	for _, f := range files {
+		if f.evictable && now.Sub(f.lastAccess) >= pkgCacheMinAge {
+			order = append(order, f)
+		}
+	}
+	slices.SortStableFunc(order, func(a, b *pkgCacheFile) int { return cmp.Compare(a.tier, b.tier) })
+	return order
+}
+
+// pkgCacheEvictions counts the files evicted from a cache since wrench started.
+type pkgCacheEvictions struct {
+	Files int
+	Bytes int64
+	Last  time.Time
+}
+
+var (
+	pkgCacheEvictMu     sync.Mutex
+	pkgCacheEvictSignal = make(chan struct{}, 1)
+	pkgCacheEvicted     = map[string]pkgCacheEvictions{}
+)
+
+// pkgCacheStart evicts files from the caches every few minutes, or soon after a file was cached,
+// see pkgCacheEvictSoon.
+func (b *Bot) pkgCacheStart() {
+	go func() {
+		for {
+			b.pkgCacheEvict()
+			select {
+			case <-pkgCacheEvictSignal:
+			case <-time.After(5 * time.Minute):
+			}
+		}
+	}()
+}
+
+// pkgCacheEvictSoon asks for the caches to be checked against their size limits, after a file
+// was added.
+func pkgCacheEvictSoon() {
+	select {
+	case pkgCacheEvictSignal <- struct{}{}:
+	default:
+	}
+}
+
+// pkgCacheEvict evicts files of each cache in pkgCacheEvictionOrder, until the cache is within its
+// size limit (Config.PkgCache.)
+func (b *Bot) pkgCacheEvict() {
+	pkgCacheEvictMu.Lock()
+	defer pkgCacheEvictMu.Unlock()
+
+	b.pkgCacheAccessSave()
+	for _, c := range pkgCaches {
+		files, err := b.pkgCacheFiles(c)
+		if err != nil {
+			b.idLogf(pkgCacheLogID, "%s: %v", c.dir, err)
+			continue
+		}
+		var total int64
+		for _, f := range files {
+			total += f.size
+		}
+		quota := c.quotaBytes(b.Config.PkgCache)
+		if quota >= 0 && total > quota {
+			evicted := pkgCacheEvicted[c.kind]
+			for _, f := range pkgCacheEvictionOrder(files, time.Now()) {
+				if total <= quota {
+					break
+				}
+				if err := b.pkgCacheRemove(c, f); err != nil {
+					b.idLogf(pkgCacheLogID, "%v", err)
+					continue
+				}
+				b.idLogf(pkgCacheLogID, "evicted %s (%d bytes, last accessed %s)", f.path, f.size, f.lastAccess.Format(time.RFC3339))
+				metricPkgCacheEvictions.WithLabelValues(c.kind).Inc()
+				total -= f.size
+				evicted.Files++
+				evicted.Bytes += f.size
+				evicted.Last = time.Now()
+			}
+			pkgCacheEvicted[c.kind] = evicted
+			if total > quota {
+				b.idLogf(pkgCacheLogID, "%s: %d bytes exceeds limit of %d bytes, but nothing more may be evicted", c.dir, total, quota)
+			}
+		}
+		metricPkgCacheBytes.WithLabelValues(c.kind).Set(float64(total))
+	}
+}
+
+// pkgCacheRemove removes the file from the cache, along with everything recorded about it.
+func (b *Bot) pkgCacheRemove(c pkgCache, f *pkgCacheFile) error {
+	paths := []string{f.path}
+	if c.kind == "zig" && !strings.HasSuffix(f.path, ".minisig") {
+		paths = append(paths, f.path+".minisig")
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "evicting")
+		}
+	}
+	// Remove directories left empty, e.g. of a Zig version or a project.
+	for dir := path.Dir(f.path); dir != c.dir && strings.HasPrefix(dir, c.dir+"/"); dir = path.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	b.pkgCacheForgetAccess(paths...)
+	if c.kind == "zig" {
+		b.zigForgetVerifications(paths...)
+	}
+	return nil
+}
+
+// pkgCacheUsage is the usage of one cache, for the admin report.
+type pkgCacheUsage struct {
+	Kind, Dir      string
+	Files          int
+	Bytes          int64
+	QuotaBytes     int64 // -1 if unlimited
+	EvictableBytes int64
+	OldestAccess   time.Time
+	Groups         []pkgCacheGroupUsage
+	Evicted        pkgCacheEvictions
+}
+
+// pkgCacheGroupUsage is the usage of Zig downloads of one kind of version, or of one project.
+type pkgCacheGroupUsage struct {
+	Name           string
+	Files          int
+	Bytes          int64
+	EvictableBytes int64
+}
+
+func (b *Bot) pkgCacheUsage() ([]pkgCacheUsage, error) {
+	var usage []pkgCacheUsage
+	for _, c := range pkgCaches {
+		files, err := b.pkgCacheFiles(c)
+		if err != nil {
+			return nil, errors.Wrap(err, c.dir)
+		}
+		u := pkgCacheUsage{Kind: c.kind, Dir: c.dir, QuotaBytes: c.quotaBytes(b.Config.PkgCache)}
+		groups := map[string]*pkgCacheGroupUsage{}
+		for _, f := range files {
+			g, ok := groups[f.group]
+			if !ok {
+				g = &pkgCacheGroupUsage{Name: f.group}
+				groups[f.group] = g
+			}
+			u.Files++
+			g.Files++
+			u.Bytes += f.size
+			g.Bytes += f.size
+			if f.evictable {
+				u.EvictableBytes += f.size
+				g.EvictableBytes += f.size
+			}
+			if u.OldestAccess.IsZero() || f.lastAccess.Before(u.OldestAccess) {
+				u.OldestAccess = f.lastAccess
+			}
+		}
+		for _, g := range groups {
+			u.Groups = append(u.Groups, *g)
+		}
+		slices.SortFunc(u.Groups, func(a, b pkgCacheGroupUsage) int {
+			return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(a.Name, b.Name))
+		})
+		pkgCacheEvictMu.Lock()
+		u.Evicted = pkgCacheEvicted[c.kind]
+		pkgCacheEvictMu.Unlock()
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+// httpPkgCacheReport serves the admin report of cache usage.
+func (b *Bot) httpPkgCacheReport(w http.ResponseWriter, r *http.Request) error {
+	usage, err := b.pkgCacheUsage()
+	if err != nil {
+		return err
+	}
+	return b.render(w, r, "pkg_cache", "Cache usage", usage)
+}
@@ -0,0 +1,156 @@
+package wrench
+
+import (
+	"os"
+	"path"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPkgCacheEvict(t *testing.T) {
+	const (
+		stable       = "cache/zig/stable/0.13.0/zig-0.13.0.tar.xz"
+		nominated    = "cache/zig/mach/0.14.0-dev.2+bbbbbbb/zig-0.14.0-dev.2+bbbbbbb.tar.xz"
+		denominated  = "cache/zig/mach/0.14.0-dev.1+aaaaaaa/zig-0.14.0-dev.1+aaaaaaa.tar.xz"
+		dev          = "cache/zig/dev/0.14.0-dev.3+ccccccc/zig-0.14.0-dev.3+ccccccc.tar.xz"
+		olderDev     = "cache/zig/dev/0.14.0-dev.4+ddddddd/zig-0.14.0-dev.4+ddddddd.tar.xz"
+		pkgArchive   = "cache/pkg/mach-ecs/83a3ed801008a976dd79e10068157b02c3b76a36.tar.gz"
+		otherArchive = "cache/pkg/mach-core/c6b2b0e3a1e1a22b7d2b08ec9fa5ee5f6bd0a8b0.tar.gz"
+	)
+	type file struct {
+		path     string
+		modified time.Duration // ago
+		accessed time.Duration // ago, if recorded
+	}
+	tests := []struct {
+		name  string
+		cache PkgCacheConfig
+		files []file
+		want  []string
+	}{
+		{
+			name:  "within quota",
+			cache: PkgCacheConfig{ZigMiB: 10},
+			files: []file{{path: stable, modified: time.Hour}, {path: dev, modified: time.Hour}},
+			want:  []string{stable, dev},
+		},
+		{
+			name:  "stable and Mach-nominated versions are never evicted",
+			cache: PkgCacheConfig{ZigMiB: 1},
+			files: []file{{path: stable, modified: time.Hour}, {path: nominated, modified: time.Hour}},
+			want:  []string{stable, nominated},
+		},
+		{
+			name:  "signatures are evicted with their download",
+			cache: PkgCacheConfig{ZigMiB: 2},
+			files: []file{
+				{path: stable, modified: time.Hour},
+				{path: stable + ".minisig", modified: time.Hour},
+				{path: dev, modified: time.Hour},
+				{path: dev + ".minisig", modified: time.Hour},
+			},
+			want: []string{stable, stable + ".minisig"},
+		},
+		{
+			name:  "recently accessed files are not evicted",
+			cache: PkgCacheConfig{ZigMiB: 1},
+			files: []file{
+				{path: stable, modified: time.Hour},
+				{path: dev, modified: pkgCacheMinAge / 2},
+				{path: olderDev, modified: time.Hour, accessed: pkgCacheMinAge / 2},
+			},
+			want: []string{stable, dev, olderDev},
+		},
+		{
+			name:  "least recently accessed first",
+			cache: PkgCacheConfig{ZigMiB: 2},
+			files: []file{
+				{path: stable, modified: time.Hour},
+				{path: dev, modified: 2 * time.Hour},
+				{path: olderDev, modified: 3 * time.Hour, accessed: time.Hour},
+			},
+			want: []string{stable, olderDev},
+		},
+		{
+			name:  "dev versions before versions no longer nominated",
+			cache: PkgCacheConfig{ZigMiB: 2},
+			files: []file{
+				{path: stable, modified: time.Hour},
+				{path: denominated, modified: 3 * time.Hour},
+				{path: dev, modified: time.Hour},
+			},
+			want: []string{stable, denominated},
+		},
+		{
+			name:  "versions no longer nominated once dev versions are gone",
+			cache: PkgCacheConfig{ZigMiB: 1},
+			files: []file{
+				{path: stable, modified: time.Hour},
+				{path: nominated, modified: 3 * time.Hour},
+				{path: denominated, modified: 3 * time.Hour},
+				{path: dev, modified: time.Hour},
+			},
+			want: []string{stable, nominated},
+		},
+		{
+			name:  "projects least recently accessed first",
+			cache: PkgCacheConfig{PkgMiB: 1},
+			files: []file{
+				{path: pkgArchive, modified: 3 * time.Hour, accessed: time.Hour},
+				{path: otherArchive, modified: 2 * time.Hour},
+			},
+			want: []string{pkgArchive},
+		},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			b := &Bot{Config: &Config{WrenchDir: t.TempDir(), PkgCache: tst.cache}}
+
+			httpPkgZigIndexMu.Lock()
+			httpPkgZigIndexCached = []byte(`{"mach-latest": {"version": "0.14.0-dev.2+bbbbbbb"}}`)
+			httpPkgZigIndexFetchedAt = time.Now()
+			httpPkgZigIndexMu.Unlock()
+			pkgCacheAccessMu.Lock()
+			pkgCacheAccessLoaded = false
+			pkgCacheAccessMu.Unlock()
+
+			now := time.Now()
+			for _, f := range tst.files {
+				if err := os.MkdirAll(path.Dir(f.path), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				// Downloads are 1 MiB, signatures small.
+				data := []byte("signature")
+				if path.Ext(f.path) != ".minisig" {
+					data = make([]byte, 1024*1024)
+				}
+				if err := os.WriteFile(f.path, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(f.path, now.Add(-f.modified), now.Add(-f.modified)); err != nil {
+					t.Fatal(err)
+				}
+				if f.accessed != 0 {
+					pkgCacheAccessMu.Lock()
+					b.pkgCacheAccessLoad()
+					pkgCacheAccess[f.path] = now.Add(-f.accessed)
+					pkgCacheAccessMu.Unlock()
+				}
+			}
+
+			b.pkgCacheEvict()
+
+			var remaining []string
+			for _, f := range tst.files {
+				if _, err := os.Stat(f.path); err == nil {
+					remaining = append(remaining, f.path)
+				}
+			}
+			if !slices.Equal(remaining, tst.want) {
+				t.Fatalf("expected remaining files %q, found %q", tst.want, remaining)
+			}
+		})
+	}
+}
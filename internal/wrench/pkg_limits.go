@@ -0,0 +1,214 @@
+package wrench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"golang.org/x/time/rate"
+)
+
+// errObjectTooLarge is returned when an upstream file is larger than PkgLimits.MaxObjectMiB.
+var errObjectTooLarge = errors.New("object too large")
+
+// pkgLimiter enforces PkgLimitsConfig.
+type pkgLimiter struct {
+	cfg    PkgLimitsConfig
+	misses *rate.Limiter // nil if unlimited
+
+	mu         sync.Mutex
+	clients    map[string]*pkgClientLimiter
+	lastPruned time.Time
+}
+
+// pkgClientLimiter holds the limits of a single client IP.
+type pkgClientLimiter struct {
+	misses    *rate.Limiter // nil if unlimited
+	bandwidth *rate.Limiter // nil if unlimited
+	lastSeen  time.Time
+}
+
+func newPkgLimiter(cfg PkgLimitsConfig) *pkgLimiter {
+	l := &pkgLimiter{cfg: cfg, clients: map[string]*pkgClientLimiter{}}
+	if cfg.MissesPerMinute > 0 {
+		l.misses = perMinuteLimiter(cfg.MissesPerMinute)
+	}
+	return l
+}
+
+// perMinuteLimiter allows n events per minute, in bursts of up to n.
+func perMinuteLimiter(n int) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(float64(n)/60), n)
+}
+
+// clientIP returns the IP of the client making the request, see PkgLimitsConfig.ClientIPHeader.
+func (l *pkgLimiter) clientIP(r *http.Request) string {
+	if l.cfg.ClientIPHeader != "" {
+		// X-Forwarded-For may be a list of addresses, the first being the client.
+		if v, _, _ := strings.Cut(r.Header.Get(l.cfg.ClientIPHeader), ","); strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return remoteHost(r)
+}
+
+func (l *pkgLimiter) client(r *http.Request) *pkgClientLimiter {
+	ip := l.clientIP(r)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastPruned) > time.Minute {
+		// Clients not seen for a while have had their limits fully replenished, so they can be
+		// forgotten.
+		for ip, c := range l.clients {
+			if now.Sub(c.lastSeen) > 10*time.Minute {
+				delete(l.clients, ip)
+			}
+		}
+		l.lastPruned = now
+	}
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &pkgClientLimiter{}
+		if l.cfg.MissesPerClientPerMinute > 0 {
+			c.misses = perMinuteLimiter(l.cfg.MissesPerClientPerMinute)
+		}
+		if l.cfg.ClientKiBPerSecond > 0 {
+			bytesPerSecond := l.cfg.ClientKiBPerSecond * 1024
+			c.bandwidth = rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)
+		}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c
+}
+
+// allowProject reports whether files of the project may be fetched from upstream.
+func (l *pkgLimiter) allowProject(project string) bool {
+	for _, pattern := range l.cfg.DenyProjects {
+		if ok, _ := path.Match(pattern, project); ok {
+			return false
+		}
+	}
+	if len(l.cfg.AllowProjects) == 0 {
+		return true
+	}
+	for _, pattern := range l.cfg.AllowProjects {
+		if ok, _ := path.Match(pattern, project); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowMiss reports whether the client may cause a cache miss (a fetch from upstream) now. If
+// not, it returns which limit was hit ("client" or "global") and how long until it would be
+// allowed.
+func (l *pkgLimiter) allowMiss(r *http.Request) (ok bool, limit string, retryAfter time.Duration) {
+	c := l.client(r)
+	var client *rate.Reservation
+	if c.misses != nil {
+		client = c.misses.Reserve()
+		if d := client.Delay(); d > 0 {
+			client.Cancel()
+			return false, "client", d
+		}
+	}
+	if l.misses != nil {
+		global := l.misses.Reserve()
+		if d := global.Delay(); d > 0 {
+			global.Cancel()
+			if client != nil {
+				client.Cancel()
+			}
+			return false, "global", d
+		}
+	}
+	return true, "", 0
+}
+
+// maxObjectBytes returns the largest file that may be fetched from upstream, or -1 if unlimited.
+func (l *pkgLimiter) maxObjectBytes() int64 {
+	if l.cfg.MaxObjectMiB <= 0 {
+		return -1
+	}
+	return int64(l.cfg.MaxObjectMiB) * 1024 * 1024
+}
+
+// throttle limits how fast the response is written, according to the client's bandwidth limit.
+func (l *pkgLimiter) throttle(r *http.Request, w http.ResponseWriter) http.ResponseWriter {
+	c := l.client(r)
+	if c.bandwidth == nil {
+		return w
+	}
+	return &throttledResponseWriter{ResponseWriter: w, ctx: r.Context(), limiter: c.bandwidth}
+}
+
+// throttledResponseWriter writes the response body no faster than the limiter allows, in bytes
+// per second.
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (w *throttledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := min(len(p), w.limiter.Burst())
+		if err := w.limiter.WaitN(w.ctx, chunk); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[chunk:]
+	}
+	return written, nil
+}
+
+// pkgRejectRateLimited responds that a rate limit was hit, for the given kind of file.
+func pkgRejectRateLimited(w http.ResponseWriter, kind, limit string, retryAfter time.Duration) {
+	metricPkgRejected.WithLabelValues(kind, limit).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, _ = fmt.Fprintf(w, "rate limit exceeded (%s), try again in %v\n", limit, retryAfter.Round(time.Second))
+}
+
+// limitedReader reads from r, failing with errObjectTooLarge once more than n bytes are read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errObjectTooLarge
+	}
+	return n, err
+}
+
+// limitObjectSize returns the body of an upstream response, which fails with errObjectTooLarge
+// if it is larger than max bytes (-1 for no limit.)
+func limitObjectSize(resp *http.Response, max int64) (io.Reader, error) {
+	if max < 0 {
+		return resp.Body, nil
+	}
+	if resp.ContentLength > max {
+		return nil, errObjectTooLarge
+	}
+	return &limitedReader{r: resp.Body, n: max}, nil
+}
@@ -0,0 +1,106 @@
+package wrench
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPkgLimiterAllowMiss(t *testing.T) {
+	l := newPkgLimiter(PkgLimitsConfig{MissesPerClientPerMinute: 2, MissesPerMinute: 3})
+	request := func(ip string) (bool, string, time.Duration) {
+		r := httptest.NewRequest("GET", "/zig/zig-0.13.0.tar.xz", nil)
+		r.RemoteAddr = ip + ":1234"
+		return l.allowMiss(r)
+	}
+
+	for i := 0; i < 2; i++ {
+		if ok, limit, _ := request("10.0.0.1"); !ok {
+			t.Fatalf("miss %d: unexpectedly hit the %s limit", i, limit)
+		}
+	}
+	ok, limit, retryAfter := request("10.0.0.1")
+	if ok || limit != "client" {
+		t.Fatalf("expected the client limit, found ok=%v limit=%q", ok, limit)
+	}
+	// 2 misses per minute replenish one every 30s.
+	if retryAfter <= 25*time.Second || retryAfter > 30*time.Second {
+		t.Fatalf("expected to retry after about 30s, found %v", retryAfter)
+	}
+
+	// The rejected miss did not count towards the global limit, so one more is allowed.
+	if ok, limit, _ := request("10.0.0.2"); !ok {
+		t.Fatalf("unexpectedly hit the %s limit", limit)
+	}
+	ok, limit, retryAfter = request("10.0.0.3")
+	if ok || limit != "global" {
+		t.Fatalf("expected the global limit, found ok=%v limit=%q", ok, limit)
+	}
+	// 3 misses per minute replenish one every 20s.
+	if retryAfter <= 15*time.Second || retryAfter > 20*time.Second {
+		t.Fatalf("expected to retry after about 20s, found %v", retryAfter)
+	}
+
+	// Unlimited if not configured.
+	l = newPkgLimiter(PkgLimitsConfig{})
+	for i := 0; i < 100; i++ {
+		if ok, limit, _ := request("10.0.0.1"); !ok {
+			t.Fatalf("miss %d: unexpectedly hit the %s limit", i, limit)
+		}
+	}
+}
+
+func TestPkgLimiterClientIPHeader(t *testing.T) {
+	l := newPkgLimiter(PkgLimitsConfig{ClientIPHeader: "X-Forwarded-For"})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	if ip := l.clientIP(r); ip != "127.0.0.1" {
+		t.Fatalf("expected the remote address without the header, found %q", ip)
+	}
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	if ip := l.clientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("expected the first forwarded address, found %q", ip)
+	}
+}
+
+func TestPkgRejectRateLimited(t *testing.T) {
+	w := httptest.NewRecorder()
+	pkgRejectRateLimited(w, "zig", "client", 1500*time.Millisecond)
+	if w.Code != 429 {
+		t.Fatalf("expected status 429, found %d", w.Code)
+	}
+	// Rounded up, so that clients do not retry too early.
+	if v := w.Header().Get("Retry-After"); v != "2" {
+		t.Fatalf("expected Retry-After: 2, found %q", v)
+	}
+}
+
+func TestPkgLimiterAllowProject(t *testing.T) {
+	tests := []struct {
+		allow, deny []string
+		project     string
+		want        bool
+	}{
+		{nil, nil, "mach", true},
+		{nil, nil, "acme/x", true},
+		{nil, []string{"mach-*"}, "mach-dxcompiler", false},
+		{nil, []string{"mach-*"}, "mach", true},
+		// Patterns match whole project names, including the prefix of an upstream.
+		{nil, []string{"x"}, "acme/x", true},
+		{nil, []string{"acme/x"}, "acme/x", false},
+		{nil, []string{"acme/*"}, "acme/x", false},
+		{nil, []string{"*"}, "acme/x", true},
+		{[]string{"mach", "mach-*"}, nil, "mach-core", true},
+		{[]string{"mach", "mach-*"}, nil, "zig-gamedev", false},
+		{[]string{"mach", "mach-*"}, nil, "acme/mach", false},
+		{[]string{"acme/*"}, nil, "acme/x", true},
+		// Denied projects take precedence.
+		{[]string{"acme/*"}, []string{"acme/secret"}, "acme/secret", false},
+	}
+	for _, tst := range tests {
+		l := newPkgLimiter(PkgLimitsConfig{AllowProjects: tst.allow, DenyProjects: tst.deny})
+		if got := l.allowProject(tst.project); got != tst.want {
+			t.Errorf("allow=%q deny=%q: allowProject(%q) = %v, want %v", tst.allow, tst.deny, tst.project, got, tst.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package wrench
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const pkgUpstreamsLogID = "upstreams"
+
+// pkgUpstreamHealth tracks which upstream hosts are down, so that their fallbacks are tried
+// first. A host is down after a network error or 5xx response, until it responds again to a
+// request or health check.
+type pkgUpstreamHealth struct {
+	b *Bot
+
+	mu   sync.Mutex
+	down map[string]pkgUpstreamDown // by upstreamHost
+}
+
+// pkgUpstreamDown describes an upstream host that is down.
+type pkgUpstreamDown struct {
+	since time.Time
+
+	// probe is the URL whose request failed, which is requested again by health checks: the root
+	// of a host (e.g. of an API-only host) may well fail even while its files are served fine.
+	probe string
+}
+
+func newPkgUpstreamHealth(b *Bot) *pkgUpstreamHealth {
+	h := &pkgUpstreamHealth{b: b, down: map[string]pkgUpstreamDown{}}
+	var urls []string
+	for _, u := range b.Config.PkgUpstreams {
+		urls = append(append(urls, u.Archive...), u.Artifact...)
+	}
+	z := b.Config.ZigUpstreams
+	for _, list := range [][]string{z.Stable, z.Mach, z.Dev, z.Index, z.MachIndex} {
+		urls = append(urls, list...)
+	}
+	for _, u := range urls {
+		metricPkgUpstreamUp.WithLabelValues(upstreamHost(u)).Set(1)
+	}
+	return h
+}
+
+// upstreamHost returns the scheme and host of the URL (template), which identify the upstream.
+func upstreamHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// order returns the URLs, with those of upstreams that are down moved to the end.
+func (h *pkgUpstreamHealth) order(urls []string) []string {
+	if h == nil {
+		return urls
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ordered := slices.Clone(urls)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		_, aDown := h.down[upstreamHost(a)]
+		_, bDown := h.down[upstreamHost(b)]
+		switch {
+		case aDown && !bDown:
+			return 1
+		case !aDown && bDown:
+			return -1
+		}
+		return 0
+	})
+	return ordered
+}
+
+// observe records the outcome of a request to an upstream.
+func (h *pkgUpstreamHealth) observe(rawURL string, resp *http.Response, err error) {
+	if h == nil {
+		return
+	}
+	h.set(rawURL, err != nil || resp.StatusCode >= 500)
+}
+
+func (h *pkgUpstreamHealth) set(rawURL string, down bool) {
+	host := upstreamHost(rawURL)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d, wasDown := h.down[host]
+	switch {
+	case down && !wasDown:
+		h.down[host] = pkgUpstreamDown{since: time.Now(), probe: rawURL}
+		h.b.idLogf(pkgUpstreamsLogID, "%s is down, trying its fallbacks first", host)
+		metricPkgUpstreamUp.WithLabelValues(host).Set(0)
+	case !down && wasDown:
+		delete(h.down, host)
+		h.b.idLogf(pkgUpstreamsLogID, "%s is up again after %v", host, time.Since(d.since).Round(time.Second))
+		metricPkgUpstreamUp.WithLabelValues(host).Set(1)
+	}
+}
+
+// check sends a health check request to each upstream that is down, for the URL which failed.
+func (h *pkgUpstreamHealth) check() {
+	h.mu.Lock()
+	var probes []string
+	for _, d := range h.down {
+		probes = append(probes, d.probe)
+	}
+	h.mu.Unlock()
+	for _, probe := range probes {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		req, err := http.NewRequestWithContext(ctx, "HEAD", probe, nil)
+		if err == nil {
+			var resp *http.Response
+			resp, err = http.DefaultClient.Do(req)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			h.observe(probe, resp, err)
+		}
+		cancel()
+	}
+}
+
+// start health checks upstreams that are down every minute.
+func (h *pkgUpstreamHealth) start() {
+	go func() {
+		for {
+			time.Sleep(1 * time.Minute)
+			h.check()
+		}
+	}()
+}
+
+// httpPkgGet is httpGet for requests to upstreams, recording whether they are up.
+func (b *Bot) httpPkgGet(ctx context.Context, url string) (*http.Response, error) {
+	resp, err := httpGet(ctx, url)
+	if ctx.Err() == nil {
+		// Our own timeouts say nothing about the upstream.
+		b.upstreamHealth.observe(url, resp, err)
+	}
+	return resp, err
+}
+
+// pkgUpstreamFor returns the upstream of the request path (the one with the longest matching
+// Prefix), and the path with the prefix replaced by "/".
+func (b *Bot) pkgUpstreamFor(p string) (PkgUpstreamConfig, string, bool) {
+	var (
+		best     PkgUpstreamConfig
+		bestRest string
+		found    bool
+	)
+	for _, u := range b.Config.PkgUpstreams {
+		prefix := pkgUpstreamPrefix(u.Prefix)
+		rest, ok := strings.CutPrefix(p, prefix)
+		if !ok || (found && len(prefix) <= len(pkgUpstreamPrefix(best.Prefix))) {
+			continue
+		}
+		best, bestRest, found = u, "/"+rest, true
+	}
+	return best, bestRest, found
+}
+
+// pkgUpstreamPrefix returns the prefix with a leading and trailing slash.
+func pkgUpstreamPrefix(prefix string) string {
+	if prefix = strings.Trim(prefix, "/"); prefix == "" {
+		return "/"
+	}
+	return "/" + prefix + "/"
+}
+
+// pkgUpstreamProject returns the name of a project served under the upstream's prefix, as used
+// in the cache and PkgLimits: "acme/<project>" for the "/acme/" prefix.
+func pkgUpstreamProject(u PkgUpstreamConfig, project string) string {
+	return path.Join(strings.Trim(u.Prefix, "/"), project)
+}
+
+// expandUpstreamURLs fills in the URL templates, given pairs of variable names (without $) and
+// values. Variables are written $NAME or ${NAME}, as in os.Expand; unknown ones are left as is.
+func expandUpstreamURLs(templates []string, vars ...string) []string {
+	values := map[string]string{}
+	for i := 0; i+1 < len(vars); i += 2 {
+		values[vars[i]] = url.PathEscape(vars[i+1])
+	}
+	urls := make([]string, 0, len(templates))
+	for _, t := range templates {
+		urls = append(urls, os.Expand(t, func(name string) string {
+			if v, ok := values[name]; ok {
+				return v
+			}
+			return "${" + name + "}"
+		}))
+	}
+	return urls
+}
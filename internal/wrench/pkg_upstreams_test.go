@@ -0,0 +1,105 @@
+package wrench
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestPkgUpstreamFor(t *testing.T) {
+	b := &Bot{Config: &Config{PkgUpstreams: []PkgUpstreamConfig{
+		{Prefix: "/acme/internal/"},
+		{Prefix: "/"},
+		{Prefix: "/acme/"},
+	}}}
+	tests := []struct {
+		path, wantPrefix, wantRest string
+	}{
+		{"/mach-ecs/main.tar.gz", "/", "/mach-ecs/main.tar.gz"},
+		{"/acme/x/main.tar.gz", "/acme/", "/x/main.tar.gz"},
+		{"/acme/internal/x/main.tar.gz", "/acme/internal/", "/x/main.tar.gz"},
+		// Prefixes only match whole path segments.
+		{"/acmecorp/x/main.tar.gz", "/", "/acmecorp/x/main.tar.gz"},
+	}
+	for _, tst := range tests {
+		u, rest, ok := b.pkgUpstreamFor(tst.path)
+		if !ok || u.Prefix != tst.wantPrefix || rest != tst.wantRest {
+			t.Errorf("pkgUpstreamFor(%q) = %q, %q, %v; want %q, %q", tst.path, u.Prefix, rest, ok, tst.wantPrefix, tst.wantRest)
+		}
+	}
+
+	b.Config.PkgUpstreams = []PkgUpstreamConfig{{Prefix: "/acme/"}}
+	if _, _, ok := b.pkgUpstreamFor("/mach-ecs/main.tar.gz"); ok {
+		t.Error("expected no upstream for a path matching no prefix")
+	}
+	if got := pkgUpstreamProject(PkgUpstreamConfig{Prefix: "/acme/"}, "x"); got != "acme/x" {
+		t.Errorf("pkgUpstreamProject: expected acme/x, found %q", got)
+	}
+	if got := pkgUpstreamProject(PkgUpstreamConfig{Prefix: "/"}, "mach"); got != "mach" {
+		t.Errorf("pkgUpstreamProject: expected mach, found %q", got)
+	}
+}
+
+func TestExpandUpstreamURLs(t *testing.T) {
+	got := expandUpstreamURLs([]string{
+		"https://example.com/$PROJECT/archive/$FILE",
+		"https://example.com/$PROJECT/-/archive/$REF/$PROJECT-$REF.tar.gz",
+		// A variable whose name is a prefix of another's.
+		"https://example.com/$REFS/$REF",
+		"https://example.com/${REF}_src.tar.gz",
+		"https://example.com/$UNKNOWN/${UNKNOWN}",
+		"https://example.com/zig/$VERSION/$FILE",
+	}, "PROJECT", "mach", "FILE", "main.tar.gz", "REF", "main", "REFS", "heads", "VERSION", "0.14.0-dev.1+abc", "FILE", "a b")
+	want := []string{
+		"https://example.com/mach/archive/a%20b",
+		"https://example.com/mach/-/archive/main/mach-main.tar.gz",
+		"https://example.com/heads/main",
+		"https://example.com/main_src.tar.gz",
+		"https://example.com/${UNKNOWN}/${UNKNOWN}",
+		"https://example.com/zig/0.14.0-dev.1+abc/a%20b",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected\n%q\nfound\n%q", want, got)
+	}
+}
+
+func TestPkgUpstreamHealth(t *testing.T) {
+	// An API-only host: its root fails, while the files it serves are fine.
+	var fileStatus = http.StatusBadGateway
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(fileStatus)
+	}))
+	defer upstream.Close()
+
+	h := newPkgUpstreamHealth(&Bot{Config: &Config{}})
+	urls := []string{upstream.URL + "/a/main.tar.gz", "https://fallback.example.com/a/main.tar.gz", "https://other.example.com/a/main.tar.gz"}
+	if got := h.order(urls); !slices.Equal(got, urls) {
+		t.Fatalf("expected the configured order while all upstreams are up, found %q", got)
+	}
+
+	h.observe(urls[0], &http.Response{StatusCode: http.StatusBadGateway}, nil)
+	want := []string{urls[1], urls[2], urls[0]}
+	if got := h.order(urls); !slices.Equal(got, want) {
+		t.Fatalf("expected the upstream that is down last, found %q", got)
+	}
+	// A missing file does not mean the upstream is down.
+	h.observe("https://fallback.example.com/b/main.tar.gz", &http.Response{StatusCode: http.StatusNotFound}, nil)
+	if got := h.order(urls); !slices.Equal(got, want) {
+		t.Fatalf("expected a 404 not to change the order, found %q", got)
+	}
+
+	h.check()
+	if got := h.order(urls); !slices.Equal(got, want) {
+		t.Fatalf("expected the upstream to stay down while the failed URL fails, found %q", got)
+	}
+	fileStatus = http.StatusOK
+	h.check()
+	if got := h.order(urls); !slices.Equal(got, urls) {
+		t.Fatalf("expected the upstream to be up again although its root fails, found %q", got)
+	}
+}
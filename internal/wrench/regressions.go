@@ -0,0 +1,233 @@
+package wrench
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/google/go-github/v48/github"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+const regressionsLogID = "regressions"
+
+func (r RegressionRule) matches(statID string) bool {
+	if prefix, ok := strings.CutSuffix(r.StatID, "*"); ok {
+		return strings.HasPrefix(statID, prefix)
+	}
+	return r.StatID == statID
+}
+
+func (r RegressionRule) splitBy() []string {
+	if r.SplitBy == nil {
+		return []string{"runner"}
+	}
+	return r.SplitBy
+}
+
+// Regression describes a stat value which exceeded the median of previous values.
+type Regression struct {
+	Rule    RegressionRule
+	Stat    api.Stat
+	Median  int64
+	Samples int
+}
+
+// Percent is how much larger than the median the stat value is.
+func (r Regression) Percent() float64 {
+	return (float64(r.Stat.Value) - float64(r.Median)) / float64(r.Median) * 100
+}
+
+// detectRegression compares stat against the previous values in history (oldest first, which
+// must not include stat itself.) It returns nil if there is no regression, or if there are too
+// few comparable previous values.
+func detectRegression(rule RegressionRule, history []api.Stat, stat api.Stat) *Regression {
+	threshold, window, minSamples := rule.ThresholdPercent, rule.Window, rule.MinSamples
+	if threshold <= 0 {
+		threshold = 20
+	}
+	if window <= 0 {
+		window = 10
+	}
+	if minSamples <= 0 {
+		minSamples = 5
+	}
+
+	var values []int64
+	for _, previous := range history {
+		comparable := true
+		for _, key := range rule.splitBy() {
+			if fmt.Sprint(previous.Metadata[key]) != fmt.Sprint(stat.Metadata[key]) {
+				comparable = false
+				break
+			}
+		}
+		if comparable {
+			values = append(values, previous.Value)
+		}
+	}
+	values = values[max(len(values)-window, 0):]
+	if len(values) < minSamples {
+		return nil
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	median := values[len(values)/2]
+	if len(values)%2 == 0 {
+		median = (values[len(values)/2-1] + median) / 2
+	}
+	if median <= 0 || float64(stat.Value) <= float64(median)*(1+threshold/100) {
+		return nil
+	}
+	return &Regression{Rule: rule, Stat: stat, Median: median, Samples: len(values)}
+}
+
+// regressionsCacheName is the cache of regressions which were reported and have not cleared
+// yet, by regressionKey.
+const regressionsCacheName = "regressions"
+
+// regressionKey identifies the series a rule checks a stat against, e.g. one stat ID on one
+// runner.
+func regressionKey(rule RegressionRule, stat api.Stat) string {
+	key := rule.StatID + " " + stat.ID
+	for _, split := range rule.splitBy() {
+		key += fmt.Sprintf(" %s=%v", split, stat.Metadata[split])
+	}
+	return key
+}
+
+// checkRegressions evaluates the configured regression rules against stats which were just
+// recorded. A regression is reported once, and again only after a later value cleared it.
+//
+// It is slow (it loads the full history of each stat ID) and so is meant to be run in the
+// background.
+func (b *Bot) checkRegressions(ctx context.Context, recorded []api.Stat) {
+	b.regressionsMu.Lock()
+	defer b.regressionsMu.Unlock()
+
+	histories := map[string][]api.Stat{}
+	for _, stat := range recorded {
+		for _, rule := range b.Config.Regressions {
+			if !rule.matches(stat.ID) {
+				continue
+			}
+			stats, ok := histories[stat.ID]
+			if !ok {
+				var err error
+				stats, err = b.store.Stats(ctx, stat.ID)
+				if err != nil {
+					b.idLogf(regressionsLogID, "error: Stats: %v", err)
+					continue
+				}
+				histories[stat.ID] = stats
+			}
+			var history []api.Stat
+			for _, previous := range stats {
+				if previous.Time.Before(stat.Time) {
+					history = append(history, previous)
+				}
+			}
+
+			key := regressionKey(rule, stat)
+			reported := false
+			if entry, err := b.store.CacheKey(ctx, regressionsCacheName, key); err == nil {
+				reported = entry.Value != ""
+			}
+			regression := detectRegression(rule, history, stat)
+			switch {
+			case regression != nil && !reported:
+				b.reportRegression(ctx, *regression)
+				if err := b.store.CacheSet(ctx, regressionsCacheName, key, stat.Time.UTC().Format(time.RFC3339), nil); err != nil {
+					b.idLogf(regressionsLogID, "error: CacheSet: %v", err)
+				}
+			case regression == nil && reported:
+				b.idLogf(regressionsLogID, "regression cleared: %s", key)
+				if err := b.store.CacheSet(ctx, regressionsCacheName, key, "", nil); err != nil {
+					b.idLogf(regressionsLogID, "error: CacheSet: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func (b *Bot) reportRegression(ctx context.Context, r Regression) {
+	var split []string
+	query := url.Values{}
+	for _, key := range r.Rule.splitBy() {
+		split = append(split, fmt.Sprintf("%s=%v", key, r.Stat.Metadata[key]))
+		if param, ok := statsQueryParam(key); ok {
+			query.Set(param, fmt.Sprint(r.Stat.Metadata[key]))
+		} else {
+			query.Set("meta."+key, fmt.Sprint(r.Stat.Metadata[key]))
+		}
+	}
+	graphURL := fmt.Sprintf("%s/stats/%s?%s", b.Config.ExternalURL, url.PathEscape(r.Stat.ID), query.Encode())
+	summary := fmt.Sprintf("%s is %s, %.0f%% above the median of %s over the last %d values",
+		r.Stat.ID,
+		formatStatValue(r.Stat.Type, r.Stat.Value),
+		r.Percent(),
+		formatStatValue(r.Stat.Type, r.Median),
+		r.Samples,
+	)
+	if len(split) > 0 {
+		summary += " (" + strings.Join(split, ", ") + ")"
+	}
+	b.idLogf(regressionsLogID, "regression: %s", summary)
+	b.discord("📈 Possible performance regression: %s\n%s", summary, graphURL)
+
+	if r.Rule.IssueRepo == "" || b.github == nil {
+		return
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "Wrench detected a possible performance regression: %s\n\n", summary)
+	fmt.Fprintf(&body, "Graph: %s\n\n", graphURL)
+	fmt.Fprintf(&body, "Offending data point (%s):\n\n", r.Stat.Time.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, "| metadata | value |\n|---|---|\n")
+	var keys []string
+	for key := range r.Stat.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&body, "| %s | `%v` |\n", key, r.Stat.Metadata[key])
+	}
+	fmt.Fprintf(&body, "\n(Produced via !wrench)\n")
+
+	title := fmt.Sprintf("Performance regression: %s", r.Stat.ID)
+	if len(split) > 0 {
+		title += " (" + strings.Join(split, ", ") + ")"
+	}
+	bodyString := body.String()
+	issue, _, err := b.githubUpsertIssue(ctx, r.Rule.IssueRepo, &github.IssueRequest{
+		Title: &title,
+		Body:  &bodyString,
+	})
+	if err != nil {
+		b.idLogf(regressionsLogID, "error creating issue: %v", err)
+		return
+	}
+	b.idLogf(regressionsLogID, "issue: %s", *issue.HTMLURL)
+}
+
+// statsQueryParam returns the shorthand /stats query parameter for a metadata key, if any.
+func statsQueryParam(key string) (string, bool) {
+	for param, k := range statsQueryMetadataParams {
+		if k == key {
+			return param, true
+		}
+	}
+	return "", false
+}
+
+func formatStatValue(statType string, value int64) string {
+	switch statType {
+	case api.StatTypeNs:
+		return time.Duration(value).Round(time.Millisecond).String()
+	case api.StatTypeBytes:
+		return humanize.IBytes(uint64(value))
+	}
+	return fmt.Sprint(value)
+}
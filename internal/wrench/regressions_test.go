@@ -0,0 +1,96 @@
+package wrench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func TestDetectRegression(t *testing.T) {
+	start := time.Now()
+	stat := func(value int64, runner string) api.Stat {
+		start = start.Add(time.Hour)
+		return api.Stat{
+			ID:       "mach-core-time-build-examples",
+			Type:     api.StatTypeNs,
+			Time:     start,
+			Value:    value,
+			Metadata: map[string]any{"runner": runner},
+		}
+	}
+	var history []api.Stat
+	for _, value := range []int64{100, 110, 90, 105, 95} {
+		history = append(history, stat(value, "linux"))
+	}
+	// A much slower machine must not affect the median, as stats are split by runner by default.
+	history = append(history, stat(1000, "windows"))
+
+	rule := RegressionRule{StatID: "mach-core-time-*", ThresholdPercent: 50}
+	if r := detectRegression(rule, history, stat(140, "linux")); r != nil {
+		t.Fatalf("expected no regression below threshold, found %+v", r)
+	}
+	r := detectRegression(rule, history, stat(200, "linux"))
+	if r == nil {
+		t.Fatal("expected regression")
+	}
+	if r.Median != 100 || r.Samples != 5 || r.Percent() != 100 {
+		t.Fatalf("unexpected regression %+v (%v%%)", r, r.Percent())
+	}
+	if r := detectRegression(RegressionRule{MinSamples: 6}, history, stat(200, "linux")); r != nil {
+		t.Fatalf("expected no regression with too few samples, found %+v", r)
+	}
+	if !rule.matches("mach-core-time-build-examples") || rule.matches("mach-core-size-repo") {
+		t.Fatal("unexpected StatID prefix matching")
+	}
+}
+
+func TestCheckRegressionsReportedOnce(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		rule := RegressionRule{StatID: "build-time"}
+		b := &Bot{store: s, Config: &Config{Regressions: []RegressionRule{rule}}}
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		record := func(i int, value int64) api.Stat {
+			stat := api.Stat{
+				ID:       "build-time",
+				Type:     api.StatTypeNs,
+				Time:     start.Add(time.Duration(i) * time.Hour),
+				Value:    value,
+				Metadata: map[string]any{"runner": "linux"},
+			}
+			if err := s.RecordStat(ctx, stat); err != nil {
+				t.Fatal(err)
+			}
+			return stat
+		}
+		for i := range 5 {
+			record(i, 100)
+		}
+		key := regressionKey(rule, api.Stat{ID: "build-time", Metadata: map[string]any{"runner": "linux"}})
+		reported := func() string {
+			entry, err := s.CacheKey(ctx, regressionsCacheName, key)
+			if err != nil {
+				return ""
+			}
+			return entry.Value
+		}
+
+		// Already reported: a further regressed value must not be reported again (reporting would
+		// fail here, as there is no Discord session.)
+		if err := s.CacheSet(ctx, regressionsCacheName, key, "earlier", nil); err != nil {
+			t.Fatal(err)
+		}
+		b.checkRegressions(ctx, []api.Stat{record(6, 200)})
+		if got := reported(); got != "earlier" {
+			t.Fatalf("expected regression to stay reported, found %q", got)
+		}
+
+		// A value back within the threshold clears it.
+		b.checkRegressions(ctx, []api.Stat{record(7, 100)})
+		if got := reported(); got != "" {
+			t.Fatalf("expected regression to be cleared, found %q", got)
+		}
+	})
+}
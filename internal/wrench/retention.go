@@ -0,0 +1,24 @@
+package wrench
+
+import (
+	"context"
+	"time"
+)
+
+const retentionLogID = "retention"
+
+// retentionStart purges old data from the store according to Config.Retention once a day.
+func (b *Bot) retentionStart() {
+	go func() {
+		ctx := context.Background()
+		for {
+			report, err := b.store.Purge(ctx, b.Config.Retention, false)
+			if err != nil {
+				b.idLogf(retentionLogID, "error: purge failed: %v", err)
+			} else {
+				b.idLogf(retentionLogID, "purged old data:\n%s", report)
+			}
+			time.Sleep(24 * time.Hour)
+		}
+	}()
+}
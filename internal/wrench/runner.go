@@ -28,9 +28,17 @@ func (b *Bot) runnerStart() error {
 	if b.Config.Secret == "" {
 		return errors.New("runner: Config.Secret must be configured")
 	}
-	b.runner = &api.Client{URL: b.Config.ExternalURL, Secret: b.Config.Secret}
+	runner, err := b.Config.APIClient()
+	if err != nil {
+		return errors.Wrap(err, "runner")
+	}
+	b.runner = runner
+	b.runnerStopping = make(chan struct{})
+	b.runnerKill = make(chan struct{})
+	b.runnerPollDone = make(chan struct{})
 
 	go func() {
+		defer close(b.runnerPollDone)
 		arch := runtime.GOOS + "/" + runtime.GOARCH
 		connected := false
 		env := api.RunnerEnv{
@@ -50,7 +58,11 @@ func (b *Bot) runnerStart() error {
 		started := false
 		for {
 			if started {
-				time.Sleep(5 * time.Second)
+				select {
+				case <-b.runnerStopping:
+					return
+				case <-time.After(5 * time.Second):
+				}
 			}
 			started = true
 			ctx := context.Background()
@@ -132,6 +144,7 @@ func (b *Bot) runnerStartJob(ctx context.Context, startJob *api.RunnerJobStart,
 		arch                 = runtime.GOOS + "/" + runtime.GOARCH
 	)
 
+	b.runnerJobs.Add(1)
 	activeMu.Lock()
 	active = &api.Job{
 		ID:      startJob.ID,
@@ -174,6 +187,8 @@ func (b *Bot) runnerStartJob(ctx context.Context, startJob *api.RunnerJobStart,
 			case <-done:
 				return
 			case <-cancel:
+			case <-b.runnerKill:
+				_, _ = fmt.Fprintf(lw, "runner is shutting down, cancelling job\n")
 			}
 			_ = cmd.Process.Kill()
 		}()
@@ -211,6 +226,7 @@ func (b *Bot) runnerStartJob(ctx context.Context, startJob *api.RunnerJobStart,
 	}()
 
 	go func() {
+		defer b.runnerJobs.Done()
 		for {
 			activeMu.Lock()
 			var update *api.RunnerJobUpdate
@@ -250,6 +266,36 @@ func (b *Bot) runnerStartJob(ctx context.Context, startJob *api.RunnerJobStart,
 	}()
 }
 
+// runnerStop stops accepting new jobs and waits up to Config.ShutdownTimeoutSeconds for running
+// jobs to finish. Jobs still running after that are cancelled, and their final state is sent to
+// the server before returning.
+func (b *Bot) runnerStop() {
+	if b.runnerStopping == nil {
+		return
+	}
+	close(b.runnerStopping)
+	// Once polling has stopped, no new jobs can be started.
+	<-b.runnerPollDone
+
+	finished := make(chan struct{})
+	go func() {
+		b.runnerJobs.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return
+	case <-time.After(b.Config.ShutdownTimeout()):
+	}
+	b.idLogf("runner", "shutdown timed out, cancelling running jobs")
+	close(b.runnerKill)
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		b.idLogf("runner", "error: could not send the final state of cancelled jobs")
+	}
+}
+
 func uppercaseUnderscore(s string) string {
 	s = strings.ReplaceAll(s, "/", "_")
 	s = strings.ReplaceAll(s, "-", "_")
@@ -0,0 +1,231 @@
+package wrench
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+)
+
+// RunnerCA issues and verifies runner client certificates, see Config.RunnerMTLS.
+type RunnerCA struct {
+	Cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// LoadRunnerCA loads the runner CA from Config.RunnerCACertFile and Config.RunnerCAKeyFile,
+// creating a new CA if neither exists.
+func LoadRunnerCA(cfg *Config) (ca *RunnerCA, created bool, err error) {
+	certFile, keyFile := cfg.Path(cfg.RunnerCACertFile), cfg.Path(cfg.RunnerCAKeyFile)
+	certPEM, certErr := os.ReadFile(certFile)
+	keyPEM, keyErr := os.ReadFile(keyFile)
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		ca, err := newRunnerCA(certFile, keyFile)
+		return ca, err == nil, err
+	}
+	if certErr != nil {
+		return nil, false, errors.Wrap(certErr, "RunnerCACertFile")
+	}
+	if keyErr != nil {
+		return nil, false, errors.Wrap(keyErr, "RunnerCAKeyFile")
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "X509KeyPair")
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, false, errors.New("RunnerCAKeyFile: expected an ECDSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, false, errors.Wrap(err, "ParseCertificate")
+	}
+	return &RunnerCA{Cert: cert, key: key}, false, nil
+}
+
+func newRunnerCA(certFile, keyFile string) (*RunnerCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "GenerateKey")
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "wrench runner CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "CreateCertificate")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseCertificate")
+	}
+	keyPEM, err := encodeECKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return nil, errors.Wrap(err, "WriteFile")
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return nil, errors.Wrap(err, "WriteFile")
+	}
+	return &RunnerCA{Cert: cert, key: key}, nil
+}
+
+// Issue creates a client certificate for the given runner ID, returning the certificate and key
+// PEM and the record to store so that it may be verified and revoked.
+func (ca *RunnerCA) Issue(runnerID string, validity time.Duration) (certPEM, keyPEM []byte, record RunnerCert, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, RunnerCert{}, errors.Wrap(err, "GenerateKey")
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, RunnerCert{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: runnerID},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, RunnerCert{}, errors.Wrap(err, "CreateCertificate")
+	}
+	keyPEM, err = encodeECKey(key)
+	if err != nil {
+		return nil, nil, RunnerCert{}, err
+	}
+	record = RunnerCert{
+		Serial:   certSerial(template),
+		RunnerID: runnerID,
+		Issued:   now,
+		Expires:  template.NotAfter,
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, record, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial, errors.Wrap(err, "rand.Int")
+}
+
+func certSerial(cert *x509.Certificate) string {
+	return hex.EncodeToString(cert.SerialNumber.Bytes())
+}
+
+func encodeECKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "MarshalECPrivateKey")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// clientTLSConfig returns the TLS configuration used to talk to the wrench server, or nil if the
+// defaults should be used.
+func (c *Config) clientTLSConfig() (*tls.Config, error) {
+	if c.RunnerCertFile == "" && c.ServerCAFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+	if c.RunnerCertFile != "" {
+		certs := &certReloader{
+			certFile: c.Path(c.RunnerCertFile),
+			keyFile:  c.Path(c.RunnerKeyFile),
+			logf:     func(format string, v ...any) {},
+		}
+		if _, err := certs.GetCertificate(nil); err != nil {
+			return nil, errors.Wrap(err, "RunnerCertFile")
+		}
+		tlsConfig.GetClientCertificate = certs.GetClientCertificate
+	}
+	if c.ServerCAFile != "" {
+		roots, err := loadCertPool(c.Path(c.ServerCAFile))
+		if err != nil {
+			return nil, errors.Wrap(err, "ServerCAFile")
+		}
+		tlsConfig.RootCAs = roots
+	}
+	return tlsConfig, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+type runnerCertKey struct{}
+
+// httpRunnerMTLS checks the client certificate presented to /api/runner/* endpoints, if any, is
+// known and not revoked, and requires one if Config.RunnerMTLS is enabled. The runner ID it was
+// issued to is then checked by checkRunnerCert.
+func (b *Bot) httpRunnerMTLS(handler handlerFunc) handlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			if b.Config.RunnerMTLS {
+				w.WriteHeader(401)
+				_, err := w.Write([]byte("Unauthorised: a runner client certificate is required.\n"))
+				return err
+			}
+			return handler(w, r)
+		}
+		leaf := r.TLS.VerifiedChains[0][0]
+		record, err := b.store.RunnerCert(r.Context(), certSerial(leaf))
+		if err != nil && err != ErrNotFound {
+			return errors.Wrap(err, "RunnerCert")
+		}
+		if err == ErrNotFound || record.Revoked != nil {
+			w.WriteHeader(403)
+			_, err := fmt.Fprintf(w, "Forbidden: runner certificate %s is revoked or unknown.\n", certSerial(leaf))
+			return err
+		}
+		return handler(w, r.WithContext(context.WithValue(r.Context(), runnerCertKey{}, record)))
+	}
+}
+
+// checkRunnerCert returns an error if the request was made with a runner client certificate
+// issued to a different runner than runnerID.
+func checkRunnerCert(ctx context.Context, runnerID string) error {
+	record, ok := ctx.Value(runnerCertKey{}).(RunnerCert)
+	if ok && record.RunnerID != runnerID {
+		return fmt.Errorf("certificate %s was issued to runner %q, not %q", record.Serial, record.RunnerID, runnerID)
+	}
+	return nil
+}
@@ -277,17 +277,28 @@ func (b *Bot) cancelJob(ctx context.Context, scheduledJobID api.JobID, runners [
 	if err != nil {
 		return "", errors.Wrap(err, "failed to query last job")
 	}
-
-	b.idLogf("job-"+string(lastJob.ID), "error: job cancelled")
-	b.idLogf(schedulerLogID, "job cancelled: %v", schedule.Job.Title)
-	lastJob.State = api.JobStateError
-	lastJob.ScheduledStart = time.Time{}
-	if err := b.store.UpsertRunnerJob(ctx, *lastJob); err != nil {
-		return "", errors.Wrap(err, "failed to update job")
+	if lastJob == nil {
+		return "", errors.New("no job found for scheduled job")
+	}
+	if err := b.markJobCancelled(ctx, *lastJob); err != nil {
+		return "", err
 	}
 	return lastJob.ID, nil
 }
 
+// markJobCancelled marks the job as errored, so that it is not started (or, if a runner is
+// already performing it, is considered failed.)
+func (b *Bot) markJobCancelled(ctx context.Context, job api.Job) error {
+	b.idLogf(job.ID.LogID(), "error: job cancelled")
+	b.idLogf(schedulerLogID, "job cancelled: %v", job.Title)
+	job.State = api.JobStateError
+	job.ScheduledStart = time.Time{}
+	if err := b.store.UpsertRunnerJob(ctx, job); err != nil {
+		return errors.Wrap(err, "failed to update job")
+	}
+	return nil
+}
+
 func (b *Bot) lastJobWithTitle(ctx context.Context, title string, filters ...JobsFilter) (*api.Job, error) {
 	lastJobs, err := b.store.Jobs(ctx, append([]JobsFilter{{Title: title}}, filters...)...)
 	if err != nil {
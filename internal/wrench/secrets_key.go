@@ -0,0 +1,166 @@
+package wrench
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hexops/wrench/internal/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// SecretsKeyEnv is the environment variable which may hold the secrets master key, taking
+// precedence over Config.SecretsKeyFile.
+const SecretsKeyEnv = "WRENCH_SECRETS_KEY"
+
+// SecretsKeySize is the size of the secrets master key in bytes.
+const SecretsKeySize = chacha20poly1305.KeySize
+
+// Encrypted secret values are stored as "enc:v1:<key id>:<base64 nonce+ciphertext>". The key ID
+// lets us report a clear error when a row was encrypted with a different key (e.g. after a key
+// rotation the running service doesn't know about), rather than a generic decryption failure.
+const encryptedSecretPrefix = "enc:v1:"
+
+var ErrSecretsKeyMissing = errors.New("secrets key not configured: set Config.SecretsKeyFile or $" + SecretsKeyEnv + " (see 'wrench secret rotate-key -h')")
+
+// LoadSecretsKey loads the secrets master key from $WRENCH_SECRETS_KEY or Config.SecretsKeyFile.
+// It returns nil, nil if neither is configured.
+func (c *Config) LoadSecretsKey() ([]byte, error) {
+	if v := os.Getenv(SecretsKeyEnv); v != "" {
+		key, err := ParseSecretsKey(v)
+		return key, errors.Wrap(err, "$"+SecretsKeyEnv)
+	}
+	if c.SecretsKeyFile == "" {
+		return nil, nil
+	}
+	path := c.Path(c.SecretsKeyFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "SecretsKeyFile")
+	}
+	key, err := ParseSecretsKey(string(data))
+	return key, errors.Wrap(err, path)
+}
+
+// ParseSecretsKey parses a base64-encoded secrets master key.
+func ParseSecretsKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid base64")
+	}
+	if len(key) != SecretsKeySize {
+		return nil, fmt.Errorf("expected %v byte key, found %v bytes", SecretsKeySize, len(key))
+	}
+	return key, nil
+}
+
+// GenerateSecretsKey generates a new random secrets master key.
+func GenerateSecretsKey() ([]byte, error) {
+	key := make([]byte, SecretsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WriteSecretsKeyFile writes the base64-encoded key to a new file readable only by its owner.
+func WriteSecretsKeyFile(path string, key []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, base64.StdEncoding.EncodeToString(key)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type secretsCipher struct {
+	keyID string
+	aead  cipher.AEAD
+}
+
+func newSecretsCipher(key []byte) (*secretsCipher, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &secretsCipher{keyID: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// encrypt encrypts a secret value with a random per-row nonce. The secret ID is authenticated as
+// additional data, so a ciphertext cannot be copied to another row.
+func (c *secretsCipher) encrypt(id, value string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(value)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), []byte(id))
+	return encryptedSecretPrefix + c.keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *secretsCipher) decrypt(id, stored string) (string, error) {
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(stored, encryptedSecretPrefix), ":")
+	if !strings.HasPrefix(stored, encryptedSecretPrefix) || !ok {
+		return "", fmt.Errorf("secret %q: not encrypted", id)
+	}
+	if keyID != c.keyID {
+		return "", fmt.Errorf("secret %q: encrypted with key %s, but the configured key is %s (was the key rotated?)", id, keyID, c.keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.Wrapf(err, "secret %q", id)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", fmt.Errorf("secret %q: ciphertext too short", id)
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", errors.Wrapf(err, "secret %q: decrypt", id)
+	}
+	return string(plaintext), nil
+}
+
+func isEncryptedSecret(stored string) bool {
+	return strings.HasPrefix(stored, encryptedSecretPrefix)
+}
+
+// secretsKeyStart configures the store's secrets key, refusing to start if secrets are stored
+// but no key is configured.
+func (b *Bot) secretsKeyStart(ctx context.Context) error {
+	key, err := b.Config.LoadSecretsKey()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		ids, err := b.store.SecretIDs(ctx)
+		if err != nil {
+			return errors.Wrap(err, "SecretIDs")
+		}
+		if len(ids) > 0 {
+			return fmt.Errorf("wrench.db contains %v secrets but they cannot be used: %w", len(ids), ErrSecretsKeyMissing)
+		}
+		b.logf("secrets: disabled (no secrets key configured)")
+		return nil
+	}
+	if err := b.store.SetSecretsKey(key); err != nil {
+		return errors.Wrap(err, "SetSecretsKey")
+	}
+	n, err := b.store.EncryptPlaintextSecrets(ctx)
+	if err != nil {
+		return errors.Wrap(err, "EncryptPlaintextSecrets")
+	}
+	if n > 0 {
+		b.logf("secrets: encrypted %v secrets previously stored in plaintext", n)
+	}
+	return nil
+}
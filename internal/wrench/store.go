@@ -12,110 +12,191 @@ import (
 	"github.com/hexops/wrench/internal/wrench/api"
 	"github.com/jxskiss/base62"
 	"github.com/keegancsmith/sqlf"
+)
+
+// Store is the persistent storage used by a wrench server: logs, stats, runners, secrets, the
+// cache and runner jobs. Use OpenStore to open the backend selected by Config.StoreBackend.
+type Store interface {
+	Log(ctx context.Context, id, message string) error
+	AppendLog(ctx context.Context, id, message string) (Log, error)
+	Logs(ctx context.Context, id string) ([]Log, error)
+	LogIDs(ctx context.Context) ([]string, error)
+	SearchLogs(ctx context.Context, query LogSearchQuery) ([]api.LogSearchResult, error)
+
+	RecordStat(ctx context.Context, stat api.Stat) error
+	Stats(ctx context.Context, id string) ([]api.Stat, error)
+	StatIDs(ctx context.Context) ([]string, error)
+
+	RunnerSeen(ctx context.Context, id, arch string, env api.RunnerEnv) error
+	Runners(ctx context.Context) ([]api.Runner, error)
+	RecordRunnerCert(ctx context.Context, cert RunnerCert) error
+	RunnerCert(ctx context.Context, serial string) (RunnerCert, error)
+	RunnerCerts(ctx context.Context, runnerID string) ([]RunnerCert, error)
+	RevokeRunnerCert(ctx context.Context, serial string) error
+
+	NewRunnerJob(ctx context.Context, job api.Job) (api.JobID, error)
+	UpsertRunnerJob(ctx context.Context, job api.Job) error
+	JobByID(ctx context.Context, id api.JobID) (api.Job, error)
+	JobEvents(ctx context.Context, id api.JobID) ([]api.JobEvent, error)
+	JobCounts(ctx context.Context) ([]JobCount, error)
+	Jobs(ctx context.Context, filters ...JobsFilter) ([]api.Job, error)
+
+	CacheSet(ctx context.Context, cacheName, key, value string, expires *time.Time) error
+	CacheKey(ctx context.Context, cacheName, key string) (*CacheEntry, error)
+
+	SetSecretsKey(key []byte) error
+	Secret(ctx context.Context, id string) (Secret, error)
+	Secrets(ctx context.Context) ([]Secret, error)
+	SecretIDs(ctx context.Context) ([]string, error)
+	UpsertSecret(ctx context.Context, id, value string) error
+	DeleteSecret(ctx context.Context, id string) error
+	EncryptPlaintextSecrets(ctx context.Context) (int, error)
+	RotateSecretsKey(ctx context.Context, newKey []byte) (int, error)
+
+	RecordAudit(ctx context.Context, event api.AuditEvent) error
+	AuditEvents(ctx context.Context, filter AuditFilter) ([]api.AuditEvent, error)
+	CreateSession(ctx context.Context, session Session) error
+	Session(ctx context.Context, tokenHash string) (Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteSessions(ctx context.Context, login string) error
+	SessionLogins(ctx context.Context) ([]string, error)
+	CreateAPIToken(ctx context.Context, token APIToken) (int64, error)
+	APITokenByHash(ctx context.Context, tokenHash string) (APIToken, error)
+	APITokens(ctx context.Context, login string) ([]APIToken, error)
+	DeleteAPIToken(ctx context.Context, login string, id int64) error
+	RecordAuthCheck(ctx context.Context, check AuthCheck) error
+	AuthCheck(ctx context.Context, login string) (AuthCheck, error)
+
+	SchemaVersion(ctx context.Context) (int, error)
+	PendingMigrations(ctx context.Context) ([]Migration, error)
+	Migrate(ctx context.Context, dryRun bool) ([]Migration, error)
+	Purge(ctx context.Context, cfg RetentionConfig, dryRun bool) (*PurgeReport, error)
+
+	Close() error
+}
+
+// BackupStore is implemented by stores which support online backups to a file, currently only
+// SQLite. Postgres deployments should use their usual tooling (pg_dump, replicas, etc.)
+type BackupStore interface {
+	Store
+	Backup(ctx context.Context, dst string) error
+}
 
-	_ "modernc.org/sqlite" // from https://gitlab.com/cznic/sqlite
+// Store backends, see Config.StoreBackend.
+const (
+	StoreBackendSQLite   = "sqlite"
+	StoreBackendPostgres = "postgres"
 )
 
-type Store struct {
-	db *sql.DB
+// OpenStore opens the store configured by Config.StoreBackend and applies any pending schema
+// migrations.
+func OpenStore(c *Config) (Store, error) {
+	s, err := OpenStoreNoMigrate(c)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Migrate(context.Background(), false); err != nil {
+		_ = s.Close()
+		return nil, errors.Wrap(err, "Migrate")
+	}
+	return s, nil
 }
 
-func OpenStore(path string) (*Store, error) {
-	db, err := sql.Open("sqlite", path)
+// OpenStoreNoMigrate opens the store without applying any pending schema migrations, e.g. for
+// inspecting a database with 'wrench store migrate -dry-run'.
+//
+// It still refuses to open a database whose schema is newer than this binary understands.
+func OpenStoreNoMigrate(c *Config) (Store, error) {
+	switch c.StoreBackend {
+	case "", StoreBackendSQLite:
+		s, err := openSQLiteStore(c.StoreDSN())
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case StoreBackendPostgres:
+		if c.PostgresURL == "" {
+			return nil, errors.New("StoreBackend is postgres, but PostgresURL is not set")
+		}
+		s, err := openPostgresStore(c.PostgresURL)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown StoreBackend %q (expected %q or %q)", c.StoreBackend, StoreBackendSQLite, StoreBackendPostgres)
+	}
+}
+
+// storeDialect describes the differences between the SQL databases sqlStore supports.
+type storeDialect struct {
+	name    string
+	bindVar sqlf.BindVar
+
+	// Column type for timestamps, which must preserve the time zone offset.
+	timestampType string
+
+	// Query returning whether the schema_version table exists.
+	schemaVersionTableExists string
+
+	// searchLogs returns a query for log messages containing the phrase, most recent first. Each
+	// row is the log ID, time, and a snippet of the message with matches wrapped in
+	// logSearchMatchStart and logSearchMatchEnd.
+	searchLogs func(phrase string, conds *sqlf.Query, limit int) *sqlf.Query
+}
+
+// sqlStore implements Store on top of database/sql. The queries are shared between backends and
+// written in the common subset of SQLite and Postgres SQL; the differences live in storeDialect
+// and the per-dialect migrations.
+type sqlStore struct {
+	db      *sql.DB
+	dialect *storeDialect
+	secrets *secretsCipher
+}
+
+func openSQLStore(driverName, dsn string, dialect *storeDialect) (*sqlStore, error) {
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		return nil, errors.Wrap(err, "Open")
 	}
-	s := &Store{db: db}
-	if err := s.ensureSchema(); err != nil {
+	s := &sqlStore{db: db, dialect: dialect}
+	if err := s.checkSchemaVersion(context.Background()); err != nil {
 		_ = db.Close()
-		return nil, errors.Wrap(err, "ensureSchema")
+		return nil, err
 	}
 	return s, nil
 }
 
-func (s *Store) ensureSchema() error {
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS logs (
-			logid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			id TEXT NOT NULL,
-			message TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS stats (
-			statid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			id TEXT NOT NULL,
-			value INTEGER NOT NULL,
-			type TEXT NOT NULL,
-			metadata BLOB NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS runners (
-			id TEXT PRIMARY KEY NOT NULL,
-			arch TEXT NOT NULL,
-			env TEXT NOT NULL,
-			registered_at TIMESTAMP NOT NULL,
-			last_seen_at TIMESTAMP NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS secrets (
-			id TEXT PRIMARY KEY NOT NULL,
-			value TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS cache (
-			cache_name TEXT NOT NULL,
-			key TEXT NOT NULL,
-			value TEXT NOT NULL,
-			updated_at TIMESTAMP NOT NULL,
-			created_at TIMESTAMP NOT NULL,
-			expires_at TIMESTAMP,
-			PRIMARY KEY (cache_name, key)
-		);
-		CREATE TABLE IF NOT EXISTS runner_jobs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
-			state TEXT NOT NULL,
-			title TEXT NOT NULL,
-			target_runner_id TEXT NOT NULL,
-			target_runner_arch TEXT NOT NULL,
-			payload TEXT NOT NULL,
-			scheduled_start_at TIMESTAMP,
-			updated_at TIMESTAMP NOT NULL,
-			created_at TIMESTAMP NOT NULL
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_logs_id ON logs (id);
-
-		CREATE INDEX IF NOT EXISTS idx_stats_id ON stats (id);
-
-		CREATE INDEX IF NOT EXISTS idx_cache_cache_name ON cache (cache_name);
-		CREATE INDEX IF NOT EXISTS idx_cache_key ON cache (key);
-
-		CREATE INDEX IF NOT EXISTS idx_runner_jobs_state ON runner_jobs (state);
-		CREATE INDEX IF NOT EXISTS idx_runner_jobs_title ON runner_jobs (title);
-		CREATE INDEX IF NOT EXISTS idx_runner_jobs_target_runner_id ON runner_jobs (target_runner_id);
-		CREATE INDEX IF NOT EXISTS idx_runner_jobs_id ON runner_jobs (id);
-	`)
+func (s *sqlStore) Log(ctx context.Context, id, message string) error {
+	_, err := s.AppendLog(ctx, id, message)
 	return err
 }
 
-func (s *Store) Log(ctx context.Context, id, message string) error {
+// AppendLog is like Log, but returns the log line as stored.
+func (s *sqlStore) AppendLog(ctx context.Context, id, message string) (Log, error) {
+	log := Log{Time: time.Now(), Message: strings.TrimSpace(message)}
 	q := sqlf.Sprintf(
-		"INSERT INTO logs(timestamp, id, message) VALUES(%v, %v, %v)",
-		time.Now(),
+		"INSERT INTO logs(timestamp, id, message) VALUES(%v, %v, %v) RETURNING logid",
+		log.Time,
 		id,
-		strings.TrimSpace(message),
+		log.Message,
 	)
-	_, err := s.db.ExecContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
-	return err
+	err := s.db.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan(&log.ID)
+	return log, errors.Wrap(err, "Scan")
 }
 
 type Log struct {
+	// ID increases with every log line written, across all logs, so it orders the lines of a log
+	// even when their timestamps are equal.
+	ID      int64
 	Time    time.Time
 	Message string
 }
 
-func (s *Store) Logs(ctx context.Context, id string) ([]Log, error) {
-	q := sqlf.Sprintf(`SELECT * FROM (SELECT timestamp, message FROM logs WHERE id=%v) ORDER BY timestamp`, id)
+func (s *sqlStore) Logs(ctx context.Context, id string) ([]Log, error) {
+	q := sqlf.Sprintf(`SELECT logid, timestamp, message FROM logs WHERE id=%v ORDER BY logid`, id)
 
-	rows, err := s.db.QueryContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "QueryContext")
 	}
@@ -123,7 +204,7 @@ func (s *Store) Logs(ctx context.Context, id string) ([]Log, error) {
 	var logs []Log
 	for rows.Next() {
 		var log Log
-		if err = rows.Scan(&log.Time, &log.Message); err != nil {
+		if err = rows.Scan(&log.ID, &log.Time, &log.Message); err != nil {
 			return nil, errors.Wrap(err, "Scan")
 		}
 		logs = append(logs, log)
@@ -131,10 +212,10 @@ func (s *Store) Logs(ctx context.Context, id string) ([]Log, error) {
 	return logs, rows.Err()
 }
 
-func (s *Store) LogIDs(ctx context.Context) ([]string, error) {
-	q := sqlf.Sprintf(`SELECT * FROM (SELECT DISTINCT id FROM logs) ORDER BY id`)
+func (s *sqlStore) LogIDs(ctx context.Context) ([]string, error) {
+	q := sqlf.Sprintf(`SELECT DISTINCT id FROM logs ORDER BY id`)
 
-	rows, err := s.db.QueryContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "QueryContext")
 	}
@@ -150,7 +231,7 @@ func (s *Store) LogIDs(ctx context.Context) ([]string, error) {
 	return ids, rows.Err()
 }
 
-func (s *Store) RecordStat(ctx context.Context, stat api.Stat) error {
+func (s *sqlStore) RecordStat(ctx context.Context, stat api.Stat) error {
 	jsonBlob, err := json.Marshal(stat.Metadata)
 	if err != nil {
 		return errors.Wrap(err, "Marshal metadata")
@@ -163,14 +244,14 @@ func (s *Store) RecordStat(ctx context.Context, stat api.Stat) error {
 		stat.Type,
 		jsonBlob,
 	)
-	_, err = s.db.ExecContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	_, err = s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	return err
 }
 
-func (s *Store) Stats(ctx context.Context, id string) ([]api.Stat, error) {
-	q := sqlf.Sprintf(`SELECT * FROM (SELECT timestamp, value, type, metadata FROM stats WHERE id=%v) ORDER BY timestamp`, id)
+func (s *sqlStore) Stats(ctx context.Context, id string) ([]api.Stat, error) {
+	q := sqlf.Sprintf(`SELECT timestamp, value, type, metadata FROM stats WHERE id=%v ORDER BY timestamp`, id)
 
-	rows, err := s.db.QueryContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "QueryContext")
 	}
@@ -191,10 +272,10 @@ func (s *Store) Stats(ctx context.Context, id string) ([]api.Stat, error) {
 	return stats, rows.Err()
 }
 
-func (s *Store) StatIDs(ctx context.Context) ([]string, error) {
-	q := sqlf.Sprintf(`SELECT * FROM (SELECT DISTINCT id FROM stats) ORDER BY id`)
+func (s *sqlStore) StatIDs(ctx context.Context) ([]string, error) {
+	q := sqlf.Sprintf(`SELECT DISTINCT id FROM stats ORDER BY id`)
 
-	rows, err := s.db.QueryContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "QueryContext")
 	}
@@ -210,7 +291,7 @@ func (s *Store) StatIDs(ctx context.Context) ([]string, error) {
 	return ids, rows.Err()
 }
 
-func (s *Store) RunnerSeen(ctx context.Context, id, arch string, env api.RunnerEnv) error {
+func (s *sqlStore) RunnerSeen(ctx context.Context, id, arch string, env api.RunnerEnv) error {
 	now := time.Now()
 	envJSON, err := json.Marshal(env)
 	if err != nil {
@@ -218,18 +299,18 @@ func (s *Store) RunnerSeen(ctx context.Context, id, arch string, env api.RunnerE
 	}
 	q := sqlf.Sprintf(
 		`INSERT INTO runners(id, arch, registered_at, last_seen_at, env) VALUES (%v, %v, %v, %v, %v)
-		ON CONFLICT(id) DO UPDATE SET arch = %v, last_seen_at = %v, env = %v WHERE id=%v`,
+		ON CONFLICT(id) DO UPDATE SET arch = %v, last_seen_at = %v, env = %v`,
 		id, arch, now, now, string(envJSON),
-		arch, now, string(envJSON), id,
+		arch, now, string(envJSON),
 	)
-	_, err = s.db.ExecContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	_, err = s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	return err
 }
 
-func (s *Store) Runners(ctx context.Context) ([]api.Runner, error) {
+func (s *sqlStore) Runners(ctx context.Context) ([]api.Runner, error) {
 	q := sqlf.Sprintf(`SELECT id, arch, env, registered_at, last_seen_at FROM runners ORDER BY id`)
 
-	rows, err := s.db.QueryContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "QueryContext")
 	}
@@ -249,7 +330,7 @@ func (s *Store) Runners(ctx context.Context) ([]api.Runner, error) {
 	return runners, rows.Err()
 }
 
-func (s *Store) NewRunnerJob(ctx context.Context, job api.Job) (api.JobID, error) {
+func (s *sqlStore) NewRunnerJob(ctx context.Context, job api.Job) (api.JobID, error) {
 	now := time.Now()
 	job.State = api.JobStateReady
 	job.Updated = now
@@ -286,18 +367,38 @@ func (s *Store) NewRunnerJob(ctx context.Context, job api.Job) (api.JobID, error
 		job.Updated,
 		job.Created,
 	)
-	row := s.db.QueryRowContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "BeginTx")
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	row := tx.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	id, err := s.scanUint64(row.Scan)
 	if err != nil {
 		return "", errors.Wrap(err, "scanJob")
 	}
-	return encodeJobID(id), nil
+	if err := s.recordJobEvent(ctx, tx, id, job); err != nil {
+		return "", err
+	}
+	return encodeJobID(id), errors.Wrap(tx.Commit(), "Commit")
 }
 
 func encodeJobID(id uint64) api.JobID {
 	return api.JobID(base62.EncodeToString(base62.FormatUint(id)))
 }
 
+// validJobID reports whether id is a well-formed job ID, e.g. before passing user input to
+// mustDecodeJobID.
+func validJobID(id api.JobID) bool {
+	bytes, err := base62.DecodeString(string(id))
+	if err != nil || len(bytes) == 0 {
+		return false
+	}
+	_, err = base62.ParseUint(bytes)
+	return err == nil
+}
+
 func mustDecodeJobID(id api.JobID) uint64 {
 	bytes, err := base62.DecodeString(string(id))
 	if err != nil {
@@ -310,7 +411,7 @@ func mustDecodeJobID(id api.JobID) uint64 {
 	return v
 }
 
-func (s *Store) UpsertRunnerJob(ctx context.Context, job api.Job) error {
+func (s *sqlStore) UpsertRunnerJob(ctx context.Context, job api.Job) error {
 	now := time.Now()
 	job.Updated = now
 	job.Created = now
@@ -347,8 +448,7 @@ func (s *Store) UpsertRunnerJob(ctx context.Context, job api.Job) error {
 			target_runner_arch = %v,
 			payload = %v,
 			scheduled_start_at = %v,
-			updated_at = %v
-		WHERE id = %v`,
+			updated_at = %v`,
 		mustDecodeJobID(job.ID),
 		job.State,
 		job.Title,
@@ -365,10 +465,28 @@ func (s *Store) UpsertRunnerJob(ctx context.Context, job api.Job) error {
 		string(payload),
 		scheduledStart,
 		job.Updated,
-		mustDecodeJobID(job.ID),
 	)
-	_, err = s.db.ExecContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
-	return err
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTx")
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	id := mustDecodeJobID(job.ID)
+	previous, err := s.jobState(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+		return err
+	}
+	if previous != job.State {
+		if err := s.recordJobEvent(ctx, tx, id, job); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(tx.Commit(), "Commit")
 }
 
 const jobFields = `
@@ -385,7 +503,7 @@ const jobFields = `
 
 var ErrNotFound = errors.New("not found")
 
-func (s *Store) JobByID(ctx context.Context, id api.JobID) (api.Job, error) {
+func (s *sqlStore) JobByID(ctx context.Context, id api.JobID) (api.Job, error) {
 	jobs, err := s.Jobs(ctx, JobsFilter{ID: id})
 	if err != nil {
 		return api.Job{}, err
@@ -403,27 +521,13 @@ type JobsFilter struct {
 	TargetRunnerID              string
 	ID                          api.JobID
 	Limit                       int
-}
-
-var lastPurge time.Time
 
-func (s *Store) purgeOldData(ctx context.Context) error {
-	if !lastPurge.IsZero() && time.Since(lastPurge) < 24*time.Hour {
-		return nil
-	}
-	lastPurge = time.Now()
-	_, err := s.db.ExecContext(ctx, `
-		DELETE FROM runner_jobs WHERE created_at < datetime('now', '-30 days');
-		DELETE FROM logs WHERE timestamp < datetime('now', '-30 days');
-	`)
-	return err
+	// IDLessThan only matches jobs older than the given job, for paginating through Jobs results
+	// (which are ordered newest first.)
+	IDLessThan api.JobID
 }
 
-func (s *Store) Jobs(ctx context.Context, filters ...JobsFilter) ([]api.Job, error) {
-	if err := s.purgeOldData(ctx); err != nil {
-		return nil, errors.Wrap(err, "purgeOldData")
-	}
-
+func (s *sqlStore) Jobs(ctx context.Context, filters ...JobsFilter) ([]api.Job, error) {
 	var conds []*sqlf.Query
 	limit := sqlf.Sprintf("")
 	for _, where := range filters {
@@ -448,6 +552,9 @@ func (s *Store) Jobs(ctx context.Context, filters ...JobsFilter) ([]api.Job, err
 		if where.ID != "" {
 			conds = append(conds, sqlf.Sprintf("id = %v", mustDecodeJobID(where.ID)))
 		}
+		if where.IDLessThan != "" {
+			conds = append(conds, sqlf.Sprintf("id < %v", mustDecodeJobID(where.IDLessThan)))
+		}
 		if where.Limit != 0 {
 			limit = sqlf.Sprintf(" LIMIT %v", where.Limit)
 		}
@@ -459,7 +566,7 @@ func (s *Store) Jobs(ctx context.Context, filters ...JobsFilter) ([]api.Job, err
 	}
 	q := sqlf.Sprintf(`SELECT `+jobFields+` FROM runner_jobs %s ORDER BY id DESC%v`, whereClause, limit)
 
-	rows, err := s.db.QueryContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "QueryContext")
 	}
@@ -475,7 +582,32 @@ func (s *Store) Jobs(ctx context.Context, filters ...JobsFilter) ([]api.Job, err
 	return jobs, rows.Err()
 }
 
-func (s *Store) scanJob(scan func(...any) error) (*api.Job, error) {
+type JobCount struct {
+	State api.JobState
+	Title string
+	Count int64
+}
+
+// JobCounts returns the number of jobs in each state, by title.
+func (s *sqlStore) JobCounts(ctx context.Context) ([]JobCount, error) {
+	q := sqlf.Sprintf(`SELECT state, title, COUNT(*) FROM runner_jobs GROUP BY state, title`)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+
+	var counts []JobCount
+	for rows.Next() {
+		var c JobCount
+		if err := rows.Scan(&c.State, &c.Title, &c.Count); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func (s *sqlStore) scanJob(scan func(...any) error) (*api.Job, error) {
 	var j api.Job
 	var payload string
 	var id uint64
@@ -503,7 +635,7 @@ func (s *Store) scanJob(scan func(...any) error) (*api.Job, error) {
 	return &j, nil
 }
 
-func (s *Store) scanUint64(scan func(...any) error) (uint64, error) {
+func (s *sqlStore) scanUint64(scan func(...any) error) (uint64, error) {
 	var v uint64
 	if err := scan(&v); err != nil {
 		return 0, errors.Wrap(err, "Scan")
@@ -511,20 +643,18 @@ func (s *Store) scanUint64(scan func(...any) error) (uint64, error) {
 	return v, nil
 }
 
-func (s *Store) CacheSet(ctx context.Context, cacheName, key, value string, expires *time.Time) error {
+func (s *sqlStore) CacheSet(ctx context.Context, cacheName, key, value string, expires *time.Time) error {
 	now := time.Now()
 	q := sqlf.Sprintf(
 		`INSERT INTO cache(cache_name, key, value, updated_at, created_at, expires_at) VALUES (%v, %v, %v, %v, %v, %v)
 		ON CONFLICT(cache_name, key) DO UPDATE SET
 			value = %v,
 			updated_at = %v,
-			expires_at = %v
-		WHERE cache_name = %v AND key = %v`,
+			expires_at = %v`,
 		cacheName, key, value, now, now, expires,
 		value, now, expires,
-		cacheName, key,
 	)
-	_, err := s.db.ExecContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	return err
 }
 
@@ -535,11 +665,11 @@ type CacheEntry struct {
 	Expires *time.Time
 }
 
-func (s *Store) CacheKey(ctx context.Context, cacheName, key string) (*CacheEntry, error) {
+func (s *sqlStore) CacheKey(ctx context.Context, cacheName, key string) (*CacheEntry, error) {
 	q := sqlf.Sprintf(`SELECT value, updated_at, created_at, expires_at
-		FROM cache WHERE cache_name = %v AND key = %v`, cacheName, key)
+		FROM cache WHERE cache_name = %v AND key = %v AND (expires_at IS NULL OR expires_at > %v)`, cacheName, key, time.Now())
 
-	row := s.db.QueryRowContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	row := s.db.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	var e CacheEntry
 	if err := row.Scan(&e.Value, &e.Updated, &e.Created, &e.Expires); err != nil {
 		return nil, errors.Wrap(err, "Scan")
@@ -555,21 +685,47 @@ type Secret struct {
 // Redaction stringer in case it ever gets printed anywhere.
 func (s Secret) String() string { return "<redacted>" }
 
-func (s *Store) Secret(ctx context.Context, id string) (Secret, error) {
+// SetSecretsKey sets the master key used to encrypt secret values at rest. Without it, reading or
+// writing secret values fails with ErrSecretsKeyMissing.
+func (s *sqlStore) SetSecretsKey(key []byte) error {
+	c, err := newSecretsCipher(key)
+	if err != nil {
+		return err
+	}
+	s.secrets = c
+	return nil
+}
+
+func (s *sqlStore) decryptSecret(id, stored string) (string, error) {
+	if s.secrets == nil {
+		return "", ErrSecretsKeyMissing
+	}
+	if !isEncryptedSecret(stored) {
+		// Stored before secrets were encrypted; EncryptPlaintextSecrets takes care of these.
+		return stored, nil
+	}
+	return s.secrets.decrypt(id, stored)
+}
+
+func (s *sqlStore) Secret(ctx context.Context, id string) (Secret, error) {
 	q := sqlf.Sprintf(`SELECT value FROM secrets WHERE id = %v`, id)
 
-	row := s.db.QueryRowContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	row := s.db.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	var value string
 	if err := row.Scan(&value); err != nil {
 		return Secret{}, errors.Wrap(err, "Scan")
 	}
+	value, err := s.decryptSecret(id, value)
+	if err != nil {
+		return Secret{}, err
+	}
 	return Secret{ID: id, Value: value}, nil
 }
 
-func (s *Store) Secrets(ctx context.Context) ([]Secret, error) {
+func (s *sqlStore) Secrets(ctx context.Context) ([]Secret, error) {
 	q := sqlf.Sprintf(`SELECT id, value FROM secrets ORDER BY id DESC`)
 
-	rows, err := s.db.QueryContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "QueryContext")
 	}
@@ -580,28 +736,132 @@ func (s *Store) Secrets(ctx context.Context) ([]Secret, error) {
 		if err = rows.Scan(&id, &value); err != nil {
 			return nil, errors.Wrap(err, "Scan")
 		}
+		value, err = s.decryptSecret(id, value)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
 		secrets = append(secrets, Secret{ID: id, Value: value})
 	}
 	return secrets, rows.Err()
 }
 
-func (s *Store) UpsertSecret(ctx context.Context, id, value string) error {
+// SecretIDs returns the IDs of all secrets. Unlike Secrets, it does not require the secrets key.
+func (s *sqlStore) SecretIDs(ctx context.Context) ([]string, error) {
+	q := sqlf.Sprintf(`SELECT id FROM secrets ORDER BY id DESC`)
+
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *sqlStore) UpsertSecret(ctx context.Context, id, value string) error {
+	if s.secrets == nil {
+		return ErrSecretsKeyMissing
+	}
+	value, err := s.secrets.encrypt(id, value)
+	if err != nil {
+		return errors.Wrap(err, "encrypt")
+	}
 	q := sqlf.Sprintf(
 		`INSERT INTO secrets(id, value) VALUES (%v, %v)
-		ON CONFLICT(id) DO UPDATE SET value = %v WHERE id=%v`,
+		ON CONFLICT(id) DO UPDATE SET value = %v`,
 		id, value,
-		value, id,
+		value,
 	)
-	_, err := s.db.ExecContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	_, err = s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	return err
 }
 
-func (s *Store) DeleteSecret(ctx context.Context, id string) error {
+// EncryptPlaintextSecrets encrypts any secrets stored before encryption at rest was introduced,
+// returning the number of secrets encrypted.
+func (s *sqlStore) EncryptPlaintextSecrets(ctx context.Context) (int, error) {
+	if s.secrets == nil {
+		return 0, ErrSecretsKeyMissing
+	}
+	return s.reencryptSecrets(ctx, s.secrets, true)
+}
+
+// RotateSecretsKey re-encrypts all secrets with newKey in a single transaction, and uses newKey
+// from then on. Any other process using the old key (e.g. the running service) must be restarted
+// with the new key.
+func (s *sqlStore) RotateSecretsKey(ctx context.Context, newKey []byte) (int, error) {
+	c, err := newSecretsCipher(newKey)
+	if err != nil {
+		return 0, err
+	}
+	n, err := s.reencryptSecrets(ctx, c, false)
+	if err != nil {
+		return 0, err
+	}
+	s.secrets = c
+	return n, nil
+}
+
+func (s *sqlStore) reencryptSecrets(ctx context.Context, c *secretsCipher, onlyPlaintext bool) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "BeginTx")
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, value FROM secrets`)
+	if err != nil {
+		return 0, errors.Wrap(err, "QueryContext")
+	}
+	var secrets []Secret
+	for rows.Next() {
+		var secret Secret
+		if err = rows.Scan(&secret.ID, &secret.Value); err != nil {
+			_ = rows.Close()
+			return 0, errors.Wrap(err, "Scan")
+		}
+		if onlyPlaintext && isEncryptedSecret(secret.Value) {
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, secret := range secrets {
+		value := secret.Value
+		if isEncryptedSecret(value) {
+			value, err = s.decryptSecret(secret.ID, value)
+			if err != nil {
+				return 0, err
+			}
+		}
+		value, err = c.encrypt(secret.ID, value)
+		if err != nil {
+			return 0, errors.Wrap(err, "encrypt")
+		}
+		q := sqlf.Sprintf(`UPDATE secrets SET value = %v WHERE id = %v`, value, secret.ID)
+		if _, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+			return 0, errors.Wrap(err, "UPDATE")
+		}
+	}
+	return len(secrets), errors.Wrap(tx.Commit(), "Commit")
+}
+
+func (s *sqlStore) DeleteSecret(ctx context.Context, id string) error {
 	q := sqlf.Sprintf(`DELETE FROM secrets WHERE id = %v`, id)
-	_, err := s.db.ExecContext(ctx, q.Query(sqlf.SimpleBindVar), q.Args()...)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
 	return err
 }
 
-func (s *Store) Close() error {
+func (s *sqlStore) Close() error {
 	return s.db.Close()
 }
@@ -0,0 +1,66 @@
+package wrench
+
+import (
+	"context"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/keegancsmith/sqlf"
+)
+
+// RecordAudit appends an event to the audit log. The audit table is append-only: the database
+// rejects any UPDATE or DELETE, and it is not subject to data retention.
+func (s *sqlStore) RecordAudit(ctx context.Context, event api.AuditEvent) error {
+	q := sqlf.Sprintf(
+		"INSERT INTO audit(timestamp, actor, source, action, target) VALUES(%v, %v, %v, %v, %v)",
+		event.Time,
+		event.Actor,
+		event.Source,
+		event.Action,
+		event.Target,
+	)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return err
+}
+
+type AuditFilter struct {
+	Actor, Action string
+
+	// Maximum number of events, defaults to 100.
+	Limit int
+}
+
+// AuditEvents returns audit events matching the filter, most recent first.
+func (s *sqlStore) AuditEvents(ctx context.Context, filter AuditFilter) ([]api.AuditEvent, error) {
+	conds := []*sqlf.Query{sqlf.Sprintf("TRUE")}
+	if filter.Actor != "" {
+		conds = append(conds, sqlf.Sprintf("actor = %v", filter.Actor))
+	}
+	if filter.Action != "" {
+		conds = append(conds, sqlf.Sprintf("action = %v", filter.Action))
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	q := sqlf.Sprintf(
+		`SELECT timestamp, actor, source, action, target FROM audit WHERE %s ORDER BY auditid DESC LIMIT %v`,
+		sqlf.Join(conds, "AND"),
+		limit,
+	)
+
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+
+	var events []api.AuditEvent
+	for rows.Next() {
+		var e api.AuditEvent
+		if err = rows.Scan(&e.Time, &e.Actor, &e.Source, &e.Action, &e.Target); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,186 @@
+package wrench
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/keegancsmith/sqlf"
+)
+
+// Session is a signed in web UI user. Only a hash of the session cookie token is stored.
+type Session struct {
+	TokenHash string
+	Login     string
+	Role      Role
+	Created   time.Time
+	Expires   time.Time
+}
+
+// APIToken is a personal API token. Only a hash of the token is stored.
+type APIToken struct {
+	ID        int64
+	TokenHash string
+	Name      string
+	Login     string
+	Role      Role
+	Created   time.Time
+}
+
+// AuthCheck is the outcome of the latest check of a user's roles per Config.Auth, made when they
+// signed in. Role is empty if they were not allowed to sign in.
+type AuthCheck struct {
+	Login   string
+	Role    Role
+	Checked time.Time
+}
+
+func (s *sqlStore) CreateSession(ctx context.Context, session Session) error {
+	q := sqlf.Sprintf(
+		"INSERT INTO sessions(token_hash, login, role, created_at, expires_at) VALUES(%v, %v, %v, %v, %v)",
+		session.TokenHash,
+		session.Login,
+		session.Role,
+		session.Created,
+		session.Expires,
+	)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return err
+}
+
+// Session returns the session with the given token hash, or ErrNotFound if there is no such
+// session or it has expired.
+func (s *sqlStore) Session(ctx context.Context, tokenHash string) (Session, error) {
+	q := sqlf.Sprintf(
+		`SELECT token_hash, login, role, created_at, expires_at FROM sessions WHERE token_hash = %v AND expires_at > %v`,
+		tokenHash,
+		time.Now(),
+	)
+	var session Session
+	err := s.db.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan(
+		&session.TokenHash,
+		&session.Login,
+		&session.Role,
+		&session.Created,
+		&session.Expires,
+	)
+	if err == sql.ErrNoRows {
+		return Session{}, ErrNotFound
+	}
+	return session, errors.Wrap(err, "Scan")
+}
+
+func (s *sqlStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	q := sqlf.Sprintf("DELETE FROM sessions WHERE token_hash = %v", tokenHash)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return err
+}
+
+// DeleteSessions signs a user out everywhere.
+func (s *sqlStore) DeleteSessions(ctx context.Context, login string) error {
+	q := sqlf.Sprintf("DELETE FROM sessions WHERE login = %v", login)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return err
+}
+
+// SessionLogins returns the users who are signed in, i.e. have a session which has not expired.
+func (s *sqlStore) SessionLogins(ctx context.Context) ([]string, error) {
+	q := sqlf.Sprintf(`SELECT DISTINCT login FROM sessions WHERE expires_at > %v ORDER BY login`, time.Now())
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+
+	var logins []string
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		logins = append(logins, login)
+	}
+	return logins, rows.Err()
+}
+
+func (s *sqlStore) CreateAPIToken(ctx context.Context, token APIToken) (int64, error) {
+	q := sqlf.Sprintf(
+		`INSERT INTO api_tokens(token_hash, name, login, role, created_at) VALUES(%v, %v, %v, %v, %v)
+		RETURNING tokenid`,
+		token.TokenHash,
+		token.Name,
+		token.Login,
+		token.Role,
+		token.Created,
+	)
+	var id int64
+	err := s.db.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan(&id)
+	return id, errors.Wrap(err, "Scan")
+}
+
+const apiTokenFields = `tokenid, token_hash, name, login, role, created_at`
+
+func scanAPIToken(scan func(...any) error) (APIToken, error) {
+	var t APIToken
+	err := scan(&t.ID, &t.TokenHash, &t.Name, &t.Login, &t.Role, &t.Created)
+	return t, err
+}
+
+// APITokenByHash returns the API token with the given hash, or ErrNotFound.
+func (s *sqlStore) APITokenByHash(ctx context.Context, tokenHash string) (APIToken, error) {
+	q := sqlf.Sprintf(`SELECT `+apiTokenFields+` FROM api_tokens WHERE token_hash = %v`, tokenHash)
+	token, err := scanAPIToken(s.db.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan)
+	if err == sql.ErrNoRows {
+		return APIToken{}, ErrNotFound
+	}
+	return token, errors.Wrap(err, "Scan")
+}
+
+// APITokens returns the API tokens of a user, oldest first.
+func (s *sqlStore) APITokens(ctx context.Context, login string) ([]APIToken, error) {
+	q := sqlf.Sprintf(`SELECT `+apiTokenFields+` FROM api_tokens WHERE login = %v ORDER BY tokenid`, login)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows.Scan)
+		if err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken deletes an API token of the given user.
+func (s *sqlStore) DeleteAPIToken(ctx context.Context, login string, id int64) error {
+	q := sqlf.Sprintf("DELETE FROM api_tokens WHERE tokenid = %v AND login = %v", id, login)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return err
+}
+
+// RecordAuthCheck records the latest check of a user's roles, replacing any previous one.
+func (s *sqlStore) RecordAuthCheck(ctx context.Context, check AuthCheck) error {
+	q := sqlf.Sprintf(
+		`INSERT INTO auth_checks(login, role, checked_at) VALUES (%v, %v, %v)
+		ON CONFLICT(login) DO UPDATE SET role = %v, checked_at = %v`,
+		check.Login, check.Role, check.Checked,
+		check.Role, check.Checked,
+	)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return err
+}
+
+// AuthCheck returns the latest check of a user's roles, or ErrNotFound if they never signed in.
+func (s *sqlStore) AuthCheck(ctx context.Context, login string) (AuthCheck, error) {
+	q := sqlf.Sprintf(`SELECT login, role, checked_at FROM auth_checks WHERE login = %v`, login)
+	var check AuthCheck
+	err := s.db.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan(&check.Login, &check.Role, &check.Checked)
+	if err == sql.ErrNoRows {
+		return AuthCheck{}, ErrNotFound
+	}
+	return check, errors.Wrap(err, "Scan")
+}
@@ -0,0 +1,197 @@
+package wrench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"modernc.org/sqlite"
+)
+
+// Backup writes a consistent copy of the database to dst using SQLite's online backup API, so it
+// is safe to use while wrench is serving requests. The copy is written to a temporary file first
+// and renamed into place, so dst is never left half-written.
+func (s *sqliteStore) Backup(ctx context.Context, dst string) error {
+	tmp := dst + ".tmp"
+	_ = os.Remove(tmp)
+	defer os.Remove(tmp) //nolint:errcheck
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Conn")
+	}
+	defer conn.Close() //nolint:errcheck
+
+	err = conn.Raw(func(driverConn any) error {
+		backuper, ok := driverConn.(interface {
+			NewBackup(dstUri string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("database driver does not support online backups")
+		}
+		backup, err := backuper.NewBackup(tmp)
+		if err != nil {
+			return errors.Wrap(err, "NewBackup")
+		}
+		for {
+			// Copy in small steps, so that writers are not blocked for the whole backup.
+			more, err := backup.Step(1024)
+			if err != nil {
+				_ = backup.Finish()
+				return errors.Wrap(err, "Step")
+			}
+			if !more {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				_ = backup.Finish()
+				return ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		return errors.Wrap(backup.Finish(), "Finish")
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(os.Rename(tmp, dst), "Rename")
+}
+
+// ValidateBackup checks that the database file at path is intact and that its schema is not
+// newer than this binary supports, returning its schema version.
+func ValidateBackup(ctx context.Context, path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	s, err := openSQLiteStore("file:" + path + "?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close() //nolint:errcheck
+
+	var result string
+	if err := s.db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return 0, errors.Wrap(err, "integrity_check")
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", result)
+	}
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "SchemaVersion")
+	}
+	if version == 0 {
+		return 0, errors.New("not a wrench database (no schema version)")
+	}
+	return version, nil
+}
+
+// RestoreBackup validates the backup at src and then swaps it in place of the database at dst.
+// The database previously at dst is kept alongside it as <dst>.before-restore-<time>.
+//
+// The wrench service must not be running, as it would keep using the old database.
+func RestoreBackup(ctx context.Context, src, dst string) (previous string, err error) {
+	if _, err := ValidateBackup(ctx, src); err != nil {
+		return "", errors.Wrap(err, "invalid backup")
+	}
+
+	// Copy into the destination directory first, so the final swap is an atomic rename.
+	tmp := dst + ".restore.tmp"
+	if err := copyFile(src, tmp); err != nil {
+		return "", errors.Wrap(err, "copy")
+	}
+	defer os.Remove(tmp) //nolint:errcheck
+
+	if _, err := os.Stat(dst); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", dst, time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.Rename(dst, previous); err != nil {
+			return "", errors.Wrap(err, "Rename")
+		}
+	}
+	// Journals of the old database must not be applied to the restored one.
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if _, err := os.Stat(dst + suffix); err == nil && previous != "" {
+			_ = os.Rename(dst+suffix, previous+suffix)
+		}
+	}
+	return previous, errors.Wrap(os.Rename(tmp, dst), "Rename")
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+const backupLogID = "backup"
+
+// backupStart periodically backs up the store to Config.BackupDir, if configured, keeping only
+// the latest Config.BackupKeep backups.
+func (b *Bot) backupStart() {
+	if b.Config.BackupDir == "" {
+		return
+	}
+	if _, ok := b.store.(BackupStore); !ok {
+		b.idLogf(backupLogID, "error: BackupDir is set, but scheduled backups are only supported by the sqlite store backend")
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		every := time.Duration(b.Config.BackupEveryHours) * time.Hour
+		for {
+			if err := b.backupNow(ctx); err != nil {
+				b.idLogf(backupLogID, "error: %v", err)
+			}
+			time.Sleep(every)
+		}
+	}()
+}
+
+func (b *Bot) backupNow(ctx context.Context) error {
+	dir := b.Config.Path(b.Config.BackupDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return errors.Wrap(err, "MkdirAll")
+	}
+	dst := filepath.Join(dir, "wrench-"+time.Now().UTC().Format("20060102T150405Z")+".db")
+	start := time.Now()
+	if err := b.store.(BackupStore).Backup(ctx, dst); err != nil {
+		return errors.Wrap(err, "Backup")
+	}
+	b.idLogf(backupLogID, "backed up to %s (took %v)", dst, time.Since(start).Round(time.Millisecond))
+
+	// Rotate old backups. The timestamped names sort chronologically.
+	matches, err := filepath.Glob(filepath.Join(dir, "wrench-*.db"))
+	if err != nil {
+		return errors.Wrap(err, "Glob")
+	}
+	sort.Strings(matches)
+	for len(matches) > b.Config.BackupKeep {
+		if err := os.Remove(matches[0]); err != nil {
+			return errors.Wrap(err, "Remove")
+		}
+		b.idLogf(backupLogID, "removed old backup %s", matches[0])
+		matches = matches[1:]
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package wrench
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "wrench.db")
+	backupPath := filepath.Join(dir, "backup.db")
+
+	s, err := openSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Migrate(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Log(ctx, "zig", "before backup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Backup(ctx, backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Log(ctx, "zig", "after backup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := ValidateBackup(ctx, backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Fatalf("ValidateBackup: expected schema version %v, found %v", LatestSchemaVersion(), version)
+	}
+
+	// A corrupt backup is rejected without touching the live database.
+	corruptPath := filepath.Join(dir, "corrupt.db")
+	if err := os.WriteFile(corruptPath, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	live, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RestoreBackup(ctx, corruptPath, dbPath); err == nil {
+		t.Fatal("RestoreBackup: expected corrupt backup to be rejected")
+	}
+	if after, err := os.ReadFile(dbPath); err != nil || !bytes.Equal(live, after) {
+		t.Fatalf("RestoreBackup: live database changed by a rejected restore (err=%v)", err)
+	}
+	if matches, _ := filepath.Glob(dbPath + ".*"); len(matches) != 0 {
+		t.Fatalf("RestoreBackup: unexpected files left by a rejected restore: %v", matches)
+	}
+
+	previous, err := RestoreBackup(ctx, backupPath, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous == "" {
+		t.Fatal("RestoreBackup: expected the previous database to be kept")
+	}
+	if prev, err := os.ReadFile(previous); err != nil || !bytes.Equal(live, prev) {
+		t.Fatalf("RestoreBackup: previous database not kept intact (err=%v)", err)
+	}
+
+	s, err = openSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close() //nolint:errcheck
+	if err := s.checkSchemaVersion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := s.Logs(ctx, "zig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Message != "before backup" {
+		t.Fatalf("restored database: unexpected logs %+v", logs)
+	}
+}
+
+func TestValidateBackupNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "wrench.db")
+	s, err := openSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Migrate(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO schema_version(version, name, applied_at) VALUES (?, 'future', ?)`, LatestSchemaVersion()+1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateBackup(ctx, dbPath); err == nil {
+		t.Fatal("ValidateBackup: expected a backup with a newer schema version to be rejected")
+	}
+}
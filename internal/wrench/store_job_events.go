@@ -0,0 +1,57 @@
+package wrench
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/keegancsmith/sqlf"
+)
+
+// recordJobEvent records that the job entered job.State. It is called by NewRunnerJob, and by
+// UpsertRunnerJob whenever the state changes, so the history is complete for every job.
+func (s *sqlStore) recordJobEvent(ctx context.Context, tx *sql.Tx, id uint64, job api.Job) error {
+	q := sqlf.Sprintf(
+		"INSERT INTO job_events(job_id, timestamp, state, runner_id) VALUES(%v, %v, %v, %v)",
+		id,
+		job.Updated,
+		job.State,
+		job.TargetRunnerID,
+	)
+	_, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return errors.Wrap(err, "INSERT job_events")
+}
+
+// jobState returns the current state of the job, or an empty state if it does not exist.
+func (s *sqlStore) jobState(ctx context.Context, tx *sql.Tx, id uint64) (api.JobState, error) {
+	q := sqlf.Sprintf("SELECT state FROM runner_jobs WHERE id = %v", id)
+	var state api.JobState
+	err := tx.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan(&state)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return state, errors.Wrap(err, "SELECT state")
+}
+
+// JobEvents returns the state transitions of a job, oldest first.
+func (s *sqlStore) JobEvents(ctx context.Context, id api.JobID) ([]api.JobEvent, error) {
+	q := sqlf.Sprintf(
+		`SELECT timestamp, state, runner_id FROM job_events WHERE job_id = %v ORDER BY eventid`,
+		mustDecodeJobID(id),
+	)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+
+	var events []api.JobEvent
+	for rows.Next() {
+		var e api.JobEvent
+		if err = rows.Scan(&e.Time, &e.State, &e.RunnerID); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
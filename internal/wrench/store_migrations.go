@@ -0,0 +1,472 @@
+package wrench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/keegancsmith/sqlf"
+)
+
+// Migration is a single forward-only change to the store schema.
+//
+// Migrations are applied in order at OpenStore, each in its own transaction. Once a migration has
+// been released it must never be edited or reordered; add a new one to the end of the list instead.
+//
+// Every migration must be written for each store backend, keeping the schemas equivalent.
+type Migration struct {
+	Version int
+	Name    string
+
+	sqlite, postgres string
+}
+
+func (m Migration) up(dialect *storeDialect) string {
+	if dialect == postgresDialect {
+		return m.postgres
+	}
+	return m.sqlite
+}
+
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		sqlite: `
+			CREATE TABLE IF NOT EXISTS logs (
+				logid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+				timestamp TIMESTAMP NOT NULL,
+				id TEXT NOT NULL,
+				message TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS stats (
+				statid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+				timestamp TIMESTAMP NOT NULL,
+				id TEXT NOT NULL,
+				value INTEGER NOT NULL,
+				type TEXT NOT NULL,
+				metadata BLOB NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS runners (
+				id TEXT PRIMARY KEY NOT NULL,
+				arch TEXT NOT NULL,
+				env TEXT NOT NULL,
+				registered_at TIMESTAMP NOT NULL,
+				last_seen_at TIMESTAMP NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS secrets (
+				id TEXT PRIMARY KEY NOT NULL,
+				value TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS cache (
+				cache_name TEXT NOT NULL,
+				key TEXT NOT NULL,
+				value TEXT NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP,
+				PRIMARY KEY (cache_name, key)
+			);
+			CREATE TABLE IF NOT EXISTS runner_jobs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+				state TEXT NOT NULL,
+				title TEXT NOT NULL,
+				target_runner_id TEXT NOT NULL,
+				target_runner_arch TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				scheduled_start_at TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_logs_id ON logs (id);
+
+			CREATE INDEX IF NOT EXISTS idx_stats_id ON stats (id);
+
+			CREATE INDEX IF NOT EXISTS idx_cache_cache_name ON cache (cache_name);
+			CREATE INDEX IF NOT EXISTS idx_cache_key ON cache (key);
+
+			CREATE INDEX IF NOT EXISTS idx_runner_jobs_state ON runner_jobs (state);
+			CREATE INDEX IF NOT EXISTS idx_runner_jobs_title ON runner_jobs (title);
+			CREATE INDEX IF NOT EXISTS idx_runner_jobs_target_runner_id ON runner_jobs (target_runner_id);
+			CREATE INDEX IF NOT EXISTS idx_runner_jobs_id ON runner_jobs (id);
+		`,
+		postgres: `
+			CREATE TABLE IF NOT EXISTS logs (
+				logid BIGSERIAL PRIMARY KEY,
+				timestamp TIMESTAMPTZ NOT NULL,
+				id TEXT NOT NULL,
+				message TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS stats (
+				statid BIGSERIAL PRIMARY KEY,
+				timestamp TIMESTAMPTZ NOT NULL,
+				id TEXT NOT NULL,
+				value BIGINT NOT NULL,
+				type TEXT NOT NULL,
+				metadata BYTEA NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS runners (
+				id TEXT PRIMARY KEY NOT NULL,
+				arch TEXT NOT NULL,
+				env TEXT NOT NULL,
+				registered_at TIMESTAMPTZ NOT NULL,
+				last_seen_at TIMESTAMPTZ NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS secrets (
+				id TEXT PRIMARY KEY NOT NULL,
+				value TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS cache (
+				cache_name TEXT NOT NULL,
+				key TEXT NOT NULL,
+				value TEXT NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ,
+				PRIMARY KEY (cache_name, key)
+			);
+			CREATE TABLE IF NOT EXISTS runner_jobs (
+				id BIGSERIAL PRIMARY KEY,
+				state TEXT NOT NULL,
+				title TEXT NOT NULL,
+				target_runner_id TEXT NOT NULL,
+				target_runner_arch TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				scheduled_start_at TIMESTAMPTZ,
+				updated_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_logs_id ON logs (id);
+
+			CREATE INDEX IF NOT EXISTS idx_stats_id ON stats (id);
+
+			CREATE INDEX IF NOT EXISTS idx_cache_cache_name ON cache (cache_name);
+			CREATE INDEX IF NOT EXISTS idx_cache_key ON cache (key);
+
+			CREATE INDEX IF NOT EXISTS idx_runner_jobs_state ON runner_jobs (state);
+			CREATE INDEX IF NOT EXISTS idx_runner_jobs_title ON runner_jobs (title);
+			CREATE INDEX IF NOT EXISTS idx_runner_jobs_target_runner_id ON runner_jobs (target_runner_id);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "stats sample counts for downsampling",
+		sqlite: `
+			ALTER TABLE stats ADD COLUMN samples INTEGER NOT NULL DEFAULT 1;
+			CREATE INDEX IF NOT EXISTS idx_stats_timestamp ON stats (timestamp);
+			CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON logs (timestamp);
+		`,
+		postgres: `
+			ALTER TABLE stats ADD COLUMN samples BIGINT NOT NULL DEFAULT 1;
+			CREATE INDEX IF NOT EXISTS idx_stats_timestamp ON stats (timestamp);
+			CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON logs (timestamp);
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "full-text search index for logs",
+		sqlite: `
+			CREATE VIRTUAL TABLE logs_fts USING fts5(message, content='logs', content_rowid='logid');
+
+			CREATE TRIGGER logs_fts_insert AFTER INSERT ON logs BEGIN
+				INSERT INTO logs_fts(rowid, message) VALUES (new.logid, new.message);
+			END;
+			CREATE TRIGGER logs_fts_delete AFTER DELETE ON logs BEGIN
+				INSERT INTO logs_fts(logs_fts, rowid, message) VALUES ('delete', old.logid, old.message);
+			END;
+			CREATE TRIGGER logs_fts_update AFTER UPDATE ON logs BEGIN
+				INSERT INTO logs_fts(logs_fts, rowid, message) VALUES ('delete', old.logid, old.message);
+				INSERT INTO logs_fts(rowid, message) VALUES (new.logid, new.message);
+			END;
+
+			INSERT INTO logs_fts(logs_fts) VALUES ('rebuild');
+		`,
+		postgres: `
+			CREATE INDEX IF NOT EXISTS idx_logs_message_fts ON logs USING GIN (to_tsvector('simple', message));
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "append-only audit log",
+		sqlite: `
+			CREATE TABLE audit (
+				auditid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+				timestamp TIMESTAMP NOT NULL,
+				actor TEXT NOT NULL,
+				source TEXT NOT NULL,
+				action TEXT NOT NULL,
+				target TEXT NOT NULL
+			);
+			CREATE INDEX idx_audit_actor ON audit (actor);
+			CREATE INDEX idx_audit_action ON audit (action);
+
+			CREATE TRIGGER audit_no_update BEFORE UPDATE ON audit BEGIN
+				SELECT RAISE(ABORT, 'audit log is append-only');
+			END;
+			CREATE TRIGGER audit_no_delete BEFORE DELETE ON audit BEGIN
+				SELECT RAISE(ABORT, 'audit log is append-only');
+			END;
+		`,
+		postgres: `
+			CREATE TABLE audit (
+				auditid BIGSERIAL PRIMARY KEY,
+				timestamp TIMESTAMPTZ NOT NULL,
+				actor TEXT NOT NULL,
+				source TEXT NOT NULL,
+				action TEXT NOT NULL,
+				target TEXT NOT NULL
+			);
+			CREATE INDEX idx_audit_actor ON audit (actor);
+			CREATE INDEX idx_audit_action ON audit (action);
+
+			CREATE FUNCTION audit_append_only() RETURNS trigger LANGUAGE plpgsql AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit log is append-only';
+			END;
+			$$;
+			CREATE TRIGGER audit_append_only BEFORE UPDATE OR DELETE ON audit
+				FOR EACH ROW EXECUTE FUNCTION audit_append_only();
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "job state transition history",
+		sqlite: `
+			CREATE TABLE job_events (
+				eventid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+				job_id INTEGER NOT NULL,
+				timestamp TIMESTAMP NOT NULL,
+				state TEXT NOT NULL,
+				runner_id TEXT NOT NULL
+			);
+			CREATE INDEX idx_job_events_job_id ON job_events (job_id);
+		`,
+		postgres: `
+			CREATE TABLE job_events (
+				eventid BIGSERIAL PRIMARY KEY,
+				job_id BIGINT NOT NULL,
+				timestamp TIMESTAMPTZ NOT NULL,
+				state TEXT NOT NULL,
+				runner_id TEXT NOT NULL
+			);
+			CREATE INDEX idx_job_events_job_id ON job_events (job_id);
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "sign in sessions and API tokens",
+		sqlite: `
+			CREATE TABLE sessions (
+				token_hash TEXT PRIMARY KEY NOT NULL,
+				login TEXT NOT NULL,
+				role TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL
+			);
+			CREATE TABLE api_tokens (
+				tokenid INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+				token_hash TEXT UNIQUE NOT NULL,
+				name TEXT NOT NULL,
+				login TEXT NOT NULL,
+				role TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);
+			CREATE INDEX idx_api_tokens_login ON api_tokens (login);
+		`,
+		postgres: `
+			CREATE TABLE sessions (
+				token_hash TEXT PRIMARY KEY NOT NULL,
+				login TEXT NOT NULL,
+				role TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL
+			);
+			CREATE TABLE api_tokens (
+				tokenid BIGSERIAL PRIMARY KEY,
+				token_hash TEXT UNIQUE NOT NULL,
+				name TEXT NOT NULL,
+				login TEXT NOT NULL,
+				role TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX idx_api_tokens_login ON api_tokens (login);
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "runner client certificates",
+		sqlite: `
+			CREATE TABLE runner_certs (
+				serial TEXT PRIMARY KEY NOT NULL,
+				runner_id TEXT NOT NULL,
+				issued_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				revoked_at TIMESTAMP
+			);
+			CREATE INDEX idx_runner_certs_runner_id ON runner_certs (runner_id);
+		`,
+		postgres: `
+			CREATE TABLE runner_certs (
+				serial TEXT PRIMARY KEY NOT NULL,
+				runner_id TEXT NOT NULL,
+				issued_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL,
+				revoked_at TIMESTAMPTZ
+			);
+			CREATE INDEX idx_runner_certs_runner_id ON runner_certs (runner_id);
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "sign in membership checks",
+		sqlite: `
+			CREATE TABLE auth_checks (
+				login TEXT PRIMARY KEY NOT NULL,
+				role TEXT NOT NULL,
+				checked_at TIMESTAMP NOT NULL
+			);
+		`,
+		postgres: `
+			CREATE TABLE auth_checks (
+				login TEXT PRIMARY KEY NOT NULL,
+				role TEXT NOT NULL,
+				checked_at TIMESTAMPTZ NOT NULL
+			);
+		`,
+	},
+}
+
+// LatestSchemaVersion is the newest schema version this binary knows how to migrate to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func (s *sqlStore) ensureSchemaVersionTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY NOT NULL,
+			name TEXT NOT NULL,
+			applied_at `+s.dialect.timestampType+` NOT NULL
+		);
+	`)
+	return err
+}
+
+// SchemaVersion returns the schema version of the database, or zero if no migrations have been
+// applied yet (e.g. a new database, or one created before migrations existed.)
+func (s *sqlStore) SchemaVersion(ctx context.Context) (int, error) {
+	var exists bool
+	row := s.db.QueryRowContext(ctx, s.dialect.schemaVersionTableExists)
+	if err := row.Scan(&exists); err != nil {
+		return 0, errors.Wrap(err, "Scan")
+	}
+	if !exists {
+		return 0, nil
+	}
+	return schemaVersion(ctx, s.db)
+}
+
+func schemaVersion(ctx context.Context, db interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, errors.Wrap(err, "Scan")
+	}
+	return int(version.Int64), nil
+}
+
+func (s *sqlStore) checkSchemaVersion(ctx context.Context) error {
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return errors.Wrap(err, "SchemaVersion")
+	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf(
+			"database schema version %v is newer than this version of wrench supports (%v); refusing to start, please upgrade wrench",
+			version,
+			LatestSchemaVersion(),
+		)
+	}
+	return nil
+}
+
+// PendingMigrations returns the migrations which have not yet been applied to the database.
+func (s *sqlStore) PendingMigrations(ctx context.Context) ([]Migration, error) {
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "SchemaVersion")
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies all pending migrations in order, each in its own transaction, and returns the
+// migrations that were applied. If dryRun is true, nothing is applied and the pending migrations
+// are returned instead.
+func (s *sqlStore) Migrate(ctx context.Context, dryRun bool) ([]Migration, error) {
+	if err := s.checkSchemaVersion(ctx); err != nil {
+		return nil, err
+	}
+	pending, err := s.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+	if err := s.ensureSchemaVersionTable(ctx); err != nil {
+		return nil, errors.Wrap(err, "ensureSchemaVersionTable")
+	}
+	var applied []Migration
+	for _, m := range pending {
+		if err := s.applyMigration(ctx, m); err != nil {
+			return applied, errors.Wrapf(err, "migration %v (%s)", m.Version, m.Name)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func (s *sqlStore) applyMigration(ctx context.Context, m Migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTx")
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// Another process (e.g. 'wrench store migrate' while the service starts) may have beaten us.
+	version, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return errors.Wrap(err, "schemaVersion")
+	}
+	if version >= m.Version {
+		return nil
+	}
+	if version != m.Version-1 {
+		return fmt.Errorf("expected schema version %v, found %v", m.Version-1, version)
+	}
+
+	if _, err := tx.ExecContext(ctx, m.up(s.dialect)); err != nil {
+		return errors.Wrap(err, "Exec")
+	}
+	q := sqlf.Sprintf(
+		"INSERT INTO schema_version(version, name, applied_at) VALUES (%v, %v, %v)",
+		m.Version,
+		m.Name,
+		time.Now(),
+	)
+	if _, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+		return errors.Wrap(err, "INSERT schema_version")
+	}
+	return errors.Wrap(tx.Commit(), "Commit")
+}
@@ -0,0 +1,46 @@
+package wrench
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keegancsmith/sqlf"
+)
+
+func TestMigrate(t *testing.T) {
+	for name, open := range testStoreBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := open(t)
+
+			pending, err := store.Migrate(ctx, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != len(migrations) {
+				t.Fatalf("dry run: expected %v pending migrations, found %v", len(migrations), len(pending))
+			}
+			if version, _ := store.SchemaVersion(ctx); version != 0 {
+				t.Fatalf("dry run: expected schema version 0, found %v", version)
+			}
+
+			if _, err := store.Migrate(ctx, false); err != nil {
+				t.Fatal(err)
+			}
+			if version, _ := store.SchemaVersion(ctx); version != LatestSchemaVersion() {
+				t.Fatalf("expected schema version %v, found %v", LatestSchemaVersion(), version)
+			}
+
+			// A database from a newer wrench binary must be refused.
+			q := sqlf.Sprintf(`INSERT INTO schema_version(version, name, applied_at) VALUES (%v, 'future', %v)`, LatestSchemaVersion()+1, time.Now())
+			if _, err := store.db.ExecContext(ctx, q.Query(store.dialect.bindVar), q.Args()...); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.checkSchemaVersion(ctx); err == nil || !strings.Contains(err.Error(), "newer than this version of wrench") {
+				t.Fatalf("expected schema too new error, found %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package wrench
+
+import (
+	"github.com/keegancsmith/sqlf"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+var postgresDialect = &storeDialect{
+	name:                     StoreBackendPostgres,
+	bindVar:                  sqlf.PostgresBindVar,
+	timestampType:            "TIMESTAMPTZ",
+	schemaVersionTableExists: `SELECT to_regclass('schema_version') IS NOT NULL`,
+	searchLogs: func(phrase string, conds *sqlf.Query, limit int) *sqlf.Query {
+		options := `StartSel="` + logSearchMatchStart + `", StopSel="` + logSearchMatchEnd + `", MaxWords=32, MinWords=8`
+		return sqlf.Sprintf(
+			`SELECT id, timestamp, ts_headline('simple', message, phraseto_tsquery('simple', %v), %v)
+			FROM logs
+			WHERE to_tsvector('simple', message) @@ phraseto_tsquery('simple', %v) AND %s
+			ORDER BY timestamp DESC LIMIT %v`,
+			phrase, options, phrase, conds, limit,
+		)
+	},
+}
+
+// postgresStore is a Store backed by a PostgreSQL database, for deployments which want a managed,
+// highly available database rather than a local wrench.db file.
+type postgresStore struct {
+	*sqlStore
+}
+
+func openPostgresStore(url string) (*postgresStore, error) {
+	s, err := openSQLStore("pgx", url, postgresDialect)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresStore{sqlStore: s}, nil
+}
@@ -0,0 +1,351 @@
+package wrench
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/keegancsmith/sqlf"
+)
+
+// PurgeReport describes the data removed by Store.Purge.
+type PurgeReport struct {
+	DryRun bool
+	Tables []PurgeTableReport
+}
+
+type PurgeTableReport struct {
+	Table string
+
+	// Rows removed. For downsampled stats, this is net of the daily aggregate rows added.
+	Rows int64
+
+	// Approximate size of the removed row data. This is not the on-disk size of wrench.db, which
+	// only shrinks after a VACUUM.
+	Bytes int64
+}
+
+func (r *PurgeReport) add(table string, rows, bytes int64) {
+	for i, t := range r.Tables {
+		if t.Table == table {
+			r.Tables[i].Rows += rows
+			r.Tables[i].Bytes += bytes
+			return
+		}
+	}
+	r.Tables = append(r.Tables, PurgeTableReport{Table: table, Rows: rows, Bytes: bytes})
+}
+
+func (r *PurgeReport) String() string {
+	var b strings.Builder
+	verb := "reclaimed"
+	if r.DryRun {
+		verb = "would reclaim"
+	}
+	var totalRows, totalBytes int64
+	for _, t := range r.Tables {
+		totalRows += t.Rows
+		totalBytes += t.Bytes
+		_, _ = fmt.Fprintf(&b, "%s: %s %v rows (%s)\n", t.Table, verb, t.Rows, humanize.Bytes(uint64(max(t.Bytes, 0))))
+	}
+	_, _ = fmt.Fprintf(&b, "total: %s %v rows (%s)", verb, totalRows, humanize.Bytes(uint64(max(totalBytes, 0))))
+	return b.String()
+}
+
+// Purge removes data older than the configured retention rules, downsamples old stats, and
+// removes expired cache entries and sessions. Everything happens in a single transaction; if dryRun is true it
+// is rolled back and the report describes what would have been removed.
+func (s *sqlStore) Purge(ctx context.Context, cfg RetentionConfig, dryRun bool) (*PurgeReport, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "BeginTx")
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	now := time.Now()
+	report := &PurgeReport{DryRun: dryRun}
+	if err := s.purgeJobs(ctx, tx, cfg, now, report); err != nil {
+		return nil, errors.Wrap(err, "purgeJobs")
+	}
+	if err := s.purgeLogs(ctx, tx, cfg, now, report); err != nil {
+		return nil, errors.Wrap(err, "purgeLogs")
+	}
+	if err := s.downsampleStats(ctx, tx, cfg, now, report); err != nil {
+		return nil, errors.Wrap(err, "downsampleStats")
+	}
+	if err := s.purgeExpiredCache(ctx, tx, now, report); err != nil {
+		return nil, errors.Wrap(err, "purgeExpiredCache")
+	}
+	if err := s.purgeExpiredSessions(ctx, tx, now, report); err != nil {
+		return nil, errors.Wrap(err, "purgeExpiredSessions")
+	}
+	if dryRun {
+		return report, nil
+	}
+	return report, errors.Wrap(tx.Commit(), "Commit")
+}
+
+// hasPrefix is a portable SQL "column starts with prefix" condition, which unlike LIKE does not
+// require escaping the prefix.
+func hasPrefix(column, prefix string) *sqlf.Query {
+	return sqlf.Sprintf("substr("+column+", 1, %v) = %v", utf8.RuneCountInString(prefix), prefix)
+}
+
+// ruleConds returns the WHERE conditions for one retention rule: the rule matches, none of the
+// earlier (higher priority) rules match, and the row is older than the rule allows.
+func ruleConds(match *sqlf.Query, earlier []*sqlf.Query, olderThan *sqlf.Query) *sqlf.Query {
+	conds := []*sqlf.Query{match, olderThan}
+	for _, e := range earlier {
+		conds = append(conds, sqlf.Sprintf("NOT (%s)", e))
+	}
+	return sqlf.Join(conds, "AND")
+}
+
+func (s *sqlStore) purgeJobs(ctx context.Context, tx *sql.Tx, cfg RetentionConfig, now time.Time, report *PurgeReport) error {
+	rules := append(append([]JobRetentionRule{}, cfg.Jobs...), JobRetentionRule{Days: cfg.DefaultDays})
+
+	var earlier []*sqlf.Query
+	for _, rule := range rules {
+		conds := []*sqlf.Query{
+			// Never purge jobs which are still in-flight.
+			sqlf.Sprintf("state IN (%v, %v)", api.JobStateSuccess, api.JobStateError),
+		}
+		if rule.TitlePrefix != "" {
+			conds = append(conds, hasPrefix("title", rule.TitlePrefix))
+		}
+		if rule.State != "" {
+			conds = append(conds, sqlf.Sprintf("state = %v", rule.State))
+		}
+		match := sqlf.Join(conds, "AND")
+		if rule.Days <= 0 {
+			earlier = append(earlier, match)
+			continue
+		}
+
+		olderThan := sqlf.Sprintf("created_at < %v", now.AddDate(0, 0, -rule.Days))
+		q := sqlf.Sprintf(
+			"SELECT id, length(title) + length(payload) FROM runner_jobs WHERE %s",
+			ruleConds(match, earlier, olderThan),
+		)
+		rows, err := tx.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+		if err != nil {
+			return errors.Wrap(err, "QueryContext")
+		}
+		type jobRow struct {
+			id    uint64
+			bytes int64
+		}
+		var jobs []jobRow
+		for rows.Next() {
+			var j jobRow
+			if err := rows.Scan(&j.id, &j.bytes); err != nil {
+				_ = rows.Close()
+				return errors.Wrap(err, "Scan")
+			}
+			jobs = append(jobs, j)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			q := sqlf.Sprintf("DELETE FROM runner_jobs WHERE id = %v", job.id)
+			if _, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+				return errors.Wrap(err, "DELETE runner_jobs")
+			}
+			report.add("runner_jobs", 1, job.bytes)
+
+			q = sqlf.Sprintf("DELETE FROM job_events WHERE job_id = %v", job.id)
+			res, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+			if err != nil {
+				return errors.Wrap(err, "DELETE job_events")
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				report.add("job_events", n, 0)
+			}
+
+			// The job log, as well as any custom logs (job-<id>-<name>)
+			logID := encodeJobID(job.id).LogID()
+			if err := s.deleteLogs(ctx, tx, sqlf.Sprintf("(id = %v OR %s)", logID, hasPrefix("id", logID+"-")), report); err != nil {
+				return err
+			}
+		}
+		earlier = append(earlier, match)
+	}
+	return nil
+}
+
+func (s *sqlStore) purgeLogs(ctx context.Context, tx *sql.Tx, cfg RetentionConfig, now time.Time, report *PurgeReport) error {
+	rules := append(append([]LogRetentionRule{}, cfg.Logs...), LogRetentionRule{Days: cfg.DefaultDays})
+
+	// Job logs are removed alongside their job in purgeJobs.
+	notJobLog := sqlf.Sprintf("NOT (%s)", hasPrefix("id", "job-"))
+
+	var earlier []*sqlf.Query
+	for _, rule := range rules {
+		match := notJobLog
+		if rule.Prefix != "" {
+			match = sqlf.Sprintf("%s AND %s", notJobLog, hasPrefix("id", rule.Prefix))
+		}
+		if rule.Days > 0 {
+			olderThan := sqlf.Sprintf("timestamp < %v", now.AddDate(0, 0, -rule.Days))
+			if err := s.deleteLogs(ctx, tx, ruleConds(match, earlier, olderThan), report); err != nil {
+				return err
+			}
+		}
+		earlier = append(earlier, match)
+	}
+
+	// Logs of jobs that no longer exist, i.e. older than any job could be kept.
+	maxJobDays := cfg.DefaultDays
+	for _, rule := range cfg.Jobs {
+		if rule.Days <= 0 {
+			return nil // some jobs are kept forever
+		}
+		maxJobDays = max(maxJobDays, rule.Days)
+	}
+	olderThan := sqlf.Sprintf("timestamp < %v", now.AddDate(0, 0, -maxJobDays))
+	return s.deleteLogs(ctx, tx, sqlf.Sprintf("%s AND %s", hasPrefix("id", "job-"), olderThan), report)
+}
+
+func (s *sqlStore) deleteLogs(ctx context.Context, tx *sql.Tx, where *sqlf.Query, report *PurgeReport) error {
+	q := sqlf.Sprintf("SELECT COUNT(*), COALESCE(SUM(length(id) + length(message)), 0) FROM logs WHERE %s", where)
+	var count, bytes int64
+	if err := tx.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan(&count, &bytes); err != nil {
+		return errors.Wrap(err, "Scan")
+	}
+	if count == 0 {
+		return nil
+	}
+	q = sqlf.Sprintf("DELETE FROM logs WHERE %s", where)
+	if _, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+		return errors.Wrap(err, "DELETE logs")
+	}
+	report.add("logs", count, bytes)
+	return nil
+}
+
+// downsampleStats replaces stats older than cfg.StatsDownsampleAfterDays with a single daily
+// (UTC) average per stat ID, type and runner. The metadata of the latest sample in each day is
+// kept for the aggregate.
+func (s *sqlStore) downsampleStats(ctx context.Context, tx *sql.Tx, cfg RetentionConfig, now time.Time, report *PurgeReport) error {
+	if cfg.StatsDownsampleAfterDays <= 0 {
+		return nil
+	}
+	cutoff := now.AddDate(0, 0, -cfg.StatsDownsampleAfterDays).UTC().Truncate(24 * time.Hour)
+
+	// SQLite stores timestamps as text with the time zone offset they were recorded with, and so
+	// compares them as text rather than as times. Select everything that could be before the
+	// cutoff in any time zone, and compare the times exactly below.
+	q := sqlf.Sprintf(`SELECT statid, timestamp, id, value, type, metadata, samples FROM stats
+		WHERE timestamp < %v ORDER BY timestamp`, cutoff.Add(24*time.Hour))
+	rows, err := tx.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return errors.Wrap(err, "QueryContext")
+	}
+	type statRow struct {
+		statID   int64
+		stat     api.Stat
+		metadata []byte
+		samples  int64
+	}
+	groups := map[string][]statRow{}
+	var order []string
+	for rows.Next() {
+		var r statRow
+		if err := rows.Scan(&r.statID, &r.stat.Time, &r.stat.ID, &r.stat.Value, &r.stat.Type, &r.metadata, &r.samples); err != nil {
+			_ = rows.Close()
+			return errors.Wrap(err, "Scan")
+		}
+		if !r.stat.Time.Before(cutoff) {
+			continue
+		}
+		var meta map[string]any
+		_ = json.Unmarshal(r.metadata, &meta)
+		day := r.stat.Time.UTC().Truncate(24 * time.Hour)
+		key := fmt.Sprintf("%s\x00%s\x00%v\x00%s", r.stat.ID, r.stat.Type, meta["runner"], day.Format(time.DateOnly))
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rowBytes := func(r statRow) int64 {
+		return int64(len(r.stat.ID)+len(r.stat.Type)+len(r.metadata)) + 8
+	}
+	for _, key := range order {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		var sum, samples, bytes int64
+		for _, r := range group {
+			sum += r.stat.Value * r.samples
+			samples += r.samples
+			bytes += rowBytes(r)
+
+			q := sqlf.Sprintf("DELETE FROM stats WHERE statid = %v", r.statID)
+			if _, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+				return errors.Wrap(err, "DELETE stats")
+			}
+		}
+		latest := group[len(group)-1]
+		aggregate := latest
+		aggregate.stat.Time = latest.stat.Time.UTC().Truncate(24 * time.Hour)
+		aggregate.stat.Value = sum / samples
+		q := sqlf.Sprintf(
+			"INSERT INTO stats(timestamp, id, value, type, metadata, samples) VALUES(%v, %v, %v, %v, %v, %v)",
+			aggregate.stat.Time,
+			aggregate.stat.ID,
+			aggregate.stat.Value,
+			aggregate.stat.Type,
+			aggregate.metadata,
+			samples,
+		)
+		if _, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+			return errors.Wrap(err, "INSERT stats")
+		}
+		report.add("stats", int64(len(group)-1), bytes-rowBytes(aggregate))
+	}
+	return nil
+}
+
+func (s *sqlStore) purgeExpiredCache(ctx context.Context, tx *sql.Tx, now time.Time, report *PurgeReport) error {
+	where := sqlf.Sprintf("expires_at IS NOT NULL AND expires_at < %v", now)
+	q := sqlf.Sprintf("SELECT COUNT(*), COALESCE(SUM(length(cache_name) + length(key) + length(value)), 0) FROM cache WHERE %s", where)
+	var count, bytes int64
+	if err := tx.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan(&count, &bytes); err != nil {
+		return errors.Wrap(err, "Scan")
+	}
+	if count == 0 {
+		return nil
+	}
+	q = sqlf.Sprintf("DELETE FROM cache WHERE %s", where)
+	if _, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+		return errors.Wrap(err, "DELETE cache")
+	}
+	report.add("cache", count, bytes)
+	return nil
+}
+
+func (s *sqlStore) purgeExpiredSessions(ctx context.Context, tx *sql.Tx, now time.Time, report *PurgeReport) error {
+	q := sqlf.Sprintf("DELETE FROM sessions WHERE expires_at < %v", now)
+	res, err := tx.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return errors.Wrap(err, "DELETE sessions")
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		report.add("sessions", n, 0)
+	}
+	return nil
+}
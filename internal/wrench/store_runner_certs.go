@@ -0,0 +1,91 @@
+package wrench
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/keegancsmith/sqlf"
+)
+
+// RunnerCert is a client certificate issued to a runner, see 'wrench runners issue-cert'.
+type RunnerCert struct {
+	Serial   string // hex
+	RunnerID string
+	Issued   time.Time
+	Expires  time.Time
+	Revoked  *time.Time
+}
+
+func (s *sqlStore) RecordRunnerCert(ctx context.Context, cert RunnerCert) error {
+	q := sqlf.Sprintf(
+		"INSERT INTO runner_certs(serial, runner_id, issued_at, expires_at) VALUES(%v, %v, %v, %v)",
+		cert.Serial,
+		cert.RunnerID,
+		cert.Issued,
+		cert.Expires,
+	)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return err
+}
+
+const runnerCertFields = `serial, runner_id, issued_at, expires_at, revoked_at`
+
+func scanRunnerCert(scan func(...any) error) (RunnerCert, error) {
+	var (
+		cert    RunnerCert
+		revoked sql.NullTime
+	)
+	err := scan(&cert.Serial, &cert.RunnerID, &cert.Issued, &cert.Expires, &revoked)
+	if revoked.Valid {
+		cert.Revoked = &revoked.Time
+	}
+	return cert, err
+}
+
+// RunnerCert returns the runner certificate with the given serial, or ErrNotFound.
+func (s *sqlStore) RunnerCert(ctx context.Context, serial string) (RunnerCert, error) {
+	q := sqlf.Sprintf(`SELECT `+runnerCertFields+` FROM runner_certs WHERE serial = %v`, serial)
+	cert, err := scanRunnerCert(s.db.QueryRowContext(ctx, q.Query(s.dialect.bindVar), q.Args()...).Scan)
+	if err == sql.ErrNoRows {
+		return RunnerCert{}, ErrNotFound
+	}
+	return cert, errors.Wrap(err, "Scan")
+}
+
+// RunnerCerts returns the certificates issued to a runner, or to all runners if runnerID is
+// empty, oldest first.
+func (s *sqlStore) RunnerCerts(ctx context.Context, runnerID string) ([]RunnerCert, error) {
+	where := sqlf.Sprintf("TRUE")
+	if runnerID != "" {
+		where = sqlf.Sprintf("runner_id = %v", runnerID)
+	}
+	q := sqlf.Sprintf(`SELECT `+runnerCertFields+` FROM runner_certs WHERE %v ORDER BY issued_at, serial`, where)
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var certs []RunnerCert
+	for rows.Next() {
+		cert, err := scanRunnerCert(rows.Scan)
+		if err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		certs = append(certs, cert)
+	}
+	return certs, rows.Err()
+}
+
+// RevokeRunnerCert revokes the runner certificate with the given serial, or returns ErrNotFound.
+// Revoking an already revoked certificate keeps the original revocation time.
+func (s *sqlStore) RevokeRunnerCert(ctx context.Context, serial string) error {
+	if _, err := s.RunnerCert(ctx, serial); err != nil {
+		return err
+	}
+	q := sqlf.Sprintf("UPDATE runner_certs SET revoked_at = %v WHERE serial = %v AND revoked_at IS NULL", time.Now(), serial)
+	_, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	return err
+}
@@ -0,0 +1,87 @@
+package wrench
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/keegancsmith/sqlf"
+)
+
+// Markers around matches in log search snippets. Control characters are used so they can't be
+// confused with the log text itself; they're replaced by api.LogSearchResult.Matches offsets.
+const (
+	logSearchMatchStart = "\x02"
+	logSearchMatchEnd   = "\x03"
+)
+
+type LogSearchQuery struct {
+	// Phrase to search log messages for, e.g. "error: unable to find". Matching is
+	// case-insensitive on whole words, and punctuation is ignored.
+	Phrase string
+
+	// (optional) Only search logs whose ID starts with this prefix, e.g. "job-".
+	IDPrefix string
+
+	// (optional) Maximum number of results, defaults to 100.
+	Limit int
+}
+
+// SearchLogs searches log messages using the full-text search index, most recent first.
+func (s *sqlStore) SearchLogs(ctx context.Context, query LogSearchQuery) ([]api.LogSearchResult, error) {
+	phrase := strings.TrimSpace(query.Phrase)
+	if phrase == "" {
+		return nil, nil
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	conds := sqlf.Sprintf("TRUE")
+	if query.IDPrefix != "" {
+		conds = hasPrefix("logs.id", query.IDPrefix)
+	}
+	q := s.dialect.searchLogs(phrase, conds, limit)
+
+	rows, err := s.db.QueryContext(ctx, q.Query(s.dialect.bindVar), q.Args()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+
+	var results []api.LogSearchResult
+	for rows.Next() {
+		var result api.LogSearchResult
+		var snippet string
+		if err = rows.Scan(&result.ID, &result.Time, &snippet); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		result.Snippet, result.Matches = parseLogSearchSnippet(snippet)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// parseLogSearchSnippet removes the match markers from a snippet, returning the offsets of the
+// matches instead.
+func parseLogSearchSnippet(marked string) (string, [][2]int) {
+	var (
+		snippet strings.Builder
+		matches [][2]int
+		start   = -1
+	)
+	for _, r := range marked {
+		switch string(r) {
+		case logSearchMatchStart:
+			start = snippet.Len()
+		case logSearchMatchEnd:
+			if start >= 0 {
+				matches = append(matches, [2]int{start, snippet.Len()})
+				start = -1
+			}
+		default:
+			snippet.WriteRune(r)
+		}
+	}
+	return snippet.String(), matches
+}
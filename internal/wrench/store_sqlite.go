@@ -0,0 +1,40 @@
+package wrench
+
+import (
+	"strings"
+
+	"github.com/keegancsmith/sqlf"
+
+	_ "modernc.org/sqlite" // from https://gitlab.com/cznic/sqlite
+)
+
+var sqliteDialect = &storeDialect{
+	name:                     StoreBackendSQLite,
+	bindVar:                  sqlf.SimpleBindVar,
+	timestampType:            "TIMESTAMP",
+	schemaVersionTableExists: `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`,
+	searchLogs: func(phrase string, conds *sqlf.Query, limit int) *sqlf.Query {
+		// Quoting makes FTS5 treat the whole query as a phrase, rather than its query syntax.
+		match := `"` + strings.ReplaceAll(phrase, `"`, `""`) + `"`
+		return sqlf.Sprintf(
+			`SELECT logs.id, logs.timestamp, snippet(logs_fts, 0, %v, %v, '…', 32)
+			FROM logs_fts JOIN logs ON logs.logid = logs_fts.rowid
+			WHERE logs_fts MATCH %v AND %s
+			ORDER BY logs.timestamp DESC LIMIT %v`,
+			logSearchMatchStart, logSearchMatchEnd, match, conds, limit,
+		)
+	},
+}
+
+// sqliteStore is the default Store backend: a wrench.db file in the WrenchDir.
+type sqliteStore struct {
+	*sqlStore
+}
+
+func openSQLiteStore(dsn string) (*sqliteStore, error) {
+	s, err := openSQLStore("sqlite", dsn, sqliteDialect)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStore{sqlStore: s}, nil
+}
@@ -0,0 +1,536 @@
+package wrench
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hexops/wrench/internal/wrench/api"
+	"github.com/keegancsmith/sqlf"
+)
+
+// testStoreBackends returns, for each store backend under test, a function which opens a new and
+// empty store without applying migrations.
+//
+// The Postgres backend is only tested if $WRENCH_TEST_POSTGRES is set to the URL of a database
+// which may be freely wiped, e.g.:
+//
+//	WRENCH_TEST_POSTGRES=postgres://postgres@localhost/wrench_test?sslmode=disable go test ./internal/wrench
+func testStoreBackends(t *testing.T) map[string]func(t *testing.T) *sqlStore {
+	backends := map[string]func(t *testing.T) *sqlStore{
+		StoreBackendSQLite: func(t *testing.T) *sqlStore {
+			s, err := openSQLiteStore(filepath.Join(t.TempDir(), "wrench.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = s.Close() })
+			return s.sqlStore
+		},
+	}
+	if url := os.Getenv("WRENCH_TEST_POSTGRES"); url != "" {
+		backends[StoreBackendPostgres] = func(t *testing.T) *sqlStore {
+			s, err := openPostgresStore(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = s.Close() })
+			if _, err := s.db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public;`); err != nil {
+				t.Fatal(err)
+			}
+			return s.sqlStore
+		}
+	} else {
+		t.Log("WRENCH_TEST_POSTGRES not set, skipping postgres store backend")
+	}
+	return backends
+}
+
+// testStore opens a new, fully migrated store for each backend under test and runs fn against it.
+func testStore(t *testing.T, fn func(t *testing.T, s *sqlStore)) {
+	for name, open := range testStoreBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			if _, err := s.Migrate(context.Background(), false); err != nil {
+				t.Fatal(err)
+			}
+			fn(t, s)
+		})
+	}
+}
+
+func TestStoreLogs(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		for _, l := range []struct{ id, msg string }{{"b", "one"}, {"a", "two"}, {"b", "three\n"}} {
+			if err := s.Log(ctx, l.id, l.msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids, err := s.LogIDs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+			t.Fatalf("LogIDs: unexpected %v", ids)
+		}
+		logs, err := s.Logs(ctx, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != 2 || logs[0].Message != "one" || logs[1].Message != "three" || logs[0].ID >= logs[1].ID {
+			t.Fatalf("Logs: unexpected %+v", logs)
+		}
+	})
+}
+
+func TestStoreSearchLogs(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		for _, l := range []struct{ id, msg string }{
+			{"job-1", "zig build\nerror: unable to find 'foo'\nexit status 1"},
+			{"job-2", "all good, unable to reproduce"},
+			{"github-sync", "Error: Unable to find repository"},
+		} {
+			if err := s.Log(ctx, l.id, l.msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		results, err := s.SearchLogs(ctx, LogSearchQuery{Phrase: "error: unable to find"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, found %+v", results)
+		}
+		results, err = s.SearchLogs(ctx, LogSearchQuery{Phrase: "error: unable to find", IDPrefix: "job-"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].ID != "job-1" || len(results[0].Matches) == 0 {
+			t.Fatalf("expected job-1 result with matches, found %+v", results)
+		}
+		m := results[0].Matches[0]
+		if got := results[0].Snippet[m[0]:m[1]]; !strings.HasPrefix(got, "error") {
+			t.Fatalf("expected first match to start with %q, found %q", "error", got)
+		}
+
+		// Deleted logs must be removed from the index too.
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM logs WHERE id = 'github-sync'`); err != nil {
+			t.Fatal(err)
+		}
+		results, err = s.SearchLogs(ctx, LogSearchQuery{Phrase: `"unable"`})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results after delete, found %+v", results)
+		}
+	})
+}
+
+func TestStoreStats(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Second)
+		for i, v := range []int64{10, 20} {
+			err := s.RecordStat(ctx, api.Stat{
+				ID:       "zig-build",
+				Type:     api.StatTypeNs,
+				Time:     now.Add(time.Duration(i) * time.Minute),
+				Value:    v,
+				Metadata: map[string]any{"runner": "linux"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids, err := s.StatIDs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 1 || ids[0] != "zig-build" {
+			t.Fatalf("StatIDs: unexpected %v", ids)
+		}
+		stats, err := s.Stats(ctx, "zig-build")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats) != 2 || stats[0].Value != 10 || stats[1].Value != 20 || stats[0].Metadata["runner"] != "linux" {
+			t.Fatalf("Stats: unexpected %+v", stats)
+		}
+		if !stats[0].Time.Equal(now) {
+			t.Fatalf("Stats: expected time %v, found %v", now, stats[0].Time)
+		}
+	})
+}
+
+func TestStoreRunners(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		if err := s.RunnerSeen(ctx, "linux", "x86_64-linux", api.RunnerEnv{WrenchVersion: "1"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RunnerSeen(ctx, "linux", "aarch64-linux", api.RunnerEnv{WrenchVersion: "2"}); err != nil {
+			t.Fatal(err)
+		}
+		runners, err := s.Runners(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runners) != 1 || runners[0].Arch != "aarch64-linux" || runners[0].Env.WrenchVersion != "2" {
+			t.Fatalf("Runners: unexpected %+v", runners)
+		}
+	})
+}
+
+func TestStoreJobs(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		var ids []api.JobID
+		for _, title := range []string{"first", "second"} {
+			id, err := s.NewRunnerJob(ctx, api.Job{
+				Title:          title,
+				TargetRunnerID: "linux",
+				Payload:        api.JobPayload{Cmd: []string{"echo", title}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		job, err := s.JobByID(ctx, ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Title != "first" || job.State != api.JobStateReady || len(job.Payload.Cmd) != 2 {
+			t.Fatalf("JobByID: unexpected %+v", job)
+		}
+		job.State = api.JobStateRunning
+		if err := s.UpsertRunnerJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+
+		jobs, err := s.Jobs(ctx, JobsFilter{State: api.JobStateReady})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 1 || jobs[0].ID != ids[1] {
+			t.Fatalf("Jobs: unexpected %+v", jobs)
+		}
+		jobs, err = s.Jobs(ctx, JobsFilter{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 1 || jobs[0].ID != ids[1] {
+			t.Fatalf("Jobs: expected newest job first, found %+v", jobs)
+		}
+		jobs, err = s.Jobs(ctx, JobsFilter{IDLessThan: ids[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 1 || jobs[0].ID != ids[0] {
+			t.Fatalf("Jobs: expected only older jobs, found %+v", jobs)
+		}
+		if _, err := s.JobByID(ctx, encodeJobID(1234)); err != ErrNotFound {
+			t.Fatalf("JobByID: expected ErrNotFound, found %v", err)
+		}
+
+		// Upserting without a state change must not record a transition.
+		if err := s.UpsertRunnerJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		events, err := s.JobEvents(ctx, ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[0].State != api.JobStateReady || events[1].State != api.JobStateRunning || events[1].RunnerID != "linux" {
+			t.Fatalf("JobEvents: unexpected %+v", events)
+		}
+	})
+}
+
+func TestStoreCache(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		expired := time.Now().Add(-time.Hour)
+		if err := s.CacheSet(ctx, "c", "key", "v1", nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CacheSet(ctx, "c", "key", "v2", nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CacheSet(ctx, "c", "expired", "v", &expired); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := s.CacheKey(ctx, "c", "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Value != "v2" {
+			t.Fatalf("CacheKey: expected v2, found %q", entry.Value)
+		}
+		if _, err := s.CacheKey(ctx, "c", "expired"); err == nil {
+			t.Fatal("CacheKey: expected expired entry to be missing")
+		}
+	})
+}
+
+func TestStoreSecrets(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		if err := s.UpsertSecret(ctx, "token", "hunter2"); err != ErrSecretsKeyMissing {
+			t.Fatalf("UpsertSecret: expected ErrSecretsKeyMissing, found %v", err)
+		}
+		key, err := GenerateSecretsKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetSecretsKey(key); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpsertSecret(ctx, "token", "hunter2"); err != nil {
+			t.Fatal(err)
+		}
+
+		newKey, err := GenerateSecretsKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.RotateSecretsKey(ctx, newKey); err != nil || n != 1 {
+			t.Fatalf("RotateSecretsKey: expected 1, found %v (%v)", n, err)
+		}
+		secret, err := s.Secret(ctx, "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret.Value != "hunter2" {
+			t.Fatalf("Secret: unexpected value after rotation")
+		}
+
+		if err := s.DeleteSecret(ctx, "token"); err != nil {
+			t.Fatal(err)
+		}
+		ids, err := s.SecretIDs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 0 {
+			t.Fatalf("SecretIDs: expected none, found %v", ids)
+		}
+	})
+}
+
+func TestStorePurge(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		old := time.Now().AddDate(0, 0, -100)
+		for _, id := range []string{"github-sync", "zig"} {
+			if err := s.Log(ctx, id, "new"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		q := sqlf.Sprintf(`INSERT INTO logs(timestamp, id, message) VALUES (%v, 'zig', 'old')`, old)
+		if _, err := s.db.ExecContext(ctx, q.Query(s.dialect.bindVar), q.Args()...); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := RetentionConfig{DefaultDays: 30}
+		report, err := s.Purge(ctx, cfg, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Tables) != 1 || report.Tables[0].Table != "logs" || report.Tables[0].Rows != 1 {
+			t.Fatalf("Purge dry run: unexpected %+v", report.Tables)
+		}
+		if logs, _ := s.Logs(ctx, "zig"); len(logs) != 2 {
+			t.Fatalf("Purge dry run: expected logs to be kept, found %v", len(logs))
+		}
+		if _, err := s.Purge(ctx, cfg, false); err != nil {
+			t.Fatal(err)
+		}
+		if logs, _ := s.Logs(ctx, "zig"); len(logs) != 1 || logs[0].Message != "new" {
+			t.Fatalf("Purge: unexpected logs %+v", logs)
+		}
+	})
+}
+
+func TestStoreAudit(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		for _, e := range []api.AuditEvent{
+			{Time: time.Now(), Actor: "alice", Source: AuditSourceDiscord, Action: "cancel-job", Target: "abc"},
+			{Time: time.Now(), Actor: "bob", Source: AuditSourceAPI, Action: "secret-upsert", Target: "token"},
+		} {
+			if err := s.RecordAudit(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		events, err := s.AuditEvents(ctx, AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[0].Actor != "bob" {
+			t.Fatalf("AuditEvents: expected most recent first, found %+v", events)
+		}
+		events, err = s.AuditEvents(ctx, AuditFilter{Action: "cancel-job"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Target != "abc" {
+			t.Fatalf("AuditEvents: unexpected %+v", events)
+		}
+
+		// The audit log is append-only.
+		if _, err := s.db.ExecContext(ctx, `UPDATE audit SET actor = 'mallory'`); err == nil {
+			t.Fatal("expected UPDATE audit to fail")
+		}
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM audit`); err == nil {
+			t.Fatal("expected DELETE FROM audit to fail")
+		}
+	})
+}
+
+func TestStoreAuth(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		now := time.Now()
+		for _, session := range []Session{
+			{TokenHash: "live", Login: "alice", Role: RoleOperator, Created: now, Expires: now.Add(time.Hour)},
+			{TokenHash: "expired", Login: "alice", Role: RoleOperator, Created: now, Expires: now.Add(-time.Hour)},
+		} {
+			if err := s.CreateSession(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+		}
+		session, err := s.Session(ctx, "live")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Login != "alice" || session.Role != RoleOperator {
+			t.Fatalf("Session: unexpected %+v", session)
+		}
+		if _, err := s.Session(ctx, "expired"); err != ErrNotFound {
+			t.Fatalf("Session: expected ErrNotFound for expired session, found %v", err)
+		}
+		if err := s.DeleteSession(ctx, "live"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Session(ctx, "live"); err != ErrNotFound {
+			t.Fatalf("Session: expected ErrNotFound after DeleteSession, found %v", err)
+		}
+
+		id, err := s.CreateAPIToken(ctx, APIToken{TokenHash: "hash", Name: "laptop", Login: "alice", Role: RoleViewer, Created: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := s.APITokenByHash(ctx, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.ID != id || token.Name != "laptop" || token.Role != RoleViewer {
+			t.Fatalf("APITokenByHash: unexpected %+v", token)
+		}
+		// Tokens can only be deleted by their owner.
+		if err := s.DeleteAPIToken(ctx, "bob", id); err != nil {
+			t.Fatal(err)
+		}
+		if tokens, err := s.APITokens(ctx, "alice"); err != nil || len(tokens) != 1 {
+			t.Fatalf("APITokens: expected 1 token, found %v %v", tokens, err)
+		}
+		if err := s.DeleteAPIToken(ctx, "alice", id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.APITokenByHash(ctx, "hash"); err != ErrNotFound {
+			t.Fatalf("APITokenByHash: expected ErrNotFound after delete, found %v", err)
+		}
+
+		if _, err := s.AuthCheck(ctx, "alice"); err != ErrNotFound {
+			t.Fatalf("AuthCheck: expected ErrNotFound before any check, found %v", err)
+		}
+		for _, role := range []Role{RoleOperator, ""} {
+			if err := s.RecordAuthCheck(ctx, AuthCheck{Login: "alice", Role: role, Checked: now}); err != nil {
+				t.Fatal(err)
+			}
+			check, err := s.AuthCheck(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if check.Role != role || !check.Checked.Equal(now) {
+				t.Fatalf("AuthCheck: expected role %q, found %+v", role, check)
+			}
+		}
+	})
+}
+
+func TestStoreRunnerCerts(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		now := time.Now()
+		for _, cert := range []RunnerCert{
+			{Serial: "01", RunnerID: "linux", Issued: now, Expires: now.Add(time.Hour)},
+			{Serial: "02", RunnerID: "macos", Issued: now, Expires: now.Add(time.Hour)},
+		} {
+			if err := s.RecordRunnerCert(ctx, cert); err != nil {
+				t.Fatal(err)
+			}
+		}
+		certs, err := s.RunnerCerts(ctx, "")
+		if err != nil || len(certs) != 2 {
+			t.Fatalf("RunnerCerts: expected 2 certs, found %v %v", certs, err)
+		}
+		if err := s.RevokeRunnerCert(ctx, "01"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RevokeRunnerCert(ctx, "03"); err != ErrNotFound {
+			t.Fatalf("RevokeRunnerCert: expected ErrNotFound, found %v", err)
+		}
+		cert, err := s.RunnerCert(ctx, "01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.RunnerID != "linux" || cert.Revoked == nil {
+			t.Fatalf("RunnerCert: expected revoked cert, found %+v", cert)
+		}
+		certs, err = s.RunnerCerts(ctx, "macos")
+		if err != nil || len(certs) != 1 || certs[0].Revoked != nil {
+			t.Fatalf("RunnerCerts: unexpected %+v %v", certs, err)
+		}
+	})
+}
+
+func TestStoreDownsampleStatsTimeZones(t *testing.T) {
+	testStore(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		cfg := RetentionConfig{StatsDownsampleAfterDays: 10}
+		cutoff := time.Now().AddDate(0, 0, -cfg.StatsDownsampleAfterDays).UTC().Truncate(24 * time.Hour)
+
+		// Stats recorded with a time zone offset sort differently as text than as times: "east"
+		// stats are before the cutoff but read as after it, and "west" stats the opposite.
+		east, west := time.FixedZone("AEST", 10*60*60), time.FixedZone("HST", -10*60*60)
+		for _, stat := range []api.Stat{
+			{ID: "east", Time: cutoff.Add(-2 * time.Hour).In(east), Value: 10},
+			{ID: "east", Time: cutoff.Add(-1 * time.Hour).In(east), Value: 20},
+			{ID: "west", Time: cutoff.Add(1 * time.Hour).In(west), Value: 10},
+			{ID: "west", Time: cutoff.Add(2 * time.Hour).In(west), Value: 20},
+		} {
+			stat.Type = api.StatTypeNs
+			if err := s.RecordStat(ctx, stat); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Purge(ctx, cfg, false); err != nil {
+			t.Fatal(err)
+		}
+		if stats, _ := s.Stats(ctx, "east"); len(stats) != 1 || stats[0].Value != 15 {
+			t.Fatalf("expected east stats to be downsampled, found %+v", stats)
+		}
+		if stats, _ := s.Stats(ctx, "west"); len(stats) != 2 {
+			t.Fatalf("expected west stats to be kept, found %+v", stats)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package wrench
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// httpTLSConfig returns the TLS configuration to serve with per Config.TLSMode, or nil if TLS
+// is off.
+func (b *Bot) httpTLSConfig() (*tls.Config, error) {
+	tlsConfig, err := b.httpServerTLSConfig()
+	if err != nil || !b.Config.RunnerMTLS {
+		return tlsConfig, err
+	}
+	if tlsConfig == nil {
+		return nil, errors.New("RunnerMTLS requires TLS to be served, see Config.TLS")
+	}
+	ca, created, err := LoadRunnerCA(b.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "LoadRunnerCA")
+	}
+	if created {
+		b.logf("http: created runner CA %s", b.Config.Path(b.Config.RunnerCACertFile))
+	}
+	// Browsers do not have runner certificates, so they are verified if given and required by
+	// httpRunnerMTLS for /api/runner/* only.
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	tlsConfig.ClientCAs.AddCert(ca.Cert)
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+func (b *Bot) httpServerTLSConfig() (*tls.Config, error) {
+	switch b.Config.TLSMode() {
+	case TLSModeOff:
+		return nil, nil
+	case TLSModeFiles:
+		if b.Config.TLSCertFile == "" || b.Config.TLSKeyFile == "" {
+			return nil, errors.New("TLS=\"files\" requires TLSCertFile and TLSKeyFile")
+		}
+		certs := &certReloader{
+			certFile: b.Config.Path(b.Config.TLSCertFile),
+			keyFile:  b.Config.Path(b.Config.TLSKeyFile),
+			logf:     b.logf,
+		}
+		// Fail early on a missing or invalid certificate, rather than on the first request.
+		if _, err := certs.GetCertificate(nil); err != nil {
+			return nil, err
+		}
+		return &tls.Config{GetCertificate: certs.GetCertificate}, nil
+	case TLSModeACME:
+		return b.acmeTLSConfig()
+	default:
+		return nil, fmt.Errorf("invalid config TLS=%q, expected \"acme\", \"files\" or \"off\"", b.Config.TLS)
+	}
+}
+
+func (b *Bot) acmeTLSConfig() (*tls.Config, error) {
+	u, err := url.Parse(b.Config.ExternalURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("expected valid config.ExternalURL for ACME, found: %v", b.Config.ExternalURL)
+	}
+	client := &acme.Client{DirectoryURL: b.Config.ACMEDirectoryURL}
+	if b.Config.ACMERootCAFile != "" {
+		roots, err := loadCertPool(b.Config.Path(b.Config.ACMERootCAFile))
+		if err != nil {
+			return nil, errors.Wrap(err, "ACMERootCAFile")
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+	certManager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(b.Config.LetsEncryptCacheDir),
+		Email:      b.Config.LetsEncryptEmail,
+		HostPolicy: autocert.HostWhitelist(u.Hostname()),
+		Client:     client,
+	}
+
+	if b.Config.ACMEHTTPAddress != "disabled" {
+		b.httpServe(&http.Server{
+			Addr:    b.Config.ACMEHTTPAddress,
+			Handler: certManager.HTTPHandler(nil),
+		})
+	}
+	return certManager.TLSConfig(), nil
+}
+
+// certReloader serves a certificate and key from files, reloading them when they change.
+type certReloader struct {
+	certFile, keyFile string
+	logf              func(format string, v ...any)
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// certReloadInterval is how often the certificate files are checked for changes.
+const certReloadInterval = 10 * time.Second
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && time.Since(c.checked) < certReloadInterval {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	modTime, err := c.latestModTime()
+	if err == nil && c.cert != nil && !modTime.After(c.modTime) {
+		return c.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err == nil {
+			if c.cert != nil {
+				c.logf("http: reloaded TLS certificate %s", c.certFile)
+			}
+			c.cert, c.modTime = &cert, modTime
+			return c.cert, nil
+		}
+	}
+	if c.cert == nil {
+		return nil, errors.Wrap(err, "loading TLS certificate")
+	}
+	// The files may be mid-renewal; keep serving the previous certificate.
+	c.logf("http: keeping previous TLS certificate: %v", err)
+	return c.cert, nil
+}
+
+func (c *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.GetCertificate(nil)
+}
+
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
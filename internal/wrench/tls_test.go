@@ -0,0 +1,93 @@
+package wrench
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	c := &certReloader{
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+		logf:     t.Logf,
+	}
+	modTime := time.Now().Add(-time.Hour)
+	write := func(certPEM, keyPEM []byte) {
+		t.Helper()
+		modTime = modTime.Add(time.Minute)
+		for file, data := range map[string][]byte{c.certFile: certPEM, c.keyFile: keyPEM} {
+			if err := os.WriteFile(file, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(file, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Skip the wait until the files are checked again.
+		c.checked = time.Time{}
+	}
+	serving := func() string {
+		t.Helper()
+		cert, err := c.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	if _, err := c.GetCertificate(nil); err == nil {
+		t.Fatal("expected an error without certificate files")
+	}
+	write(testCertificate(t, "first"))
+	if got := serving(); got != "first" {
+		t.Fatalf("expected the first certificate, found %q", got)
+	}
+	write(testCertificate(t, "renewed"))
+	if got := serving(); got != "renewed" {
+		t.Fatalf("expected the renewed certificate, found %q", got)
+	}
+	// Files which are mid-renewal do not replace the working certificate.
+	write([]byte("partial"), []byte("partial"))
+	if got := serving(); got != "renewed" {
+		t.Fatalf("expected the previous certificate to be kept, found %q", got)
+	}
+}
+
+// testCertificate returns a self-signed certificate and key with the given common name, in PEM.
+func testCertificate(t *testing.T, commonName string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
@@ -0,0 +1,129 @@
+package wrench
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+// The web UI: html/template pages sharing ui/templates/layout.html, and static assets (styles,
+// scripts, the logo) served from /static/. Everything is embedded, so the UI works without access
+// to any third-party site.
+//
+//go:embed ui/templates ui/static
+var uiFS embed.FS
+
+var uiFuncs = template.FuncMap{
+	"humanize":  humanize.Time,
+	"recent":    humanizeTimeRecent,
+	"maybeZero": humanizeTimeMaybeZero,
+	"bytes": func(n int64) string {
+		return humanize.IBytes(uint64(max(n, 0)))
+	},
+	"rfc3339": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"atLeast": func(id *Identity, role Role) bool {
+		return id != nil && id.Role.atLeast(role)
+	},
+	"jobsTable": func(externalURL string, jobs []api.Job) any {
+		return struct {
+			ExternalURL string
+			Jobs        []api.Job
+		}{externalURL, jobs}
+	},
+}
+
+// uiPages are the page templates by name (the file name without .html), each parsed together
+// with the layout and the templates shared between pages (files starting with partial_.)
+var uiPages = func() map[string]*template.Template {
+	layout := template.Must(template.New("layout.html").Funcs(uiFuncs).ParseFS(uiFS, "ui/templates/layout.html", "ui/templates/partial_*.html"))
+	names, err := fs.Glob(uiFS, "ui/templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	pages := map[string]*template.Template{}
+	for _, name := range names {
+		base := path.Base(name)
+		if base == "layout.html" || strings.HasPrefix(base, "partial_") {
+			continue
+		}
+		pages[base[:len(base)-len(".html")]] = template.Must(template.Must(layout.Clone()).ParseFS(uiFS, name))
+	}
+	return pages
+}()
+
+// uiPage is the data every page template is executed with; page-specific data is in Data.
+type uiPage struct {
+	Title       string
+	ExternalURL string
+
+	// Site is the name of the site, shown in the navigation.
+	Site string
+
+	// Wrench is whether this is the wrench UI (with navigation and sign in), rather than the
+	// pkg or zig mirror.
+	Wrench bool
+
+	// OAuth is whether signing in with GitHub is enabled, and Identity who is signed in (if
+	// anyone.)
+	OAuth    bool
+	Identity *Identity
+
+	Data any
+}
+
+// render writes the named page template. The page is rendered fully before anything is written,
+// so that a template error results in an error response rather than half a page.
+func (b *Bot) render(w http.ResponseWriter, r *http.Request, name, title string, data any) error {
+	t, ok := uiPages[name]
+	if !ok {
+		return errors.New("no such template: " + name)
+	}
+	page := uiPage{
+		Title:       title,
+		ExternalURL: b.Config.ExternalURL,
+		Site:        "wrench",
+		Wrench:      b.Config.ModeType() == ModeWrench,
+		Data:        data,
+	}
+	if !page.Wrench {
+		if u, err := url.Parse(b.Config.ExternalURL); err == nil && u.Host != "" {
+			page.Site = u.Host
+		}
+	}
+	if page.Wrench {
+		page.OAuth = b.oauthEnabled()
+		page.Identity = b.httpIdentity(r)
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "layout", page); err != nil {
+		return errors.Wrap(err, "ExecuteTemplate("+name+")")
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// uiStaticHandler serves the embedded static assets under /static/.
+func uiStaticHandler() http.Handler {
+	static, err := fs.Sub(uiFS, "ui/static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,319 @@
+// A small line chart for /stats pages, drawn on a canvas. The data is read from the
+// #chart-data JSON script element:
+//
+//	series:   names of the series
+//	data:     rows of [x, value of series 0, value of series 1, ...], where a missing value is
+//	          null and the series line connects over it
+//	metadata: per row, the metadata of the stat; 'label' is used for the x axis
+//	units:    per series, 'ns' (durations), 'b' (bytes) or '' for plain numbers
+//	unit:     the unit of the y axis, or '' if the series have different units
+//
+// Hovering shows the values and metadata of the nearest row in #gutter, dragging selects a region
+// to zoom in on, and double-clicking zooms out again.
+(function () {
+	var input = JSON.parse(document.getElementById('chart-data').textContent);
+	var series = input.series || [];
+	var data = input.data || [];
+	var metadata = input.metadata || [];
+	var units = input.units || [];
+	var unit = input.unit || '';
+
+	var container = document.getElementById('chart');
+	var legend = document.getElementById('chart-legend');
+	var gutter = document.getElementById('gutter');
+	var canvas = document.createElement('canvas');
+	container.appendChild(canvas);
+	var ctx = canvas.getContext('2d');
+
+	var colors = ['#4e79a7', '#f28e2b', '#e15759', '#76b7b2', '#59a14f', '#edc948', '#b07aa1', '#ff9da7', '#9c755f', '#bab0ac'];
+	var margin = { top: 10, right: 20, bottom: 60, left: 80 };
+
+	var view = { min: 0, max: Math.max(data.length - 1, 1) };
+	var hover = null;
+	var drag = null;
+
+	function oneDecimal(v) {
+		return Math.round(v * 10) / 10;
+	}
+
+	function formatNanoseconds(ns) {
+		var ms = 1e+6;
+		var s = ms * 1000.0;
+		var m = s * 60.0;
+		var h = m * 60.0;
+		if ((ns / ms) < 1.0) {
+			return ns + 'ns';
+		} else if ((ns / s) < 1.0) {
+			return Math.round(ns / ms) + 'ms';
+		} else if ((ns / m) < 1.0) {
+			return oneDecimal(ns / s) + 's';
+		} else if ((ns / h) < 1.0) {
+			return Math.trunc(ns / m) + 'm' + Math.round((ns % m) / s) + 's';
+		}
+		return Math.trunc(ns / h) + 'h' + Math.trunc((ns % h) / m) + 'm' + Math.round(((ns % h) % m) / s) + 's';
+	}
+
+	function formatBytes(v) {
+		var units = ['b', 'KiB', 'MiB', 'GiB', 'TiB'];
+		for (var i = 0; i < units.length; i++) {
+			if (Math.abs(v) < Math.pow(1024, i + 1) || i === units.length - 1) {
+				return oneDecimal(v / Math.pow(1024, i)) + units[i];
+			}
+		}
+	}
+
+	function formatValue(v, u) {
+		if (u === 'ns') {
+			return formatNanoseconds(v);
+		} else if (u === 'b') {
+			return formatBytes(v);
+		}
+		return v + '';
+	}
+
+	function style(name) {
+		return getComputedStyle(document.documentElement).getPropertyValue(name).trim();
+	}
+
+	// niceTicks returns about count evenly spaced round values covering [min, max].
+	function niceTicks(min, max, count) {
+		if (min === max) {
+			min -= 1;
+			max += 1;
+		}
+		var step = Math.pow(10, Math.floor(Math.log10((max - min) / count)));
+		var error = (max - min) / count / step;
+		if (error >= 5) {
+			step *= 10;
+		} else if (error >= 2) {
+			step *= 5;
+		} else if (error >= 1.5) {
+			step *= 2;
+		}
+		var ticks = [];
+		for (var v = Math.floor(min / step) * step; v <= max + step / 2; v += step) {
+			ticks.push(v);
+		}
+		return ticks;
+	}
+
+	function layout() {
+		var rect = container.getBoundingClientRect();
+		var ratio = window.devicePixelRatio || 1;
+		canvas.width = rect.width * ratio;
+		canvas.height = rect.height * ratio;
+		ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+		return { width: rect.width, height: rect.height };
+	}
+
+	function draw() {
+		var size = layout();
+		var plot = {
+			left: margin.left,
+			top: margin.top,
+			width: size.width - margin.left - margin.right,
+			height: size.height - margin.top - margin.bottom,
+		};
+		ctx.clearRect(0, 0, size.width, size.height);
+		ctx.font = '12px ' + getComputedStyle(document.body).fontFamily;
+
+		var lo = Infinity, hi = -Infinity;
+		data.forEach(function (row) {
+			if (row[0] < view.min || row[0] > view.max) {
+				return;
+			}
+			for (var i = 1; i < row.length; i++) {
+				if (row[i] !== null) {
+					lo = Math.min(lo, row[i]);
+					hi = Math.max(hi, row[i]);
+				}
+			}
+		});
+		if (lo === Infinity) {
+			lo = 0;
+			hi = 1;
+		}
+		var yTicks = niceTicks(lo, hi, 6);
+		var yMin = yTicks[0], yMax = yTicks[yTicks.length - 1];
+		var x = function (v) {
+			return plot.left + (v - view.min) / (view.max - view.min) * plot.width;
+		};
+		var y = function (v) {
+			return plot.top + plot.height - (v - yMin) / (yMax - yMin) * plot.height;
+		};
+
+		// Grid and axes.
+		ctx.strokeStyle = style('--border');
+		ctx.fillStyle = style('--muted');
+		ctx.lineWidth = 1;
+		ctx.textAlign = 'right';
+		ctx.textBaseline = 'middle';
+		yTicks.forEach(function (v) {
+			ctx.beginPath();
+			ctx.moveTo(plot.left, Math.round(y(v)) + 0.5);
+			ctx.lineTo(plot.left + plot.width, Math.round(y(v)) + 0.5);
+			ctx.stroke();
+			ctx.fillText(formatValue(v, unit), plot.left - 8, y(v));
+		});
+		var every = Math.max(1, Math.ceil((view.max - view.min) / (plot.width / 50)));
+		for (var i = Math.ceil(view.min); i <= view.max; i += every) {
+			if (!metadata[i]) {
+				continue;
+			}
+			ctx.save();
+			ctx.translate(x(i), plot.top + plot.height + 8);
+			ctx.rotate(-Math.PI / 6);
+			ctx.fillText(String(metadata[i].label), 0, 0);
+			ctx.restore();
+		}
+
+		// Series, clipped to the plot area.
+		ctx.save();
+		ctx.beginPath();
+		ctx.rect(plot.left, plot.top, plot.width, plot.height);
+		ctx.clip();
+		series.forEach(function (name, s) {
+			ctx.strokeStyle = colors[s % colors.length];
+			ctx.fillStyle = colors[s % colors.length];
+			ctx.lineWidth = 1.5;
+			ctx.beginPath();
+			var started = false;
+			data.forEach(function (row) {
+				var v = row[s + 1];
+				if (v === null || v === undefined) {
+					return;
+				}
+				if (started) {
+					ctx.lineTo(x(row[0]), y(v));
+				} else {
+					ctx.moveTo(x(row[0]), y(v));
+					started = true;
+				}
+			});
+			ctx.stroke();
+			if (hover !== null && data[hover][s + 1] !== null) {
+				ctx.beginPath();
+				ctx.arc(x(data[hover][0]), y(data[hover][s + 1]), 4, 0, 2 * Math.PI);
+				ctx.fill();
+			}
+		});
+		if (hover !== null) {
+			ctx.strokeStyle = style('--muted');
+			ctx.beginPath();
+			ctx.moveTo(Math.round(x(data[hover][0])) + 0.5, plot.top);
+			ctx.lineTo(Math.round(x(data[hover][0])) + 0.5, plot.top + plot.height);
+			ctx.stroke();
+		}
+		if (drag !== null) {
+			ctx.fillStyle = style('--border');
+			ctx.globalAlpha = 0.5;
+			ctx.fillRect(Math.min(drag.from, drag.to), plot.top, Math.abs(drag.to - drag.from), plot.height);
+			ctx.globalAlpha = 1;
+		}
+		ctx.restore();
+
+		draw.plot = plot;
+		draw.x = x;
+	}
+
+	// rowAt returns the index of the row nearest to the canvas x coordinate px.
+	function rowAt(px) {
+		var plot = draw.plot;
+		var v = view.min + (px - plot.left) / plot.width * (view.max - view.min);
+		var best = null;
+		data.forEach(function (row, i) {
+			if (best === null || Math.abs(row[0] - v) < Math.abs(data[best][0] - v)) {
+				best = i;
+			}
+		});
+		return best;
+	}
+
+	function showLegend() {
+		legend.textContent = '';
+		series.forEach(function (name, s) {
+			var item = document.createElement('span');
+			var swatch = document.createElement('i');
+			swatch.style.background = colors[s % colors.length];
+			item.appendChild(swatch);
+			var text = name;
+			if (hover !== null && data[hover][s + 1] !== null) {
+				text += ': ' + formatValue(data[hover][s + 1], units[s]);
+			}
+			item.appendChild(document.createTextNode(text));
+			legend.appendChild(item);
+		});
+	}
+
+	function showGutter(row) {
+		gutter.textContent = '';
+		var title = document.createElement('b');
+		title.textContent = 'Data point:';
+		gutter.appendChild(title);
+		var line = function (text) {
+			gutter.appendChild(document.createElement('br'));
+			gutter.appendChild(document.createTextNode(text));
+		};
+		for (var i = 1; i < data[row].length; i++) {
+			if (data[row][i] !== null) {
+				line(series[i - 1] + ': ' + formatValue(data[row][i], units[i - 1]));
+			}
+		}
+		for (var key in metadata[row]) {
+			line(key + ': ' + metadata[row][key]);
+		}
+	}
+
+	function offsetX(e) {
+		return e.clientX - canvas.getBoundingClientRect().left;
+	}
+
+	canvas.addEventListener('mousemove', function (e) {
+		if (data.length === 0) {
+			return;
+		}
+		if (drag !== null) {
+			drag.to = offsetX(e);
+		}
+		hover = rowAt(offsetX(e));
+		showLegend();
+		showGutter(hover);
+		draw();
+	});
+	canvas.addEventListener('mouseleave', function () {
+		hover = null;
+		drag = null;
+		showLegend();
+		draw();
+	});
+	canvas.addEventListener('mousedown', function (e) {
+		drag = { from: offsetX(e), to: offsetX(e) };
+	});
+	canvas.addEventListener('mouseup', function () {
+		if (drag !== null && Math.abs(drag.to - drag.from) > 5) {
+			var plot = draw.plot;
+			var toValue = function (px) {
+				return view.min + (px - plot.left) / plot.width * (view.max - view.min);
+			};
+			var min = toValue(Math.min(drag.from, drag.to));
+			var max = toValue(Math.max(drag.from, drag.to));
+			min = Math.max(min, 0);
+			max = Math.min(max, Math.max(data.length - 1, 1));
+			if (max > min) {
+				view = { min: min, max: max };
+			}
+		}
+		drag = null;
+		draw();
+	});
+	canvas.addEventListener('dblclick', function () {
+		view = { min: 0, max: Math.max(data.length - 1, 1) };
+		draw();
+	});
+	window.addEventListener('resize', draw);
+	window.addEventListener('themechange', draw);
+	window.matchMedia('(prefers-color-scheme: dark)').addEventListener('change', draw);
+
+	showLegend();
+	draw();
+})();
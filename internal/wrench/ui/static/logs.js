@@ -0,0 +1,21 @@
+// Follows a job log page: new log lines are appended as they are streamed, until the job
+// finishes.
+(function () {
+	var logs = document.getElementById('logs');
+	var state = document.getElementById('state');
+	// The stream URL starts after the lines already on the page.
+	var source = new EventSource(logs.dataset.stream);
+	source.onmessage = function (e) {
+		var follow = window.innerHeight + window.scrollY >= document.body.scrollHeight - 10;
+		logs.append(e.data + '\n');
+		if (follow) {
+			window.scrollTo(0, document.body.scrollHeight);
+		}
+	};
+	source.addEventListener('state', function (e) {
+		state.textContent = e.data;
+		if (e.data === 'success' || e.data === 'error') {
+			source.close();
+		}
+	});
+})();
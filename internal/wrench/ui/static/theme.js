@@ -0,0 +1,23 @@
+// Applies the theme chosen with the toggle button (if any), and otherwise follows the system
+// preference via the prefers-color-scheme media query in style.css.
+(function () {
+	var root = document.documentElement;
+	var stored = localStorage.getItem('theme');
+	if (stored) {
+		root.dataset.theme = stored;
+	}
+	document.addEventListener('DOMContentLoaded', function () {
+		var toggle = document.getElementById('theme-toggle');
+		if (!toggle) {
+			return;
+		}
+		toggle.addEventListener('click', function () {
+			var dark = root.dataset.theme
+				? root.dataset.theme === 'dark'
+				: window.matchMedia('(prefers-color-scheme: dark)').matches;
+			root.dataset.theme = dark ? 'light' : 'dark';
+			localStorage.setItem('theme', root.dataset.theme);
+			window.dispatchEvent(new Event('themechange'));
+		});
+	});
+})();
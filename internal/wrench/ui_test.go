@@ -0,0 +1,84 @@
+package wrench
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	wrench := &Config{
+		ExternalURL:             "https://wrench.example.com",
+		GitHubOAuthClientID:     "id",
+		GitHubOAuthClientSecret: "secret",
+	}
+	pkg := &Config{Mode: "pkg", ExternalURL: "https://pkg.example.com"}
+	for _, tst := range []struct {
+		name     string
+		config   *Config
+		identity *Identity
+		title    string
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:    "signed out",
+			config:  wrench,
+			title:   "Logs",
+			want:    []string{"<title>Logs - wrench</title>", `href="https://wrench.example.com/login"`, `href="https://wrench.example.com/projects"`},
+			notWant: []string{`<a href="https://wrench.example.com/audit">Audit</a>`, "Sign out"},
+		},
+		{
+			name:     "operator",
+			config:   wrench,
+			identity: &Identity{Login: "alice", Role: RoleOperator},
+			want:     []string{"alice (operator)", `action="https://wrench.example.com/logout"`},
+			notWant:  []string{`<a href="https://wrench.example.com/audit">Audit</a>`, "Sign in with GitHub"},
+		},
+		{
+			name:     "admin",
+			config:   wrench,
+			identity: &Identity{Login: "alice", Role: RoleAdmin},
+			want:     []string{`<a href="https://wrench.example.com/audit">Audit</a>`},
+		},
+		{
+			name:    "pkg mode",
+			config:  pkg,
+			want:    []string{"<title>pkg.example.com</title>"},
+			notWant: []string{`<a href="https://pkg.example.com/projects">Projects</a>`, "Sign in with GitHub"},
+		},
+		{
+			name:    "escaped title",
+			config:  wrench,
+			title:   "<script>",
+			want:    []string{"<title>&lt;script&gt; - wrench</title>"},
+			notWant: []string{"<script>"},
+		},
+	} {
+		b := &Bot{Config: tst.config}
+		r := httptest.NewRequest("GET", "/", nil)
+		if tst.identity != nil {
+			r = r.WithContext(withIdentity(r.Context(), tst.identity))
+		}
+		w := httptest.NewRecorder()
+		if err := b.render(w, r, "index", tst.title, nil); err != nil {
+			t.Fatalf("%s: %v", tst.name, err)
+		}
+		body := w.Body.String()
+		for _, want := range tst.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: expected page to contain %q", tst.name, want)
+			}
+		}
+		for _, notWant := range tst.notWant {
+			if strings.Contains(body, notWant) {
+				t.Errorf("%s: expected page not to contain %q", tst.name, notWant)
+			}
+		}
+	}
+
+	b := &Bot{Config: wrench}
+	if err := b.render(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), "nonexistent", "", nil); err == nil {
+		t.Fatal("expected an error for an unknown template")
+	}
+}
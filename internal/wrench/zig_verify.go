@@ -0,0 +1,224 @@
+package wrench
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/natefinch/atomic"
+)
+
+// Zig download verification statuses.
+const (
+	zigVerified = "verified"
+	zigUnsigned = "unsigned" // no signature upstream, and Config.ZigAllowUnsigned
+	zigFailed   = "failed"
+)
+
+// zigVerification records the outcome of verifying a cached Zig download against its signature.
+type zigVerification struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+
+	// Key is the public key the download was verified with.
+	Key string `json:"key,omitempty"`
+
+	// TrustedComment is the signed comment of the signature, e.g. the file name and timestamp.
+	TrustedComment string `json:"trustedComment,omitempty"`
+
+	// Error is why verification failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Verifications of cached Zig downloads by cache path, persisted in zig-verifications.json.
+var (
+	zigVerificationsMu     sync.Mutex
+	zigVerificationsLoaded bool
+	zigVerifications       map[string]zigVerification
+)
+
+func (b *Bot) zigVerificationsPath() string {
+	return filepath.Join(b.Config.WrenchDir, "zig-verifications.json")
+}
+
+// zigVerificationsLoad loads zig-verifications.json, if it has not been loaded yet. The caller
+// must hold zigVerificationsMu.
+func (b *Bot) zigVerificationsLoad() {
+	if zigVerificationsLoaded {
+		return
+	}
+	zigVerifications = map[string]zigVerification{}
+	data, err := os.ReadFile(b.zigVerificationsPath())
+	if err != nil && !os.IsNotExist(err) {
+		b.logf("zig verification: %v", err)
+	} else if err == nil {
+		if err := json.Unmarshal(data, &zigVerifications); err != nil {
+			b.logf("zig verification: %v", err)
+		}
+	}
+	zigVerificationsLoaded = true
+}
+
+func (b *Bot) zigVerificationOf(filePath string) (zigVerification, bool) {
+	zigVerificationsMu.Lock()
+	defer zigVerificationsMu.Unlock()
+	b.zigVerificationsLoad()
+	v, ok := zigVerifications[filePath]
+	return v, ok
+}
+
+func (b *Bot) zigRecordVerification(filePath string, v zigVerification) {
+	metricPkgZigVerifications.WithLabelValues(v.Status).Inc()
+	if v.Status == zigFailed {
+		b.idLogf("zig", "verification failed: %s: %s", filePath, v.Error)
+	}
+
+	zigVerificationsMu.Lock()
+	defer zigVerificationsMu.Unlock()
+	b.zigVerificationsLoad()
+	zigVerifications[filePath] = v
+	b.zigVerificationsSave()
+}
+
+// zigForgetVerifications removes the verification records of files no longer cached.
+func (b *Bot) zigForgetVerifications(filePaths ...string) {
+	zigVerificationsMu.Lock()
+	defer zigVerificationsMu.Unlock()
+	b.zigVerificationsLoad()
+	for _, filePath := range filePaths {
+		delete(zigVerifications, filePath)
+	}
+	b.zigVerificationsSave()
+}
+
+// zigVerificationsSave writes zig-verifications.json. The caller must hold zigVerificationsMu.
+func (b *Bot) zigVerificationsSave() {
+	data, err := json.MarshalIndent(zigVerifications, "", "  ")
+	if err != nil {
+		b.logf("zig verification: %v", err)
+		return
+	}
+	if err := atomic.WriteFile(b.zigVerificationsPath(), strings.NewReader(string(data))); err != nil {
+		b.logf("zig verification: %v", err)
+	}
+}
+
+// zigPublicKey returns the key Zig downloads must be signed with, or nil if downloads are not
+// verified.
+func (b *Bot) zigPublicKey() (*minisignPublicKey, error) {
+	if b.Config.ZigPublicKey == "disabled" {
+		return nil, nil
+	}
+	key := b.Config.ZigPublicKey
+	if key == "" {
+		key = zsfPublicKey
+	}
+	pk, err := parseMinisignPublicKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "ZigPublicKey")
+	}
+	return &pk, nil
+}
+
+// zigVerifyDownload verifies the Zig download f, to be cached at filePath, against the signature
+// cached at filePath.minisig and records the outcome.
+func (b *Bot) zigVerifyDownload(filePath string, f *os.File) error {
+	pk, err := b.zigPublicKey()
+	if err != nil || pk == nil {
+		return err
+	}
+	v := zigVerification{Time: time.Now(), Key: b.Config.ZigPublicKey}
+	err = func() error {
+		data, err := os.ReadFile(filePath + ".minisig")
+		if os.IsNotExist(err) && b.Config.ZigAllowUnsigned {
+			v.Status = zigUnsigned
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "reading signature")
+		}
+		sig, err := parseMinisignSignature(data)
+		if err != nil {
+			return err
+		}
+		v.TrustedComment = sig.trustedComment
+		if err := pk.verify(sig, f); err != nil {
+			return err
+		}
+		// The trusted comment names the signed file, so that a validly signed file cannot be
+		// served in place of another.
+		for _, field := range strings.Fields(sig.trustedComment) {
+			if signed, ok := strings.CutPrefix(field, "file:"); ok && signed != filepath.Base(filePath) {
+				return fmt.Errorf("signature is for a different file (%s)", signed)
+			}
+		}
+		v.Status = zigVerified
+		return nil
+	}()
+	if err != nil {
+		v.Status, v.Error = zigFailed, err.Error()
+	}
+	b.zigRecordVerification(filePath, v)
+	return err
+}
+
+// zigCachedVerified reports whether the Zig download fname is cached, and verified. Files cached
+// before they were verified are verified now, and removed from the cache if that fails.
+func (b *Bot) zigCachedVerified(version, versionKind, fname string) bool {
+	filePath := path.Join("cache/zig/", versionKind, version, fname)
+	if _, err := os.Stat(filePath); err != nil {
+		return false
+	}
+	pk, err := b.zigPublicKey()
+	if err != nil {
+		b.idLogf("zig", "%v", err)
+		return false
+	}
+	if pk == nil || strings.HasSuffix(fname, ".minisig") {
+		return true
+	}
+	if v, ok := b.zigVerificationOf(filePath); ok && v.Key == b.Config.ZigPublicKey {
+		switch v.Status {
+		case zigVerified:
+			return true
+		case zigUnsigned:
+			if b.Config.ZigAllowUnsigned {
+				return true
+			}
+		}
+	}
+
+	if err := b.httpPkgEnsureZigSignatureCached(version, versionKind, fname); err != nil {
+		b.idLogf("zig", "not serving unverified %s: %v", filePath, err)
+		return false
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	err = b.zigVerifyDownload(filePath, f)
+	_ = f.Close()
+	if err != nil {
+		b.zigRemoveUnverified(filePath)
+		return false
+	}
+	return true
+}
+
+// zigRemoveUnverified removes a Zig download which failed verification from the cache, along
+// with its signature, which may be what is wrong (e.g. a truncated or mismatched .minisig), so
+// that both are fetched again.
+func (b *Bot) zigRemoveUnverified(filePath string) {
+	paths := []string{filePath, filePath + ".minisig"}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			b.idLogf("zig", "%v", err)
+		}
+	}
+	b.pkgCacheForgetAccess(paths...)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+// jobsCommands contains all registered 'wrench jobs' subcommands.
+var jobsCommands cmder.Commander
+
+var (
+	jobsFlagSet    = flag.NewFlagSet("jobs", flag.ExitOnError)
+	jobsConfigFile = jobsFlagSet.String("config", defaultConfigFilePath(), "Path to TOML configuration file (see config.go)")
+)
+
+func init() {
+	const usage = `wrench jobs: manage jobs performed by runners
+
+Usage:
+
+	wrench jobs [-config=config.toml] <command> [arguments]
+
+The commands are:
+
+	list         list jobs
+	show         show details of a job
+	logs         print (or follow) the logs of a job
+	run          run a command on a runner
+	cancel       cancel a job
+	retry        run a job again
+
+Use "wrench jobs <command> -h" for more information about a command.
+`
+
+	usageFunc := func() {
+		fmt.Printf("%s", usage)
+	}
+	jobsFlagSet.Usage = usageFunc
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = jobsFlagSet.Parse(args)
+		jobsCommands.Run(jobsFlagSet, "wrench jobs", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	commands = append(commands, &cmder.Command{
+		FlagSet:   jobsFlagSet,
+		Handler:   handler,
+		UsageFunc: usageFunc,
+	})
+}
+
+// followJobLogs prints the logs of a job starting at offset, polling for new logs until the job
+// finishes. If the job fails, an *cmder.ExitCodeError is returned so that scripts can detect it.
+func followJobLogs(ctx context.Context, client *api.Client, id api.JobID, offset int, follow bool) error {
+	for {
+		resp, err := client.JobsLogs(ctx, &api.JobsLogsRequest{ID: id, Offset: offset})
+		if err != nil {
+			return errors.Wrap(err, "JobsLogs")
+		}
+		if resp.NotFound {
+			return fmt.Errorf("job %q not found", id)
+		}
+		for _, log := range resp.Logs {
+			fmt.Printf("%v %v\n", log.Time.UTC().Format(time.RFC3339), log.Message)
+		}
+		offset = resp.Offset
+
+		switch resp.State {
+		case api.JobStateSuccess:
+			return nil
+		case api.JobStateError:
+			if follow {
+				return &cmder.ExitCodeError{Err: fmt.Errorf("job %s failed", id), ExitCode: 1}
+			}
+			return nil
+		}
+		if !follow {
+			return nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func printJob(job api.Job) {
+	fmt.Printf("%s  %-8s  %s\n", job.ID, job.State, job.Title)
+}
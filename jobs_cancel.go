@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func init() {
+	const usage = `
+Examples:
+
+  Cancel a job which has not finished yet:
+
+    $ wrench jobs cancel [id]
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("cancel", flag.ExitOnError)
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if flagSet.NArg() != 1 {
+			return &cmder.UsageError{Err: errors.New("expected [id] argument")}
+		}
+
+		ctx := context.Background()
+		client, err := wrench.Client(*jobsConfigFile)
+		if err != nil {
+			return errors.Wrap(err, "Client")
+		}
+		resp, err := client.JobsCancel(ctx, &api.JobsCancelRequest{ID: api.JobID(flagSet.Arg(0))})
+		if err != nil {
+			return errors.Wrap(err, "JobsCancel")
+		}
+		if resp.NotFound {
+			return fmt.Errorf("job %q not found", flagSet.Arg(0))
+		}
+		fmt.Printf("job cancelled: %s\n", flagSet.Arg(0))
+		return nil
+	}
+
+	// Register the command.
+	jobsCommands = append(jobsCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench jobs %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
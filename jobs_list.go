@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func init() {
+	const usage = `
+Examples:
+
+  List the most recent jobs:
+
+    $ wrench jobs list
+
+  List failed jobs on a specific runner:
+
+    $ wrench jobs list -state=error -runner=linux
+
+  List the next page of jobs:
+
+    $ wrench jobs list -cursor=<cursor printed by the previous page>
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	state := flagSet.String("state", "", "only list jobs in this state (ready, starting, running, success, error)")
+	title := flagSet.String("title", "", "only list jobs with this exact title")
+	runner := flagSet.String("runner", "", "only list jobs targeting this runner ID")
+	limit := flagSet.Int("limit", 20, "maximum number of jobs to list")
+	cursor := flagSet.String("cursor", "", "list jobs after this cursor (from a previous page)")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+
+		ctx := context.Background()
+		client, err := wrench.Client(*jobsConfigFile)
+		if err != nil {
+			return errors.Wrap(err, "Client")
+		}
+		resp, err := client.JobsList(ctx, &api.JobsListRequest{
+			State:          api.JobState(*state),
+			Title:          *title,
+			TargetRunnerID: *runner,
+			Limit:          *limit,
+			Cursor:         *cursor,
+		})
+		if err != nil {
+			return errors.Wrap(err, "JobsList")
+		}
+		if len(resp.Jobs) == 0 {
+			fmt.Println("no jobs found")
+		}
+		for _, job := range resp.Jobs {
+			printJob(job)
+		}
+		if resp.NextCursor != "" {
+			fmt.Printf("\nmore jobs: wrench jobs list -cursor=%s\n", resp.NextCursor)
+		}
+		return nil
+	}
+
+	// Register the command.
+	jobsCommands = append(jobsCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench jobs %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func init() {
+	const usage = `
+With -f, the exit code is 1 if the job fails, so it can be used from shell scripts.
+
+Examples:
+
+  Print the logs of a job:
+
+    $ wrench jobs logs [id]
+
+  Follow the logs of a job until it finishes:
+
+    $ wrench jobs logs -f [id]
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("logs", flag.ExitOnError)
+	follow := flagSet.Bool("f", false, "follow the logs until the job finishes")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if flagSet.NArg() != 1 {
+			return &cmder.UsageError{Err: errors.New("expected [id] argument")}
+		}
+
+		ctx := context.Background()
+		client, err := wrench.Client(*jobsConfigFile)
+		if err != nil {
+			return errors.Wrap(err, "Client")
+		}
+		return followJobLogs(ctx, client, api.JobID(flagSet.Arg(0)), 0, *follow)
+	}
+
+	// Register the command.
+	jobsCommands = append(jobsCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench jobs %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func init() {
+	const usage = `
+A new job is created with the same title, target runner and payload as the given job. With -f,
+the exit code is 1 if the new job fails, so it can be used from shell scripts.
+
+Examples:
+
+  Run a failed job again:
+
+    $ wrench jobs retry [id]
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("retry", flag.ExitOnError)
+	follow := flagSet.Bool("f", false, "follow the logs until the new job finishes")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if flagSet.NArg() != 1 {
+			return &cmder.UsageError{Err: errors.New("expected [id] argument")}
+		}
+
+		ctx := context.Background()
+		client, err := wrench.Client(*jobsConfigFile)
+		if err != nil {
+			return errors.Wrap(err, "Client")
+		}
+		job, err := client.JobsGet(ctx, &api.JobsGetRequest{ID: api.JobID(flagSet.Arg(0))})
+		if err != nil {
+			return errors.Wrap(err, "JobsGet")
+		}
+		if job.NotFound {
+			return fmt.Errorf("job %q not found", flagSet.Arg(0))
+		}
+		resp, err := client.JobsCreate(ctx, &api.JobsCreateRequest{
+			Title:            job.Job.Title,
+			TargetRunnerID:   job.Job.TargetRunnerID,
+			TargetRunnerArch: job.Job.TargetRunnerArch,
+			Payload:          job.Job.Payload,
+		})
+		if err != nil {
+			return errors.Wrap(err, "JobsCreate")
+		}
+		fmt.Printf("job created: %s\n", resp.ID)
+		if !*follow {
+			return nil
+		}
+		return followJobLogs(ctx, client, resp.ID, 0, true)
+	}
+
+	// Register the command.
+	jobsCommands = append(jobsCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench jobs %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
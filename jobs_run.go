@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func init() {
+	const usage = `
+The arguments are run as 'wrench [arguments]' on the runner. With -f, the exit code is 1 if the
+job fails, so it can be used from shell scripts.
+
+Examples:
+
+  Run 'wrench script rebuild' on a runner (see 'wrench runners' for runner IDs):
+
+    $ wrench jobs run -runner=linux script rebuild
+
+  Run a script on any runner, and follow its logs until it finishes:
+
+    $ wrench jobs run -f script update-deps
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("run", flag.ExitOnError)
+	runner := flagSet.String("runner", "", "runner ID to run the job on (default any runner)")
+	arch := flagSet.String("arch", "", "runner architecture to run the job on, e.g. linux/amd64 (default any)")
+	title := flagSet.String("title", "", "job title (default the command)")
+	background := flagSet.Bool("background", false, "run the job in the background, alongside other jobs")
+	secrets := flagSet.String("secrets", "", "comma-separated list of secret IDs to give the job access to")
+	pushBranch := flagSet.String("push-branch", "", "git branch name the job pushes changes to")
+	follow := flagSet.Bool("f", false, "follow the logs until the job finishes")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if flagSet.NArg() == 0 {
+			return &cmder.UsageError{Err: errors.New("expected command to run")}
+		}
+
+		ctx := context.Background()
+		client, err := wrench.Client(*jobsConfigFile)
+		if err != nil {
+			return errors.Wrap(err, "Client")
+		}
+		req := &api.JobsCreateRequest{
+			Title:            *title,
+			TargetRunnerID:   *runner,
+			TargetRunnerArch: *arch,
+			Payload: api.JobPayload{
+				Cmd:               flagSet.Args(),
+				Background:        *background,
+				GitPushBranchName: *pushBranch,
+			},
+		}
+		if req.Title == "" {
+			req.Title = strings.Join(flagSet.Args(), " ")
+		}
+		if *secrets != "" {
+			req.Payload.SecretIDs = strings.Split(*secrets, ",")
+		}
+		resp, err := client.JobsCreate(ctx, req)
+		if err != nil {
+			return errors.Wrap(err, "JobsCreate")
+		}
+		fmt.Printf("job created: %s\n", resp.ID)
+		if !*follow {
+			return nil
+		}
+		return followJobLogs(ctx, client, resp.ID, 0, true)
+	}
+
+	// Register the command.
+	jobsCommands = append(jobsCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench jobs %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
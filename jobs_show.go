@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+func init() {
+	const usage = `
+Examples:
+
+  Show details of a job:
+
+    $ wrench jobs show [id]
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("show", flag.ExitOnError)
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if flagSet.NArg() != 1 {
+			return &cmder.UsageError{Err: errors.New("expected [id] argument")}
+		}
+
+		ctx := context.Background()
+		client, err := wrench.Client(*jobsConfigFile)
+		if err != nil {
+			return errors.Wrap(err, "Client")
+		}
+		resp, err := client.JobsGet(ctx, &api.JobsGetRequest{ID: api.JobID(flagSet.Arg(0))})
+		if err != nil {
+			return errors.Wrap(err, "JobsGet")
+		}
+		if resp.NotFound {
+			return fmt.Errorf("job %q not found", flagSet.Arg(0))
+		}
+		job := resp.Job
+		formatTime := func(t time.Time) string {
+			if t.IsZero() {
+				return "-"
+			}
+			return t.UTC().Format(time.RFC3339)
+		}
+		for _, pair := range [][2]string{
+			{"id", string(job.ID)},
+			{"title", job.Title},
+			{"state", string(job.State)},
+			{"target runner ID", job.TargetRunnerID},
+			{"target runner arch", job.TargetRunnerArch},
+			{"command", "wrench " + strings.Join(job.Payload.Cmd, " ")},
+			{"background", fmt.Sprint(job.Payload.Background)},
+			{"secrets", strings.Join(job.Payload.SecretIDs, ", ")},
+			{"scheduled start", formatTime(job.ScheduledStart)},
+			{"updated", formatTime(job.Updated)},
+			{"created", formatTime(job.Created)},
+		} {
+			fmt.Printf("%-20s %s\n", pair[0]+":", pair[1])
+		}
+		return nil
+	}
+
+	// Register the command.
+	jobsCommands = append(jobsCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench jobs %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
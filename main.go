@@ -21,8 +21,11 @@ The commands are:
 
 	service    manage the wrench service (also 'wrench svc')
 	script     execute a script built-in to wrench
-	runners    (remote) list registered runners
+	runners    list runners and manage their certificates
+	jobs       (remote) list, run and follow jobs
 	secret     (remote) manage secrets
+	audit      (remote) list privileged actions from the audit log
+	store      manage the wrench database
 	git        manage local git repositories
 	version    print the wrench version
 
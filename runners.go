@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+	"github.com/hexops/wrench/internal/wrench/api"
+)
+
+// runnersCommands contains all registered 'wrench runners' subcommands.
+var runnersCommands cmder.Commander
+
+var (
+	runnersFlagSet    = flag.NewFlagSet("runners", flag.ExitOnError)
+	runnersConfigFile = runnersFlagSet.String("config", defaultConfigFilePath(), "Path to TOML configuration file (see config.go)")
+)
+
+func init() {
+	const usage = `wrench runners: list and manage runners
+
+Usage:
+
+	wrench runners [-config=config.toml]
+	wrench runners [-config=config.toml] <command> [arguments]
+
+Without a command, registered runners are listed. The commands are:
+
+	issue-cert   (local) issue a client certificate to a runner
+	certs        (local) list issued runner certificates
+	revoke-cert  (local) revoke runner certificates
+
+Use "wrench runners <command> -h" for more information about a command.
+`
+
+	usageFunc := func() {
+		fmt.Printf("%s", usage)
+	}
+	runnersFlagSet.Usage = usageFunc
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = runnersFlagSet.Parse(args)
+		if runnersFlagSet.NArg() == 0 {
+			return runnersList()
+		}
+		runnersCommands.Run(runnersFlagSet, "wrench runners", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	commands = append(commands, &cmder.Command{
+		FlagSet:   runnersFlagSet,
+		Handler:   handler,
+		UsageFunc: usageFunc,
+	})
+}
+
+// runnersList prints the registered runners.
+func runnersList() error {
+	ctx := context.Background()
+	client, err := wrench.Client(*runnersConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "Client")
+	}
+	resp, err := client.RunnerList(ctx, &api.RunnerListRequest{})
+	if err != nil {
+		return errors.Wrap(err, "RunnerList")
+	}
+	if len(resp.Runners) == 0 {
+		fmt.Println("no runners found")
+	}
+	for _, runner := range resp.Runners {
+		fmt.Printf("'%v' (%v)\n", runner.ID, runner.Arch)
+		fmt.Printf("    registered: %v ago\n", time.Since(runner.RegisteredAt).Round(time.Hour*24))
+		fmt.Printf("    last seen: %v ago\n\n", time.Since(runner.LastSeenAt).Round(time.Second))
+	}
+	return nil
+}
+
+// runnersServerStore opens the store of the wrench server, for (local) commands.
+func runnersServerStore() (*wrench.Config, wrench.Store, error) {
+	var cfg wrench.Config
+	if err := wrench.LoadConfig(*runnersConfigFile, &cfg); err != nil {
+		return nil, nil, errors.Wrap(err, "LoadConfig")
+	}
+	if cfg.ModeType() != wrench.ModeWrench || cfg.Runner != "" {
+		return nil, nil, errors.New("this command must be run on the wrench server (not pkg/zig mode or runners)")
+	}
+	store, err := wrench.OpenStore(&cfg)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "OpenStore")
+	}
+	return &cfg, store, nil
+}
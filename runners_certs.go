@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+)
+
+func init() {
+	const usage = `
+This must be run on the wrench server itself.
+
+Examples:
+
+  List all issued runner certificates:
+
+    $ wrench runners certs
+
+  List the certificates issued to one runner:
+
+    $ wrench runners certs -runner=linux-amd64
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("certs", flag.ExitOnError)
+	runner := flagSet.String("runner", "", "only list certificates issued to this runner ID")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+
+		_, store, err := runnersServerStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close() //nolint:errcheck
+
+		certs, err := store.RunnerCerts(context.Background(), *runner)
+		if err != nil {
+			return errors.Wrap(err, "RunnerCerts")
+		}
+		if len(certs) == 0 {
+			fmt.Println("no runner certificates found")
+		}
+		for _, cert := range certs {
+			status := "valid"
+			if cert.Revoked != nil {
+				status = "revoked " + cert.Revoked.UTC().Format(time.RFC3339)
+			} else if time.Now().After(cert.Expires) {
+				status = "expired"
+			}
+			fmt.Printf("%s '%s' (%s)\n", cert.Serial, cert.RunnerID, status)
+			fmt.Printf("    issued: %s, expires: %s\n", cert.Issued.UTC().Format(time.RFC3339), cert.Expires.UTC().Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	// Register the command.
+	runnersCommands = append(runnersCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench runners %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+)
+
+func init() {
+	const usage = `
+This must be run on the wrench server itself. The runner CA (RunnerCACertFile) is created if it
+does not exist yet. Copy the written certificate and key to the runner, and set in its
+config.toml:
+
+    RunnerCertFile = "<runner>.crt"
+    RunnerKeyFile = "<runner>.key"
+
+Then set RunnerMTLS = true in the server's config.toml to require certificates from all runners.
+
+Examples:
+
+  Issue a certificate for the runner 'linux-amd64':
+
+    $ wrench runners issue-cert -runner=linux-amd64
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("issue-cert", flag.ExitOnError)
+	runner := flagSet.String("runner", "", "runner ID to issue the certificate to")
+	days := flagSet.Int("days", 365, "number of days the certificate is valid for")
+	out := flagSet.String("out", ".", "directory to write <runner>.crt and <runner>.key to")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if *runner == "" {
+			return &cmder.UsageError{Err: errors.New("expected -runner")}
+		}
+		if *days <= 0 {
+			return &cmder.UsageError{Err: errors.New("expected -days to be positive")}
+		}
+
+		cfg, store, err := runnersServerStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close() //nolint:errcheck
+
+		ca, created, err := wrench.LoadRunnerCA(cfg)
+		if err != nil {
+			return errors.Wrap(err, "LoadRunnerCA")
+		}
+		if created {
+			fmt.Printf("created runner CA: %s\n", cfg.Path(cfg.RunnerCACertFile))
+		}
+		certPEM, keyPEM, record, err := ca.Issue(*runner, time.Duration(*days)*24*time.Hour)
+		if err != nil {
+			return errors.Wrap(err, "Issue")
+		}
+		if err := store.RecordRunnerCert(context.Background(), record); err != nil {
+			return errors.Wrap(err, "RecordRunnerCert")
+		}
+
+		certFile := filepath.Join(*out, *runner+".crt")
+		keyFile := filepath.Join(*out, *runner+".key")
+		if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+			return errors.Wrap(err, "WriteFile")
+		}
+		if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+			return errors.Wrap(err, "WriteFile")
+		}
+		fmt.Printf("issued certificate %s to runner '%s', valid until %s\n", record.Serial, *runner, record.Expires.UTC().Format(time.RFC3339))
+		fmt.Printf("    %s\n    %s\n", certFile, keyFile)
+		return nil
+	}
+
+	// Register the command.
+	runnersCommands = append(runnersCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench runners %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+)
+
+func init() {
+	const usage = `
+This must be run on the wrench server itself. Revoked certificates are rejected immediately,
+without restarting the wrench service.
+
+Examples:
+
+  Revoke a single certificate (see 'wrench runners certs'):
+
+    $ wrench runners revoke-cert -serial=3f2a...
+
+  Revoke all certificates issued to a runner:
+
+    $ wrench runners revoke-cert -runner=linux-amd64
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("revoke-cert", flag.ExitOnError)
+	serial := flagSet.String("serial", "", "serial of the certificate to revoke")
+	runner := flagSet.String("runner", "", "revoke all certificates issued to this runner ID")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if (*serial == "") == (*runner == "") {
+			return &cmder.UsageError{Err: errors.New("expected exactly one of -serial or -runner")}
+		}
+
+		_, store, err := runnersServerStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close() //nolint:errcheck
+
+		ctx := context.Background()
+		serials := []string{*serial}
+		if *runner != "" {
+			certs, err := store.RunnerCerts(ctx, *runner)
+			if err != nil {
+				return errors.Wrap(err, "RunnerCerts")
+			}
+			serials = serials[:0]
+			for _, cert := range certs {
+				if cert.Revoked == nil {
+					serials = append(serials, cert.Serial)
+				}
+			}
+			if len(serials) == 0 {
+				fmt.Printf("no unrevoked certificates issued to runner '%s'\n", *runner)
+				return nil
+			}
+		}
+		for _, serial := range serials {
+			if err := store.RevokeRunnerCert(ctx, serial); err != nil {
+				if err == wrench.ErrNotFound {
+					return fmt.Errorf("certificate %s not found", serial)
+				}
+				return errors.Wrap(err, "RevokeRunnerCert")
+			}
+			fmt.Printf("revoked certificate %s\n", serial)
+		}
+		return nil
+	}
+
+	// Register the command.
+	runnersCommands = append(runnersCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench runners %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
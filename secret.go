@@ -27,6 +27,7 @@ The commands are:
 	list         list all secrets
 	delete       delete a secret
 	upsert       create or update a secret
+	rotate-key   (local) encrypt secrets with a new key
 
 Use "wrench secret <command> -h" for more information about a command.
 `
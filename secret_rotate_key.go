@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+)
+
+func init() {
+	const usage = `
+Unlike other 'wrench secret' commands, this must be run on the wrench server itself, as it
+operates on the database directly. Stop the wrench service first, since it would otherwise keep
+using the old key.
+
+If -new-key-file does not exist, a new random key is generated and written to it. Like
+SecretsKeyFile in config.toml, a relative -new-key-file is relative to the wrench directory (the
+directory of config.toml), not the current directory.
+
+Secrets stored in plaintext (before encryption at rest was introduced) are encrypted too.
+
+Examples:
+
+  Encrypt all secrets with a newly generated key:
+
+    $ wrench svc stop
+    $ wrench secret rotate-key -new-key-file=secrets-2024.key
+    (set SecretsKeyFile = "secrets-2024.key" in config.toml)
+    $ wrench svc start
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	newKeyFile := flagSet.String("new-key-file", "", "path to the new key, relative to the wrench directory (generated if it does not exist)")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if *newKeyFile == "" {
+			return &cmder.UsageError{Err: errors.New("expected -new-key-file")}
+		}
+
+		var cfg wrench.Config
+		if err := wrench.LoadConfig(*secretConfigFile, &cfg); err != nil {
+			return errors.Wrap(err, "LoadConfig")
+		}
+		oldKey, err := cfg.LoadSecretsKey()
+		if err != nil {
+			return errors.Wrap(err, "loading current secrets key")
+		}
+		// Resolved the same way as SecretsKeyFile, so that the file is where the config will look.
+		keyPath, err := filepath.Abs(cfg.Path(*newKeyFile))
+		if err != nil {
+			return errors.Wrap(err, "Abs")
+		}
+
+		var newKey []byte
+		if data, err := os.ReadFile(keyPath); err == nil {
+			newKey, err = wrench.ParseSecretsKey(string(data))
+			if err != nil {
+				return errors.Wrap(err, keyPath)
+			}
+		} else if os.IsNotExist(err) {
+			newKey, err = wrench.GenerateSecretsKey()
+			if err != nil {
+				return errors.Wrap(err, "GenerateSecretsKey")
+			}
+			if err := wrench.WriteSecretsKeyFile(keyPath, newKey); err != nil {
+				return errors.Wrap(err, "WriteSecretsKeyFile")
+			}
+			fmt.Printf("generated new key: %s\n", keyPath)
+		} else {
+			return err
+		}
+
+		store, err := wrench.OpenStore(&cfg)
+		if err != nil {
+			return errors.Wrap(err, "OpenStore")
+		}
+		defer store.Close() //nolint:errcheck
+		if oldKey != nil {
+			if err := store.SetSecretsKey(oldKey); err != nil {
+				return errors.Wrap(err, "SetSecretsKey")
+			}
+		}
+		n, err := store.RotateSecretsKey(context.Background(), newKey)
+		if err != nil {
+			return errors.Wrap(err, "RotateSecretsKey")
+		}
+		fmt.Printf("re-encrypted %v secrets\n", n)
+		fmt.Printf("now set SecretsKeyFile = %q in config.toml (or $%s) and restart the wrench service\n", keyPath, wrench.SecretsKeyEnv)
+		return nil
+	}
+
+	// Register the command.
+	secretCommands = append(secretCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench secret %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
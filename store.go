@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+)
+
+// storeCommands contains all registered 'wrench store' subcommands.
+var storeCommands cmder.Commander
+
+var (
+	storeFlagSet    = flag.NewFlagSet("store", flag.ExitOnError)
+	storeConfigFile = storeFlagSet.String("config", defaultConfigFilePath(), "Path to TOML configuration file (see config.go)")
+)
+
+func init() {
+	const usage = `wrench store: manage the wrench database (run on the wrench server)
+
+Usage:
+
+	wrench store [-config=config.toml] <command> [arguments]
+
+The commands are:
+
+	backup       write an online backup of the database to a file
+	restore      replace the database with a backup
+	migrate      apply pending database schema migrations
+	purge        purge old data according to the retention config
+
+Use "wrench store <command> -h" for more information about a command.
+`
+
+	usageFunc := func() {
+		fmt.Printf("%s", usage)
+	}
+	storeFlagSet.Usage = usageFunc
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = storeFlagSet.Parse(args)
+		storeCommands.Run(storeFlagSet, "wrench store", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	commands = append(commands, &cmder.Command{
+		FlagSet:   storeFlagSet,
+		Handler:   handler,
+		UsageFunc: usageFunc,
+	})
+}
+
+func storeConfig() (*wrench.Config, error) {
+	var cfg wrench.Config
+	if err := wrench.LoadConfig(*storeConfigFile, &cfg); err != nil {
+		return nil, errors.Wrap(err, "LoadConfig")
+	}
+	if cfg.ModeType() != wrench.ModeWrench || cfg.Runner != "" {
+		return nil, errors.New("the wrench store is only used by a wrench server (not pkg/zig mode or runners)")
+	}
+	return &cfg, nil
+}
+
+// storeName describes the configured store, without revealing any credentials.
+func storeName(cfg *wrench.Config) string {
+	if cfg.StoreBackend == wrench.StoreBackendPostgres {
+		return "postgres (PostgresURL)"
+	}
+	return cfg.StorePath()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+)
+
+func init() {
+	const usage = `
+The backup is consistent even while the wrench service is running. Scheduled backups can also be
+configured using BackupDir in config.toml.
+
+Examples:
+
+  Write a backup of wrench.db:
+
+    $ wrench store backup wrench-backup.db
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("backup", flag.ExitOnError)
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if flagSet.NArg() != 1 {
+			return &cmder.UsageError{Err: errors.New("expected [file] argument")}
+		}
+
+		cfg, err := storeConfig()
+		if err != nil {
+			return err
+		}
+		store, err := wrench.OpenStoreNoMigrate(cfg)
+		if err != nil {
+			return errors.Wrap(err, "OpenStore")
+		}
+		defer store.Close() //nolint:errcheck
+
+		backupStore, ok := store.(wrench.BackupStore)
+		if !ok {
+			return errors.New("backups are only supported by the sqlite store backend; use your database's own tooling (e.g. pg_dump) instead")
+		}
+		if err := backupStore.Backup(context.Background(), flagSet.Arg(0)); err != nil {
+			return errors.Wrap(err, "Backup")
+		}
+		fmt.Println("backed up to", flagSet.Arg(0))
+		return nil
+	}
+
+	// Register the command.
+	storeCommands = append(storeCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench store %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
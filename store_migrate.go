@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+)
+
+func init() {
+	const usage = `
+Migrations are also applied automatically when the wrench service starts.
+
+Examples:
+
+  Show which migrations would be applied, without changing the database:
+
+    $ wrench store migrate -dry-run
+
+  Apply pending migrations:
+
+    $ wrench store migrate
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := flagSet.Bool("dry-run", false, "only print the migrations that would be applied")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+
+		cfg, err := storeConfig()
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+		store, err := wrench.OpenStoreNoMigrate(cfg)
+		if err != nil {
+			return errors.Wrap(err, "OpenStoreNoMigrate")
+		}
+		defer store.Close() //nolint:errcheck
+
+		version, err := store.SchemaVersion(ctx)
+		if err != nil {
+			return errors.Wrap(err, "SchemaVersion")
+		}
+		fmt.Printf("database: %s\n", storeName(cfg))
+		fmt.Printf("schema version: %v (latest: %v)\n", version, wrench.LatestSchemaVersion())
+
+		migrations, err := store.Migrate(ctx, *dryRun)
+		if len(migrations) == 0 && err == nil {
+			fmt.Println("up to date, no migrations to apply")
+			return nil
+		}
+		verb := "applied"
+		if *dryRun {
+			verb = "would apply"
+		}
+		for _, m := range migrations {
+			fmt.Printf("%s: %v %s\n", verb, m.Version, m.Name)
+		}
+		return errors.Wrap(err, "Migrate")
+	}
+
+	// Register the command.
+	storeCommands = append(storeCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench store %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
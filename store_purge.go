@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+)
+
+func init() {
+	const usage = `
+Old data is also purged automatically once a day by the wrench service, according to the
+[Retention] section of config.toml.
+
+Examples:
+
+  Show how much data would be purged, without changing the database:
+
+    $ wrench store purge -dry-run
+
+  Purge old data now:
+
+    $ wrench store purge
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("purge", flag.ExitOnError)
+	dryRun := flagSet.Bool("dry-run", false, "only report what would be purged")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+
+		cfg, err := storeConfig()
+		if err != nil {
+			return err
+		}
+		store, err := wrench.OpenStore(cfg)
+		if err != nil {
+			return errors.Wrap(err, "OpenStore")
+		}
+		defer store.Close() //nolint:errcheck
+
+		report, err := store.Purge(context.Background(), cfg.Retention, *dryRun)
+		if err != nil {
+			return errors.Wrap(err, "Purge")
+		}
+		fmt.Println(report)
+		return nil
+	}
+
+	// Register the command.
+	storeCommands = append(storeCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench store %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}
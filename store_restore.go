@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/hexops/cmder"
+	"github.com/hexops/wrench/internal/errors"
+	"github.com/hexops/wrench/internal/wrench"
+)
+
+func init() {
+	const usage = `
+The backup is checked for integrity, and its schema version must not be newer than this version of
+wrench supports. The current wrench.db is kept alongside it as wrench.db.before-restore-<time>.
+
+The wrench service must be stopped first (see 'wrench service stop'.)
+
+Examples:
+
+  Restore wrench.db from a backup:
+
+    $ wrench store restore wrench-backup.db
+
+`
+
+	// Parse flags for our subcommand.
+	flagSet := flag.NewFlagSet("restore", flag.ExitOnError)
+	force := flagSet.Bool("force", false, "restore even if the wrench service appears to be running")
+
+	// Handles calls to our subcommand.
+	handler := func(args []string) error {
+		_ = flagSet.Parse(args)
+		if flagSet.NArg() != 1 {
+			return &cmder.UsageError{Err: errors.New("expected [file] argument")}
+		}
+
+		cfg, err := storeConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.StoreBackend == wrench.StoreBackendPostgres {
+			return errors.New("restoring backups is only supported by the sqlite store backend")
+		}
+		if !*force {
+			svc, _ := newServiceBotWithConfig(&ServiceConfig{ConfigFile: *storeConfigFile})
+			if status, err := wrench.ServiceStatus(svc); err == nil && status == "running" {
+				return errors.New("wrench service is running; stop it first with 'wrench service stop' (or use -force)")
+			}
+		}
+
+		ctx := context.Background()
+		version, err := wrench.ValidateBackup(ctx, flagSet.Arg(0))
+		if err != nil {
+			return errors.Wrap(err, "invalid backup")
+		}
+		previous, err := wrench.RestoreBackup(ctx, flagSet.Arg(0), cfg.StorePath())
+		if err != nil {
+			return errors.Wrap(err, "RestoreBackup")
+		}
+		if previous != "" {
+			fmt.Println("previous database moved to", previous)
+		}
+		fmt.Printf("restored %s (schema version %v)\n", flagSet.Arg(0), version)
+		if version < wrench.LatestSchemaVersion() {
+			fmt.Println("pending migrations will be applied when wrench next starts")
+		}
+		return nil
+	}
+
+	// Register the command.
+	storeCommands = append(storeCommands, &cmder.Command{
+		FlagSet: flagSet,
+		Handler: handler,
+		UsageFunc: func() {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'wrench store %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Printf("%s", usage)
+		},
+	})
+}